@@ -0,0 +1,283 @@
+package uni
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnsyncedConfigAccess(t *testing.T) {
+	// each test is performed in sequence, so
+	// each change builds on the previous ones;
+	// the config is not reset between tests
+	for i, tc := range []struct {
+		method    string
+		path      string // rawConfigKey will be prepended
+		payload   string
+		expect    string // JSON representation of what the whole config is expected to be after the request
+		shouldErr bool
+	}{
+		{
+			method:  "POST",
+			path:    "",
+			payload: `{"foo": "bar", "list": ["a", "b", "c"]}`, // starting value
+			expect:  `{"foo": "bar", "list": ["a", "b", "c"]}`,
+		},
+		{
+			method:  "POST",
+			path:    "/foo",
+			payload: `"jet"`,
+			expect:  `{"foo": "jet", "list": ["a", "b", "c"]}`,
+		},
+		{
+			method:  "POST",
+			path:    "/bar",
+			payload: `{"aa": "bb", "qq": "zz"}`,
+			expect:  `{"foo": "jet", "bar": {"aa": "bb", "qq": "zz"}, "list": ["a", "b", "c"]}`,
+		},
+		{
+			method: "DELETE",
+			path:   "/bar/qq",
+			expect: `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c"]}`,
+		},
+		{
+			method:    "DELETE",
+			path:      "/bar/qq",
+			expect:    `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c"]}`,
+			shouldErr: true,
+		},
+		{
+			method:  "POST",
+			path:    "/list",
+			payload: `"e"`,
+			expect:  `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c", "e"]}`,
+		},
+		{
+			method:  "PUT",
+			path:    "/list/3",
+			payload: `"d"`,
+			expect:  `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c", "d", "e"]}`,
+		},
+		{
+			method: "DELETE",
+			path:   "/list/3",
+			expect: `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c", "e"]}`,
+		},
+		{
+			method:  "PATCH",
+			path:    "/list/3",
+			payload: `"d"`,
+			expect:  `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c", "d"]}`,
+		},
+		{
+			method:  "POST",
+			path:    "/list/...",
+			payload: `["e", "f", "g"]`,
+			expect:  `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c", "d", "e", "f", "g"]}`,
+		},
+		{
+			method:    "PUT",
+			path:      "/foo",
+			payload:   `"again"`,
+			expect:    `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c", "d", "e", "f", "g"]}`,
+			shouldErr: true,
+		},
+		{
+			method:    "PATCH",
+			path:      "/nope",
+			payload:   `"x"`,
+			expect:    `{"foo": "jet", "bar": {"aa": "bb"}, "list": ["a", "b", "c", "d", "e", "f", "g"]}`,
+			shouldErr: true,
+		},
+	} {
+		err := unsyncedConfigAccess(tc.method, rawConfigKey+tc.path, []byte(tc.payload), nil)
+
+		if tc.shouldErr && err == nil {
+			t.Fatalf("Test %d: Expected error return value, but got: %v", i, err)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Fatalf("Test %d: Should not have had error return value, but got: %v", i, err)
+		}
+
+		// decode the expected config so we can do a convenient DeepEqual
+		var expectedDecoded any
+		err = json.Unmarshal([]byte(tc.expect), &expectedDecoded)
+		if err != nil {
+			t.Fatalf("Test %d: Unmarshaling expected config: %v", i, err)
+		}
+
+		// make sure the resulting config is as we expect it
+		if !reflect.DeepEqual(rawCfg[rawConfigKey], expectedDecoded) {
+			t.Fatalf("Test %d:\nExpected:\n\t%#v\nActual:\n\t%#v",
+				i, expectedDecoded, rawCfg[rawConfigKey])
+		}
+	}
+}
+
+func TestIndexConfigObjects(t *testing.T) {
+	var cfg any
+	err := json.Unmarshal([]byte(`{
+		"apps": {
+			"router": {"@id": "main_router", "rules": [{"@id": 7, "action": "drop"}]}
+		}
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := make(map[string]string)
+	if err := indexConfigObjects(cfg, "/"+rawConfigKey, idx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := map[string]string{
+		"main_router": "/config/apps/router",
+		"7":           "/config/apps/router/rules/0",
+	}
+	if !reflect.DeepEqual(idx, expect) {
+		t.Errorf("expected index %v, got %v", expect, idx)
+	}
+
+	err = json.Unmarshal([]byte(`{"a": {"@id": "x"}, "b": {"@id": "x"}}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexConfigObjects(cfg, "/"+rawConfigKey, make(map[string]string)); err == nil {
+		t.Error("expected error for duplicate IDs, but got none")
+	}
+}
+
+func TestRemoveMetaFields(t *testing.T) {
+	for i, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{
+			input:  `{"@id": "foo", "bar": "baz"}`,
+			expect: `{ "bar": "baz"}`,
+		},
+		{
+			input:  `{"bar": "baz", "@id": "foo"}`,
+			expect: `{"bar": "baz"}`,
+		},
+		{
+			input:  `{"a": 1, "@id": 42, "b": 2}`,
+			expect: `{"a": 1, "b": 2}`,
+		},
+	} {
+		actual := RemoveMetaFields([]byte(tc.input))
+		if string(actual) != tc.expect {
+			t.Errorf("Test %d: Expected %s, got %s", i, tc.expect, actual)
+		}
+	}
+}
+
+func TestChangeConfigIDAndIfMatch(t *testing.T) {
+	err := changeConfig(http.MethodPost, "/"+rawConfigKey, []byte(`{"admin": {"@id": "adm", "disabled": true}}`), "", false)
+	if err != nil {
+		t.Fatalf("loading initial config: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := readConfig("/id/adm", &buf); err != nil {
+		t.Fatalf("reading by ID: %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != `{"@id":"adm","disabled":true}` {
+		t.Errorf("unexpected config at ID: %s", buf.String())
+	}
+
+	if err := readConfig("/id/nope", &buf); err == nil {
+		t.Error("expected error for unknown ID, but got none")
+	}
+
+	hash := etagHasher()
+	if err := readConfig("/"+rawConfigKey, hash); err != nil {
+		t.Fatal(err)
+	}
+	goodEtag := `"/` + rawConfigKey + ` ` + hex.EncodeToString(hash.Sum(nil)) + `"`
+
+	err = changeConfig(http.MethodPost, "/"+rawConfigKey, []byte(`{"admin": {"disabled": true}}`), `"/`+rawConfigKey+` 0000"`, false)
+	if apiErr, ok := err.(APIError); !ok || apiErr.HTTPStatus != http.StatusPreconditionFailed {
+		t.Errorf("expected precondition failed with stale ETag, got: %v", err)
+	}
+
+	err = changeConfig(http.MethodPost, "/"+rawConfigKey, []byte(`{"admin": {"disabled": true}}`), goodEtag, false)
+	if err != nil {
+		t.Errorf("expected change with matching ETag to succeed, got: %v", err)
+	}
+}
+
+func TestAdminHandlerEnforceHost(t *testing.T) {
+	addr, err := ParseNetworkAddress("localhost:2019")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &AdminConfig{Listen: "localhost:2019"}
+	handler := admin.newAdminHandler(addr)
+	if !handler.enforceHost {
+		t.Fatal("expected host checking on loopback listener")
+	}
+
+	for i, tc := range []struct {
+		host   string
+		expect int
+	}{
+		{host: "localhost:2019", expect: http.StatusMethodNotAllowed},
+		{host: "127.0.0.1:2019", expect: http.StatusMethodNotAllowed},
+		{host: "evil.example.com", expect: http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/stop", nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.expect {
+			t.Errorf("Test %d: expected status %d for host %s, got %d", i, tc.expect, tc.host, rec.Code)
+		}
+	}
+}
+
+func TestAdminHandlerOrigins(t *testing.T) {
+	addr, err := ParseNetworkAddress("unix//run/guard-admin.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &AdminConfig{EnforceOrigin: true}
+	handler := admin.newAdminHandler(addr)
+
+	req := httptest.NewRequest(http.MethodGet, "/stop", nil)
+	req.Host = "localhost"
+	req.Header.Set("Origin", "http://attacker.example")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected foreign origin to be rejected, got status %d", rec.Code)
+	}
+}
+
+func TestHandleConfigClearsLastConfig(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+	if err := changeConfig(http.MethodPost, "/"+rawConfigKey, []byte(`{"admin": {"disabled": true}}`), "", false); err != nil {
+		t.Fatal(err)
+	}
+	var reloaded bool
+	SetLastConfig("guard.json", func(string) error {
+		reloaded = true
+		return nil
+	})
+	t.Cleanup(func() { SetLastConfig("", nil) })
+
+	req := httptest.NewRequest(http.MethodPut, "/config/apps", strings.NewReader(`{"test_app": {"name": "from api"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	if err := handleConfig(httptest.NewRecorder(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	// reloading from the file would undo the change
+	if err := reloadFromLastConfig(); err == nil || reloaded {
+		t.Errorf("expected no file to reload from after a change through the API, got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"encoding/json"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AuditLoggerName is the name of the logger of the audit log,
+// which is written to the logs that include it, e.g.:
+//
+//	"logs": {
+//		"audit": {"include": ["audit"], "writer": {"output": "file", "filename": "audit.log"}},
+//		"default": {"exclude": ["audit"]}
+//	}
+const AuditLoggerName = "audit"
+
+// AuditSchemaVersion is the version of the schema of the audit
+// log entries. It is only incremented when fields are renamed,
+// removed or change meaning; fields may be added without it.
+const AuditSchemaVersion = 1
+
+// AuditAction is what a routing or filter decision did
+// with a connection.
+type AuditAction string
+
+const (
+	// AuditRoute means the connection was sent to an egress.
+	AuditRoute AuditAction = "route"
+
+	// AuditDrop means the connection was refused or closed.
+	AuditDrop AuditAction = "drop"
+
+	// AuditHijack means the connection was handled by Guard
+	// itself, e.g. a DNS query answered by the resolver.
+	AuditHijack AuditAction = "hijack"
+)
+
+// AuditRecord is the audit log entry of one routing or filter
+// decision about a connection. It is written with Audit, or by
+// the connection returned from AuditConn when it is closed, at
+// the info level, with the message "audit" and the category
+// "audit", tagged with the action. Its fields are:
+//
+// Field | Type | Description
+// ------|------|------------
+// `schema` | number | AuditSchemaVersion
+// `conn_id` | number | The ID of the connection, if known
+// `network` | string | `tcp` or `udp`
+// `src_ip` | string | The IP address of the client
+// `src_port` | number | The port of the client
+// `dst_ip` | string | The IP address of the destination, if known
+// `dst_port` | number | The port of the destination
+// `protocol` | string | The sniffed protocol, e.g. `tls`, `http`, `quic`, `dns`; omitted if unknown
+// `domain` | string | The sniffed or requested domain; omitted if unknown
+// `ingress` | string | The tag of the ingress the connection arrived on
+// `rule_id` | string | The ID of the matched rule; omitted if no rule matched
+// `action` | string | `route`, `drop` or `hijack`
+// `egress` | string | The tag of the egress the connection was routed to; omitted unless routed
+// `start` | string | When the decision was made, in RFC 3339 format with nanoseconds, UTC
+// `duration_ms` | number | How long the connection lasted, in milliseconds
+// `bytes_up` | number | The number of bytes received from the client
+// `bytes_down` | number | The number of bytes sent to the client
+// `error` | string | Why the connection ended, if it failed; omitted otherwise
+//
+// The JSON encoding of an AuditRecord has the same fields.
+// The source and destination make up the five-tuple with the
+// network.
+type AuditRecord struct {
+	ConnID      uint64
+	Network     string
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+	Protocol    string
+	Domain      string
+	Ingress     string
+	RuleID      string
+	Action      AuditAction
+	Egress      string
+	Start       time.Time
+	Duration    time.Duration
+	BytesUp     uint64
+	BytesDown   uint64
+	Err         error
+}
+
+// MarshalLogObject satisfies the zapcore.ObjectMarshaler interface.
+func (r AuditRecord) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("schema", AuditSchemaVersion)
+	if r.ConnID != 0 {
+		enc.AddUint64("conn_id", r.ConnID)
+	}
+	enc.AddString("network", r.Network)
+	enc.AddString("src_ip", addrString(r.Source.Addr()))
+	enc.AddUint16("src_port", r.Source.Port())
+	enc.AddString("dst_ip", addrString(r.Destination.Addr()))
+	enc.AddUint16("dst_port", r.Destination.Port())
+	if r.Protocol != "" {
+		enc.AddString("protocol", r.Protocol)
+	}
+	if r.Domain != "" {
+		enc.AddString("domain", r.Domain)
+	}
+	if r.Ingress != "" {
+		enc.AddString("ingress", r.Ingress)
+	}
+	if r.RuleID != "" {
+		enc.AddString("rule_id", r.RuleID)
+	}
+	enc.AddString("action", string(r.Action))
+	if r.Egress != "" {
+		enc.AddString("egress", r.Egress)
+	}
+	enc.AddString("start", r.Start.UTC().Format(time.RFC3339Nano))
+	enc.AddInt64("duration_ms", r.Duration.Milliseconds())
+	enc.AddUint64("bytes_up", r.BytesUp)
+	enc.AddUint64("bytes_down", r.BytesDown)
+	if r.Err != nil {
+		enc.AddString("error", r.Err.Error())
+	}
+	return nil
+}
+
+// MarshalJSON encodes the record with the fields of the audit log.
+func (r AuditRecord) MarshalJSON() ([]byte, error) {
+	enc := zapcore.NewMapObjectEncoder()
+	if err := r.MarshalLogObject(enc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(enc.Fields)
+}
+
+// MsgToString implements Msger.
+func (r AuditRecord) MsgToString() (string, error) {
+	return "audit", nil
+}
+
+// ExtraToString implements Extra.
+func (r AuditRecord) ExtraToString() (string, error) {
+	b, err := r.MarshalJSON()
+	return string(b), err
+}
+
+// LogEntry returns the log entry of the record.
+func (r AuditRecord) LogEntry() LogEntry {
+	return LogEntry{
+		Level:    "info",
+		Category: "audit",
+		Tags:     []string{string(r.Action)},
+		Msg:      r,
+		Extra:    r,
+	}
+}
+
+// Audit writes the record to the audit log. If the
+// start of the record is not set, it is set to now.
+func Audit(r AuditRecord) {
+	if r.Start.IsZero() {
+		r.Start = time.Now()
+	}
+	if err := r.LogEntry().Write(Log().Named(AuditLoggerName)); err != nil {
+		Log().Error("writing audit log entry", zap.Error(err))
+	}
+}
+
+// AuditConn returns conn, the connection of a client, wrapped so
+// that it counts the bytes received from and sent to the client,
+// and writes r to the audit log with them once it is closed. The
+// duration is measured from the start of r, or from now if it is
+// not set; the source and network default to those of the remote
+// address of conn. The error the connection ended with, if any,
+// can be set with SetAuditError before it is closed.
+func AuditConn(conn net.Conn, r AuditRecord) *AuditedConn {
+	if r.Start.IsZero() {
+		r.Start = time.Now()
+	}
+	if !r.Source.IsValid() {
+		r.Source = addrPortOf(conn.RemoteAddr())
+	}
+	if r.Network == "" {
+		r.Network = conn.RemoteAddr().Network()
+	}
+	return &AuditedConn{Conn: conn, record: r}
+}
+
+// AuditedConn is a connection that is audited when closed;
+// see AuditConn.
+type AuditedConn struct {
+	net.Conn
+	record    AuditRecord
+	up, down  atomic.Uint64
+	errMu     sync.Mutex
+	err       error
+	closeOnce sync.Once
+}
+
+// Read reads from the client, counting the bytes up.
+func (c *AuditedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.up.Add(uint64(n))
+	return n, err
+}
+
+// Write writes to the client, counting the bytes down.
+func (c *AuditedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.down.Add(uint64(n))
+	return n, err
+}
+
+// SetAuditError records why the connection failed, to be
+// included in its audit log entry.
+func (c *AuditedConn) SetAuditError(err error) {
+	c.errMu.Lock()
+	c.err = err
+	c.errMu.Unlock()
+}
+
+// Close closes the connection and, the first time
+// it is called, writes its audit log entry.
+func (c *AuditedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		r := c.record
+		r.Duration = time.Since(r.Start)
+		r.BytesUp = c.up.Load()
+		r.BytesDown = c.down.Load()
+		c.errMu.Lock()
+		r.Err = c.err
+		c.errMu.Unlock()
+		Audit(r)
+	})
+	return err
+}
+
+// addrString returns the string of addr, or
+// an empty string if it is the zero value.
+func addrString(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.Unmap().String()
+}
+
+// addrPortOf returns the IP address and port of addr,
+// if it is a TCP or UDP address.
+func addrPortOf(addr net.Addr) netip.AddrPort {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.AddrPort()
+	case *net.UDPAddr:
+		return a.AddrPort()
+	}
+	return netip.AddrPort{}
+}
+
+// Interface guards
+var (
+	_ zapcore.ObjectMarshaler = AuditRecord{}
+	_ Msger                   = AuditRecord{}
+	_ Extra                   = AuditRecord{}
+	_ net.Conn                = (*AuditedConn)(nil)
+)
@@ -0,0 +1,157 @@
+package uni
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+	testLogsMu.Lock()
+	delete(testLogs, "audit") // left over from a previous run
+	testLogsMu.Unlock()
+
+	err := Load([]byte(`{
+		"admin": {"disabled": true},
+		"logging": {"logs": {
+			"audit": {"writer": {"output": "test_memory", "name": "audit"}, "include": ["audit"]},
+			"default": {"writer": {"output": "discard"}, "exclude": ["audit"]}
+		}}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	Audit(AuditRecord{
+		ConnID:      7,
+		Network:     "udp",
+		Source:      netip.MustParseAddrPort("10.0.0.2:5353"),
+		Destination: netip.MustParseAddrPort("[2001:db8::53]:53"),
+		Protocol:    "dns",
+		Domain:      "ads.example",
+		Ingress:     "tun-in",
+		RuleID:      "block-ads",
+		Action:      AuditDrop,
+		Start:       start,
+	})
+
+	client, server := net.Pipe()
+	conn := AuditConn(server, AuditRecord{
+		Network:     "tcp",
+		Source:      netip.MustParseAddrPort("10.0.0.2:40000"),
+		Destination: netip.MustParseAddrPort("93.184.216.34:443"),
+		Protocol:    "tls",
+		Domain:      "example.com",
+		RuleID:      "default",
+		Action:      AuditRoute,
+		Egress:      "direct",
+	})
+	go func() {
+		_, _ = client.Write([]byte("hello"))
+		_, _ = io.ReadFull(client, make([]byte, 3))
+		client.Close()
+	}()
+	if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("hey")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetAuditError(errors.New("reset by peer"))
+	conn.Close()
+	conn.Close()
+
+	lines := strings.Split(strings.TrimSpace(testLogged("audit")), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d: %v", len(lines), lines)
+	}
+	var drop, route map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &drop); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &route); err != nil {
+		t.Fatal(err)
+	}
+	for key, expect := range map[string]any{
+		"logger":      "audit",
+		"msg":         "audit",
+		"category":    "audit",
+		"schema":      float64(AuditSchemaVersion),
+		"conn_id":     float64(7),
+		"network":     "udp",
+		"src_ip":      "10.0.0.2",
+		"src_port":    float64(5353),
+		"dst_ip":      "2001:db8::53",
+		"dst_port":    float64(53),
+		"protocol":    "dns",
+		"domain":      "ads.example",
+		"ingress":     "tun-in",
+		"rule_id":     "block-ads",
+		"action":      "drop",
+		"start":       "2025-03-04T05:06:07Z",
+		"duration_ms": float64(0),
+		"bytes_up":    float64(0),
+	} {
+		if drop[key] != expect {
+			t.Errorf("drop: expected %s=%v, got %v", key, expect, drop[key])
+		}
+	}
+	if _, ok := drop["egress"]; ok {
+		t.Errorf("drop: expected no egress: %s", lines[0])
+	}
+	for key, expect := range map[string]any{
+		"action":     "route",
+		"egress":     "direct",
+		"dst_ip":     "93.184.216.34",
+		"bytes_up":   float64(5),
+		"bytes_down": float64(3),
+		"error":      "reset by peer",
+	} {
+		if route[key] != expect {
+			t.Errorf("route: expected %s=%v, got %v", key, expect, route[key])
+		}
+	}
+	if tags, _ := json.Marshal(route["tags"]); string(tags) != `["route"]` {
+		t.Errorf("route: expected the action as tag, got %s", tags)
+	}
+}
+
+func TestLogEntryWrite(t *testing.T) {
+	var buf strings.Builder
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zapcore.DebugLevel))
+
+	entry := LogEntry{
+		Time:     "2025-01-02T03:04:05Z",
+		Level:    "warning",
+		Category: "user-action",
+		Tags:     []string{"a", "b"},
+		Msg:      AuditRecord{},
+		Extra:    testExtra("details"),
+	}
+	if err := entry.Write(logger); err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"level":"warn","ts":1735787045,"msg":"audit","category":"user-action","tags":["a","b"],"extra":"details"}` + "\n"
+	if buf.String() != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, buf.String())
+	}
+
+	entry.Level = "verbose"
+	if err := entry.Write(logger); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+type testExtra string
+
+func (e testExtra) ExtraToString() (string, error) { return string(e), nil }
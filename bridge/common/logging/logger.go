@@ -65,6 +65,7 @@ type Logger interface {
 	Trace(args ...any)
 	Debug(args ...any)
 	Info(args ...any)
+	Warn(args ...any)
 	Error(args ...any)
 	Fatal(args ...any)
 	Panic(args ...any)
@@ -37,6 +37,3 @@ func ParseDuration(s string) (time.Duration, error) {
 	}
 	return time.ParseDuration(s)
 }
-
-// TODO func setResourceLimits(logger *zap.Logger) func()
-//    => func SetResourceLimits(logger *zap.Logger) func()
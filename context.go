@@ -1,16 +1,563 @@
 package uni
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
 
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+// Context is a type which defines the lifetime of modules that
+// are loaded and provides access to the parent configuration
+// that spawned the modules which are loaded. It should be used
+// with care and wrapped with derivation functions from the
+// standard context package only if you don't need the Uni
+// specific features. These contexts are canceled when the
+// lifetime of the modules loaded from it is over.
+//
+// Use NewContext() to get a valid value (but most modules will
+// not actually need to do this).
 type Context struct {
 	context.Context
-	moduleInstances map[string]Module
+	moduleInstances map[string][]Module
 	cfg             *Config
 	ancestry        []Module
-	cleanupFunces   []func()
-	exitFuncs       []func(context.Context)
+
+	// cleanupFunces and exitFuncs are shared by every copy
+	// of a Context value, so that callbacks registered by a
+	// module on the copy it was provisioned with are not lost.
+	cleanupFunces *[]func()
+	exitFuncs     *[]func(context.Context)
+
+	metrics *Metrics
+}
+
+// NewContext provides a new context derived from the given
+// context ctx. Normally, you will not need to call this
+// function unless you are loading modules which have a
+// different lifespan than the ones for the context the
+// module was provisioned with. Be sure to call the cancel
+// func when the context is to be cleaned up so that
+// modules which are loaded will be properly unloaded.
+// See standard library context package's documentation.
+func NewContext(ctx Context) (Context, context.CancelFunc) {
+	newCtx := Context{
+		moduleInstances: make(map[string][]Module),
+		cfg:             ctx.cfg,
+		cleanupFunces:   new([]func()),
+		exitFuncs:       ctx.exitFuncs,
+		metrics:         ctx.metrics,
+	}
+	if newCtx.exitFuncs == nil {
+		newCtx.exitFuncs = new([]func(context.Context))
+	}
+	if newCtx.metrics == nil {
+		newCtx.metrics = newMetrics()
+	}
+	c, cancel := context.WithCancel(ctx.Context)
+	wrappedCancel := func() {
+		cancel()
+
+		for _, f := range *newCtx.cleanupFunces {
+			f()
+		}
+
+		for modName, modInstances := range newCtx.moduleInstances {
+			for _, inst := range modInstances {
+				if cu, ok := inst.(CleanerUpper); ok {
+					err := cu.Cleanup()
+					if err != nil {
+						Log().Error("module cleanup failed",
+							zap.String("module", modName),
+							zap.Error(err))
+					}
+				}
+			}
+		}
+	}
+	newCtx.Context = c
+	return newCtx, wrappedCancel
+}
+
+// OnCancel executes f when ctx is canceled.
+func (ctx Context) OnCancel(f func()) {
+	if ctx.cleanupFunces == nil {
+		panic("context was not created with NewContext")
+	}
+	*ctx.cleanupFunces = append(*ctx.cleanupFunces, f)
+}
+
+// OnExit executes f when the process exits gracefully.
+// The function is only executed if the process is gracefully
+// shut down while this context is active.
+func (ctx Context) OnExit(f func(context.Context)) {
+	if ctx.exitFuncs == nil {
+		panic("context was not created with NewContext")
+	}
+	*ctx.exitFuncs = append(*ctx.exitFuncs, f)
+}
+
+// LoadModule loads the Uni module(s) from the specified field of the parent struct
+// pointer and returns the loaded module(s). The struct pointer and its field name as
+// a string are necessary so that reflection can be used to read the struct tag on the
+// field to get the module namespace and other parameters from the `caddy` struct tag.
+//
+// The field can be any one of the supported raw module types: `json.RawMessage`,
+// `[]json.RawMessage`, `map[string]json.RawMessage`, or `[]map[string]json.RawMessage`.
+// ModuleMap may be used in place of `map[string]json.RawMessage`. The return value's
+// underlying type mirrors the input field's type:
+//
+//	json.RawMessage              => any
+//	[]json.RawMessage            => []any
+//	map[string]json.RawMessage   => map[string]any
+//	[]map[string]json.RawMessage => []map[string]any
+//
+// The field must have a `caddy` struct tag in this format:
+//
+//	caddy:"key1=val1 key2=val2"
+//
+// To load modules, a "namespace" key is required. For example, to load modules
+// in the "uni.logging.writers" namespace:
+//
+//	caddy:"namespace=uni.logging.writers"
+//
+// The module name must also be available. If the field type is a map or slice of maps,
+// then key is assumed to be the module name if an "inline_key" is NOT specified in the
+// caddy struct tag. In this case, the module name does NOT need to be specified in-line
+// with the module itself.
+//
+// If not a map, or if inline_key is non-empty, then the module name must be embedded
+// into the values, which must be objects; then there must be a key in those objects
+// where its associated value is the module name. This is called the "inline key",
+// meaning the key containing the module's name that is defined inline with the module
+// itself. You must specify the inline key in a struct tag, along with the namespace:
+//
+//	caddy:"namespace=uni.logging.writers inline_key=output"
+//
+// This will look for a key/value pair like `"output": "..."` in the modules's
+// JSON data, which is the module name within the namespace.
+//
+// After loading the module, the field is set to its zero value so the raw JSON
+// can be garbage collected.
+func (ctx Context) LoadModule(structPointer any, fieldName string) (any, error) {
+	val := reflect.ValueOf(structPointer).Elem().FieldByName(fieldName)
+	typ := val.Type()
+
+	field, ok := reflect.TypeOf(structPointer).Elem().FieldByName(fieldName)
+	if !ok {
+		panic(fmt.Sprintf("field %s does not exist in %#v", fieldName, structPointer))
+	}
+
+	opts, err := ParseStructTag(field.Tag.Get("caddy"))
+	if err != nil {
+		panic(fmt.Sprintf("malformed tag on field %s: %v", fieldName, err))
+	}
+
+	moduleNamespace, ok := opts["namespace"]
+	if !ok {
+		panic(fmt.Sprintf("missing 'namespace' key in struct tag on field %s", fieldName))
+	}
+	inlineModuleKey := opts["inline_key"]
+
+	var result any
+
+	switch val.Kind() {
+	case reflect.Slice:
+		if isJSONRawMessage(typ) {
+			// val is `json.RawMessage` ([]uint8 under the hood)
+
+			if inlineModuleKey == "" {
+				panic("unable to determine module name without inline_key when type is not a ModuleMap")
+			}
+			val, err := ctx.loadModuleInline(inlineModuleKey, moduleNamespace, val.Interface().(json.RawMessage))
+			if err != nil {
+				return nil, err
+			}
+			result = val
+		} else if isJSONRawMessage(typ.Elem()) {
+			// val is `[]json.RawMessage`
+
+			if inlineModuleKey == "" {
+				panic("unable to determine module name without inline_key because type is not a ModuleMap")
+			}
+			var all []any
+			for i := 0; i < val.Len(); i++ {
+				val, err := ctx.loadModuleInline(inlineModuleKey, moduleNamespace, val.Index(i).Interface().(json.RawMessage))
+				if err != nil {
+					return nil, fmt.Errorf("position %d: %v", i, err)
+				}
+				all = append(all, val)
+			}
+			result = all
+		} else if isModuleMapType(typ.Elem()) {
+			// val is `[]map[string]json.RawMessage`
+
+			var all []map[string]any
+			for i := 0; i < val.Len(); i++ {
+				thisSet, err := ctx.loadModulesFromSomeMap(moduleNamespace, inlineModuleKey, val.Index(i))
+				if err != nil {
+					return nil, err
+				}
+				all = append(all, thisSet)
+			}
+			result = all
+		} else {
+			return nil, fmt.Errorf("unrecognized type for module: %s", typ)
+		}
+
+	case reflect.Map:
+		// val is a ModuleMap or some other kind of map
+		result, err = ctx.loadModulesFromSomeMap(moduleNamespace, inlineModuleKey, val)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unrecognized type for module: %s", typ)
+	}
+
+	// we're done with the raw bytes; allow GC to deallocate
+	val.Set(reflect.Zero(typ))
+
+	return result, nil
+}
+
+// loadModulesFromSomeMap loads modules from val, which must be a type of map.
+func (ctx Context) loadModulesFromSomeMap(namespace, inlineModuleKey string, val reflect.Value) (map[string]any, error) {
+	// if no inline_key is specified, then val must be a ModuleMap,
+	// where the key is the module name
+	if inlineModuleKey == "" {
+		if !isModuleMapType(val.Type()) {
+			panic(fmt.Sprintf("expected ModuleMap because inline_key is empty; but we do not recognize this type: %s", val.Type()))
+		}
+		return ctx.loadModuleMap(namespace, val)
+	}
+
+	// otherwise, val is a map with modules, but the module name is
+	// inline with each value (the key means something else)
+	return ctx.loadModulesFromRegularMap(namespace, inlineModuleKey, val)
+}
+
+// loadModulesFromRegularMap loads modules from val, where val is a map[string]json.RawMessage.
+// Map keys are NOT interpreted as module names, so module names are still expected to appear
+// inline with the objects.
+func (ctx Context) loadModulesFromRegularMap(namespace, inlineModuleKey string, val reflect.Value) (map[string]any, error) {
+	mods := make(map[string]any)
+	iter := val.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		v := iter.Value()
+		mod, err := ctx.loadModuleInline(inlineModuleKey, namespace, v.Interface().(json.RawMessage))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", k, err)
+		}
+		mods[k.String()] = mod
+	}
+	return mods, nil
+}
+
+// loadModuleMap loads modules from a ModuleMap, i.e. map[string]any, where the key is the
+// module name. With a module map, module names do not need to be defined inline with their
+// values.
+func (ctx Context) loadModuleMap(namespace string, val reflect.Value) (map[string]any, error) {
+	all := make(map[string]any)
+	iter := val.MapRange()
+	for iter.Next() {
+		k := iter.Key().Interface().(string)
+		v := iter.Value().Interface().(json.RawMessage)
+		moduleName := namespace + "." + k
+		if namespace == "" {
+			moduleName = k
+		}
+		val, err := ctx.LoadModuleByID(moduleName, v)
+		if err != nil {
+			return nil, fmt.Errorf("module name '%s': %v", k, err)
+		}
+		all[k] = val
+	}
+	return all, nil
+}
+
+// LoadModuleByID decodes rawMsg into a new instance of mod and
+// returns the value. If mod.New is nil, an error is returned.
+// If the module implements Validator or Provisioner interfaces,
+// those methods are invoked to ensure the module is fully
+// configured and valid before being used.
+//
+// This is a lower-level method and will usually not be called
+// directly by most modules. However, this method is useful when
+// dynamically loading/unloading modules in their own context,
+// like from embedded scripts, etc.
+func (ctx Context) LoadModuleByID(id string, rawMsg json.RawMessage) (any, error) {
+	modulesMu.RLock()
+	modInfo, ok := modules[id]
+	modulesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown module: %s", id)
+	}
+
+	if modInfo.New == nil {
+		return nil, fmt.Errorf("module '%s' has no constructor", modInfo.ID)
+	}
+
+	val := modInfo.New()
+
+	// value must be a pointer for unmarshaling into concrete type, even if
+	// the module's concrete type is a slice or map; New() *should* return
+	// a pointer, otherwise unmarshaling errors or panics will occur
+	if rv := reflect.ValueOf(val); rv.Kind() != reflect.Pointer {
+		log.Printf("[WARNING] ModuleInfo.New() for module '%s' did not return a pointer,"+
+			" so we are using reflection to make a pointer instead; please fix this by"+
+			" using new(Type) or &Type notation in your module's New() function.", id)
+		val = reflect.New(rv.Type()).Elem().Addr().Interface().(Module)
+	}
+
+	// fill in its config only if there is a config to fill in
+	if len(rawMsg) > 0 {
+		err := StrictUnmarshalJSON(rawMsg, &val)
+		if err != nil {
+			return nil, fmt.Errorf("decoding module config: %s: %v", modInfo, err)
+		}
+	}
+
+	if val == nil {
+		// returned module values are almost always type-asserted
+		// before being used, so a nil value would panic; and there
+		// is no good reason to explicitly declare null modules in
+		// a config; it might be because the user is trying to achieve
+		// a result the developer isn't expecting, which is a smell
+		return nil, fmt.Errorf("module value cannot be null")
+	}
+
+	var err error
+
+	// if this is an app module, keep a reference to it,
+	// since submodules may need to reference it during
+	// provisioning (even though the parent app module
+	// may not be fully provisioned yet)
+	if appModule, ok := val.(App); ok && ctx.cfg != nil && ctx.cfg.apps != nil {
+		ctx.cfg.appsMu.Lock()
+		ctx.cfg.apps[id] = appModule
+		ctx.cfg.appsMu.Unlock()
+		defer func() {
+			if err != nil {
+				// a half-provisioned app must never be started
+				ctx.cfg.appsMu.Lock()
+				delete(ctx.cfg.apps, id)
+				ctx.cfg.failedApps[id] = err
+				ctx.cfg.appsMu.Unlock()
+			}
+		}()
+	}
+
+	ctx.ancestry = append(ctx.ancestry, val)
+
+	if prov, ok := val.(Provisioner); ok {
+		err = prov.Provision(ctx)
+		if err != nil {
+			// incomplete provisioning could have left state
+			// dangling, so make sure it gets cleaned up along
+			// with the rest of this context
+			ctx.cleanupOnCancel(id, val)
+			return nil, fmt.Errorf("provision %s: %w", modInfo, err)
+		}
+	}
+
+	if validator, ok := val.(Validator); ok {
+		err = validator.Validate()
+		if err != nil {
+			// since the module was already provisioned, make sure we clean up
+			ctx.cleanupOnCancel(id, val)
+			return nil, fmt.Errorf("%s: invalid configuration: %w", modInfo, err)
+		}
+	}
+
+	ctx.moduleInstances[id] = append(ctx.moduleInstances[id], val)
+
+	// if the loaded module happens to be an app that can emit events, store it so the
+	// core can have access to emit events without an import cycle
+	if ee, ok := val.(eventEmitter); ok && ctx.cfg != nil {
+		if _, ok := ee.(App); ok {
+			ctx.cfg.eventEmitter = ee
+		}
+	}
+
+	return val, nil
+}
+
+// cleanupOnCancel registers the Cleanup method of mod, if it
+// has one, to run when ctx is canceled. It is used for modules
+// that failed to load and are thus not tracked as instances.
+func (ctx Context) cleanupOnCancel(id string, mod Module) {
+	cu, ok := mod.(CleanerUpper)
+	if !ok || ctx.cleanupFunces == nil {
+		return
+	}
+	ctx.OnCancel(func() {
+		if err := cu.Cleanup(); err != nil {
+			Log().Error("module cleanup failed",
+				zap.String("module", id),
+				zap.Error(err))
+		}
+	})
+}
+
+// loadModuleInline loads a module from a JSON raw message which decodes to
+// a map[string]any, where one of the object keys is moduleNameKey
+// and the corresponding value is the module name (as a string) which can
+// be found in the given scope. In other words, the module name is declared
+// in-line with the module itself.
+//
+// This allows modules to be decoded into their concrete types and used when
+// their names cannot be the unique key in a map, such as when there are
+// multiple instances in the map or it appears in an array (where there are
+// no custom keys). In other words, the key containing the module name is
+// treated special/separate from all the other keys in the object.
+func (ctx Context) loadModuleInline(moduleNameKey, moduleScope string, raw json.RawMessage) (any, error) {
+	moduleName, raw, err := getModuleNameInline(moduleNameKey, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := ctx.LoadModuleByID(moduleScope+"."+moduleName, raw)
+	if err != nil {
+		return nil, fmt.Errorf("loading module '%s': %v", moduleName, err)
+	}
+
+	return val, nil
+}
+
+// App returns the configured app named name. If that app has
+// not yet been loaded and provisioned, it will be immediately
+// loaded and provisioned. If no app with that name is
+// configured, a new empty one will be instantiated instead.
+// (The app module must still be registered.) This must not be
+// called during the Provision/Validate phase to reference a
+// module's own host app (since the parent app module is still
+// in the process of being provisioned, it is not yet ready).
+func (ctx Context) App(name string) (any, error) {
+	if ctx.cfg == nil {
+		return nil, fmt.Errorf("app module %s: no config loaded", name)
+	}
+	ctx.cfg.appsMu.RLock()
+	app, ok := ctx.cfg.apps[name]
+	failErr, failed := ctx.cfg.failedApps[name]
+	ctx.cfg.appsMu.RUnlock()
+	if ok {
+		return app, nil
+	}
+	if failed {
+		return nil, fmt.Errorf("%s app module failed to load: %w", name, failErr)
+	}
+	appRaw := ctx.cfg.AppsRaw[name]
+	modVal, err := ctx.LoadModuleByID(name, appRaw)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s app module: %v", name, err)
+	}
+	if appRaw != nil {
+		ctx.cfg.AppsRaw[name] = nil // allow GC to deallocate
+	}
+	return modVal, nil
+}
+
+// AppIfConfigured is like App, but it returns an error if the
+// app has not been configured. This is useful when the app is
+// required and its absence is a configuration error; or when
+// the app is optional and you don't want to instantiate a
+// new one that hasn't been explicitly configured.
+func (ctx Context) AppIfConfigured(name string) (any, error) {
+	if ctx.cfg == nil {
+		return nil, fmt.Errorf("app module %s: no config loaded", name)
+	}
+	ctx.cfg.appsMu.RLock()
+	app, ok := ctx.cfg.apps[name]
+	ctx.cfg.appsMu.RUnlock()
+	if ok {
+		return app, nil
+	}
+	appRaw := ctx.cfg.AppsRaw[name]
+	if appRaw == nil {
+		return nil, fmt.Errorf("app module %s is not configured", name)
+	}
+	return ctx.App(name)
+}
+
+// Metrics returns the metrics registry of the config that ctx
+// belongs to. Modules may register their own collectors with it
+// while being provisioned; the registry is discarded along with
+// the config, so collectors need not be unregistered.
+// The traffic collectors it holds are shared by all configs.
+func (ctx Context) Metrics() *Metrics {
+	return ctx.metrics
+}
+
+// Storage returns the configured Uni storage implementation.
+func (ctx Context) Storage() certmagic.Storage {
+	return ctx.cfg.storage
+}
+
+// Modules returns the lineage of modules that this context provisioned,
+// with the most recent/current module being last in the list.
+func (ctx Context) Modules() []Module {
+	mods := make([]Module, len(ctx.ancestry))
+	copy(mods, ctx.ancestry)
+	return mods
 }
 
+// Module returns the current module, or the most recent one
+// provisioned by the context.
+func (ctx Context) Module() Module {
+	if len(ctx.ancestry) == 0 {
+		return nil
+	}
+	return ctx.ancestry[len(ctx.ancestry)-1]
+}
+
+// Logger returns a logger that is intended for use by the most
+// recent module associated with the context. It is named after
+// the module's ID, so that its entries can be routed to the
+// custom logs that include that name. Modules may name loggers
+// derived from it for more specificity, e.g. "kdns.query".
+func (ctx Context) Logger() *zap.Logger {
+	mod := ctx.Module()
+	if mod == nil {
+		return Log()
+	}
+	if ctx.cfg == nil {
+		return Log().Named(string(mod.UniModule().ID))
+	}
+	return ctx.cfg.Logging.Logger(mod)
+}
+
+// EmitEvent emits an event named eventName with the given data
+// through the events app of the current config, if one is
+// configured, and returns it. Handlers may abort the event, in
+// which case the returned event's Aborted field is set; emitters
+// of cancellable events should check it and stop what they were
+// doing. If no events app is configured, the event is dropped.
+func (ctx Context) EmitEvent(eventName string, data map[string]any) Event {
+	return ctx.emitEvent(eventName, data)
+}
+
+// emitEvent is a small convenience method so the Guard core can
+// emit events, if the event app is configured.
+func (ctx Context) emitEvent(name string, data map[string]any) Event {
+	if ctx.cfg == nil || ctx.cfg.eventEmitter == nil {
+		return Event{}
+	}
+	return ctx.cfg.eventEmitter.Emit(ctx, name, data)
+}
+
+// eventEmitter is implemented by the events app, which is
+// stored in the config when loaded so that the core can
+// emit events without importing it.
 type eventEmitter interface {
 	Emit(ctx Context, eventName string, data map[string]any) Event
 }
+
+// CtxKey is a value type for use with context.WithValue.
+type CtxKey string
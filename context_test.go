@@ -0,0 +1,151 @@
+package uni
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func init() {
+	RegisterModule(testLoaderModule{})
+	RegisterModule(testFailingModule{})
+}
+
+// testLoaderModule is a module in the uni.test.loader
+// namespace used to exercise Context.LoadModule.
+type testLoaderModule struct {
+	Value string `json:"value,omitempty"`
+
+	provisioned bool
+	ancestors   int
+}
+
+func (testLoaderModule) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "uni.test.loader.ok",
+		New: func() Module { return new(testLoaderModule) },
+	}
+}
+
+func (m *testLoaderModule) Provision(ctx Context) error {
+	m.provisioned = true
+	m.ancestors = len(ctx.Modules())
+	return nil
+}
+
+// testFailingModule fails validation and counts its cleanups.
+type testFailingModule struct{}
+
+var testFailingCleanups int
+
+func (testFailingModule) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "uni.test.loader.bad",
+		New: func() Module { return new(testFailingModule) },
+	}
+}
+
+func (*testFailingModule) Validate() error { return errors.New("always invalid") }
+
+func (*testFailingModule) Cleanup() error {
+	testFailingCleanups++
+	return nil
+}
+
+type testLoaderHost struct {
+	One   json.RawMessage   `caddy:"namespace=uni.test.loader inline_key=type"`
+	List  []json.RawMessage `caddy:"namespace=uni.test.loader inline_key=type"`
+	Map   ModuleMap         `caddy:"namespace=uni.test.loader"`
+	Maps  []ModuleMap       `caddy:"namespace=uni.test.loader"`
+	NoTag json.RawMessage
+}
+
+func TestLoadModule(t *testing.T) {
+	ctx, cancel := NewContext(Context{Context: context.Background(), cfg: new(Config)})
+	defer cancel()
+
+	host := &testLoaderHost{
+		One:  json.RawMessage(`{"type": "ok", "value": "one"}`),
+		List: []json.RawMessage{json.RawMessage(`{"type": "ok", "value": "a"}`), json.RawMessage(`{"type": "ok"}`)},
+		Map:  ModuleMap{"ok": json.RawMessage(`{"value": "m"}`)},
+		Maps: []ModuleMap{{"ok": json.RawMessage(`{}`)}, {"ok": json.RawMessage(`{"value": "z"}`)}},
+	}
+
+	one, err := ctx.LoadModule(host, "One")
+	if err != nil {
+		t.Fatalf("loading single module: %v", err)
+	}
+	mod := one.(*testLoaderModule)
+	if mod.Value != "one" || !mod.provisioned {
+		t.Errorf("module not decoded and provisioned: %+v", mod)
+	}
+	if mod.ancestors != 1 {
+		t.Errorf("expected the module itself in its ancestry, got %d modules", mod.ancestors)
+	}
+	if host.One != nil {
+		t.Error("expected raw field to be zeroed after loading")
+	}
+
+	list, err := ctx.LoadModule(host, "List")
+	if err != nil {
+		t.Fatalf("loading module list: %v", err)
+	}
+	if mods := list.([]any); len(mods) != 2 || mods[0].(*testLoaderModule).Value != "a" {
+		t.Errorf("unexpected module list: %#v", mods)
+	}
+
+	m, err := ctx.LoadModule(host, "Map")
+	if err != nil {
+		t.Fatalf("loading module map: %v", err)
+	}
+	if mods := m.(map[string]any); mods["ok"].(*testLoaderModule).Value != "m" {
+		t.Errorf("unexpected module map: %#v", mods)
+	}
+
+	maps, err := ctx.LoadModule(host, "Maps")
+	if err != nil {
+		t.Fatalf("loading module map list: %v", err)
+	}
+	if mods := maps.([]map[string]any); len(mods) != 2 || mods[1]["ok"].(*testLoaderModule).Value != "z" {
+		t.Errorf("unexpected module map list: %#v", mods)
+	}
+
+	if n := len(ctx.moduleInstances["uni.test.loader.ok"]); n != 6 {
+		t.Errorf("expected 6 tracked instances, got %d", n)
+	}
+}
+
+func TestLoadModuleErrors(t *testing.T) {
+	ctx, cancel := NewContext(Context{Context: context.Background(), cfg: new(Config)})
+
+	host := &testLoaderHost{One: json.RawMessage(`{"type": "ok", "nope": true}`)}
+	if _, err := ctx.LoadModule(host, "One"); err == nil {
+		t.Error("expected error for unknown field, but got none")
+	}
+
+	host = &testLoaderHost{One: json.RawMessage(`{"type": "missing"}`)}
+	if _, err := ctx.LoadModule(host, "One"); err == nil {
+		t.Error("expected error for unregistered module, but got none")
+	}
+
+	testFailingCleanups = 0
+	host = &testLoaderHost{One: json.RawMessage(`{"type": "bad"}`)}
+	if _, err := ctx.LoadModule(host, "One"); err == nil {
+		t.Error("expected validation error, but got none")
+	}
+	if testFailingCleanups != 0 {
+		t.Error("expected cleanup to be deferred until the context is canceled")
+	}
+	cancel()
+	if testFailingCleanups != 1 {
+		t.Errorf("expected failed module to be cleaned up once on cancel, got %d", testFailingCleanups)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for field without struct tag")
+		}
+	}()
+	_, _ = ctx.LoadModule(&testLoaderHost{NoTag: json.RawMessage(`{}`)}, "NoTag")
+}
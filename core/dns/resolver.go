@@ -14,6 +14,7 @@ import (
 	"uni/bridge/tools/freelru"
 	"uni/bridge/tools/maphash"
 	"uni/core/dns/server/unreal"
+	"uni/core/log"
 
 	"github.com/miekg/dns"
 )
@@ -39,6 +40,7 @@ type Resolver struct {
 	rdrc           RDRCStore
 	initRDRCStore  func() RDRCStore
 	logger         logging.ContextLogger
+	metrics        ResolverMetrics
 	cache          freelru.Cache[dns.Question, *dns.Msg]
 	transportCache freelru.Cache[transportCacheKey, *dns.Msg]
 }
@@ -51,6 +53,15 @@ type ResolverOptions struct {
 	CacheCapacity uint32
 	RDRC          func() RDRCStore
 	Logger        logging.ContextLogger
+	Metrics       ResolverMetrics
+}
+
+// ResolverMetrics receives the cache lookups and upstream
+// exchanges of a Resolver, by transport name.
+type ResolverMetrics interface {
+	CacheHit(transportName string)
+	CacheMiss(transportName string)
+	ObserveUpstream(transportName string, d time.Duration, err error)
 }
 
 type QueryOptions struct {
@@ -90,11 +101,15 @@ func NewResolver(options ResolverOptions) *Resolver {
 		disableExpire: options.DisableExpire,
 		initRDRCStore: options.RDRC,
 		logger:        options.Logger,
+		metrics:       options.Metrics,
 	}
 
 	if resolver.timeout == 0 {
 		resolver.timeout = DefaultTimeout
 	}
+	if resolver.logger == nil {
+		resolver.logger = log.Logger("dns")
+	}
 
 	cacheCapacity := options.CacheCapacity
 	if cacheCapacity < 1024 {
@@ -196,8 +211,10 @@ func (r *Resolver) ExchangeWithResponseCheck(ctx context.Context, transport Tran
 
 	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 
+	start := time.Now()
 	response, err := transport.Exchange(ctx, msg) // DNS Query
 	cancel()
+	r.observeUpstream(transport, start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -395,8 +412,10 @@ func (r *Resolver) LookupWithResponseCheck(ctx context.Context, transport Transp
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	start := time.Now()
 	response, err := transport.Lookup(ctx, domain, options.UnrealStrategy)
 	cancel()
+	r.observeUpstream(transport, start, err)
 	if err != nil {
 		return nil, wrapError(err)
 	}
@@ -575,8 +594,28 @@ func MsgToAddrs(response *dns.Msg) []netip.Addr {
 	return addrs
 }
 
-// 从缓存中获取 DNS 响应并更新 TTL
+// 从缓存中获取 DNS 响应，并记录命中与否
 func (r *Resolver) loadResponse(question dns.Question, transport Transport) (*dns.Msg, int) {
+	response, ttl := r.loadCachedResponse(question, transport)
+	if r.metrics != nil {
+		if response != nil {
+			r.metrics.CacheHit(transport.Name())
+		} else {
+			r.metrics.CacheMiss(transport.Name())
+		}
+	}
+	return response, ttl
+}
+
+// observeUpstream reports an upstream exchange that began at start.
+func (r *Resolver) observeUpstream(transport Transport, start time.Time, err error) {
+	if r.metrics != nil {
+		r.metrics.ObserveUpstream(transport.Name(), time.Since(start), err)
+	}
+}
+
+// 从缓存中获取 DNS 响应并更新 TTL
+func (r *Resolver) loadCachedResponse(question dns.Question, transport Transport) (*dns.Msg, int) {
 	var (
 		response *dns.Msg
 		ok       bool
@@ -1 +1,239 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package log adapts the logging.ContextLogger of the bridge
+// and core packages to the structured logs of Guard, so that
+// their output goes through the configured logs like that of
+// any module.
 package log
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"uni"
+	"uni/bridge/common/logging"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger returns a logging.ContextLogger that writes to the
+// default logger, uni.Log(), named name if it is not empty.
+// The default logger is looked up for each entry, so the
+// returned logger follows the logs of the current config.
+func Logger(name string) logging.ContextLogger {
+	// the logger is derived again only when the default
+	// logger was replaced, i.e. a new config was loaded
+	var derived atomic.Pointer[derivedLogger]
+	return &contextLogger{logger: func() *zap.Logger {
+		base := uni.Log()
+		if d := derived.Load(); d != nil && d.base == base {
+			return d.logger
+		}
+		logger := base
+		if name != "" {
+			logger = logger.Named(name)
+		}
+		d := &derivedLogger{base: base, logger: skipCallers(logger)}
+		derived.Store(d)
+		return d.logger
+	}}
+}
+
+// derivedLogger is a logger derived from base.
+type derivedLogger struct {
+	base, logger *zap.Logger
+}
+
+// New returns a logging.ContextLogger that writes to logger,
+// typically the logger of a module from uni.Context.Logger().
+func New(logger *zap.Logger) logging.ContextLogger {
+	logger = skipCallers(logger)
+	return &contextLogger{logger: func() *zap.Logger { return logger }}
+}
+
+// skipCallers returns logger with the frames of a contextLogger
+// skipped, so the caller of its methods is reported.
+func skipCallers(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.AddCallerSkip(2))
+}
+
+// contextLogger is a logging.ContextLogger that writes
+// to a zap logger. The levels map as follows:
+//
+//	Trace, Debug -> zap Debug
+//	Info         -> zap Info
+//	Warn         -> zap Warn
+//	Error        -> zap Error
+//	Fatal        -> zap Fatal (exits the process)
+//	Panic        -> zap Panic (panics)
+//
+// Entries logged with a context have the ID and the
+// ingress and egress tags of the context as fields.
+type contextLogger struct {
+	// logger returns the logger to write to,
+	// with the callers skipped by skipCallers.
+	logger func() *zap.Logger
+}
+
+func (l *contextLogger) Trace(args ...any) { l.log(nil, zapcore.DebugLevel, args) }
+func (l *contextLogger) Debug(args ...any) { l.log(nil, zapcore.DebugLevel, args) }
+func (l *contextLogger) Info(args ...any)  { l.log(nil, zapcore.InfoLevel, args) }
+func (l *contextLogger) Warn(args ...any)  { l.log(nil, zapcore.WarnLevel, args) }
+func (l *contextLogger) Error(args ...any) { l.log(nil, zapcore.ErrorLevel, args) }
+func (l *contextLogger) Fatal(args ...any) { l.log(nil, zapcore.FatalLevel, args) }
+func (l *contextLogger) Panic(args ...any) { l.log(nil, zapcore.PanicLevel, args) }
+
+func (l *contextLogger) TraceContext(ctx context.Context, args ...any) {
+	l.log(ctx, zapcore.DebugLevel, args)
+}
+
+func (l *contextLogger) DebugContext(ctx context.Context, args ...any) {
+	l.log(ctx, zapcore.DebugLevel, args)
+}
+
+func (l *contextLogger) InfoContext(ctx context.Context, args ...any) {
+	l.log(ctx, zapcore.InfoLevel, args)
+}
+
+func (l *contextLogger) WarnContext(ctx context.Context, args ...any) {
+	l.log(ctx, zapcore.WarnLevel, args)
+}
+
+func (l *contextLogger) ErrorContext(ctx context.Context, args ...any) {
+	l.log(ctx, zapcore.ErrorLevel, args)
+}
+
+func (l *contextLogger) FatalContext(ctx context.Context, args ...any) {
+	l.log(ctx, zapcore.FatalLevel, args)
+}
+
+func (l *contextLogger) PanicContext(ctx context.Context, args ...any) {
+	l.log(ctx, zapcore.PanicLevel, args)
+}
+
+// log writes an entry made of args at level. Like the
+// bridge loggers, args are concatenated without spaces.
+func (l *contextLogger) log(ctx context.Context, level zapcore.Level, args []any) {
+	ce := l.logger().Check(level, "")
+	if ce == nil {
+		return
+	}
+	var msg strings.Builder
+	for _, arg := range args {
+		fmt.Fprint(&msg, arg)
+	}
+	ce.Message = msg.String()
+	ce.Write(Fields(ctx)...)
+}
+
+// Fields returns the zap fields of the ID and the
+// ingress and egress tags of ctx, as far as ctx
+// has them; ctx may be nil.
+func Fields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+	meta, ok := ctx.Value(metadataKey{}).(metadata)
+	if !ok {
+		return nil
+	}
+	fields := make([]zap.Field, 0, 3)
+	if meta.id != 0 {
+		fields = append(fields, zap.Uint64("id", meta.id))
+	}
+	if meta.ingress != "" {
+		fields = append(fields, zap.String("ingress", meta.ingress))
+	}
+	if meta.egress != "" {
+		fields = append(fields, zap.String("egress", meta.egress))
+	}
+	return fields
+}
+
+// metadata is what a context carries for logging
+// about the connection or request it belongs to.
+type metadata struct {
+	id      uint64
+	ingress string
+	egress  string
+}
+
+type metadataKey struct{}
+
+// lastID is the last ID that was minted.
+var lastID atomic.Uint64
+
+// NewID mints an ID for a connection or request,
+// unique for the lifetime of the process.
+func NewID() uint64 {
+	return lastID.Add(1)
+}
+
+// ContextWithNewID returns a context derived from ctx that
+// carries a new ID, for a connection or request that is
+// handled with it; the ingress and egress tags of ctx
+// are kept.
+func ContextWithNewID(ctx context.Context) context.Context {
+	return ContextWithID(ctx, NewID())
+}
+
+// ContextWithID returns a context derived from ctx that
+// carries id, e.g. that of the connection a DNS query
+// arrived on.
+func ContextWithID(ctx context.Context, id uint64) context.Context {
+	meta, _ := ctx.Value(metadataKey{}).(metadata)
+	meta.id = id
+	return context.WithValue(ctx, metadataKey{}, meta)
+}
+
+// ContextWithIngress returns a context derived from ctx
+// that carries the tag of the ingress it was accepted by.
+func ContextWithIngress(ctx context.Context, tag string) context.Context {
+	meta, _ := ctx.Value(metadataKey{}).(metadata)
+	meta.ingress = tag
+	return context.WithValue(ctx, metadataKey{}, meta)
+}
+
+// ContextWithEgress returns a context derived from ctx
+// that carries the tag of the egress it is sent through.
+func ContextWithEgress(ctx context.Context, tag string) context.Context {
+	meta, _ := ctx.Value(metadataKey{}).(metadata)
+	meta.egress = tag
+	return context.WithValue(ctx, metadataKey{}, meta)
+}
+
+// IDFromContext returns the ID ctx carries, if any.
+func IDFromContext(ctx context.Context) (uint64, bool) {
+	meta, ok := ctx.Value(metadataKey{}).(metadata)
+	return meta.id, ok && meta.id != 0
+}
+
+// IngressFromContext returns the ingress tag ctx carries, if any.
+func IngressFromContext(ctx context.Context) (string, bool) {
+	meta, ok := ctx.Value(metadataKey{}).(metadata)
+	return meta.ingress, ok && meta.ingress != ""
+}
+
+// EgressFromContext returns the egress tag ctx carries, if any.
+func EgressFromContext(ctx context.Context) (string, bool) {
+	meta, ok := ctx.Value(metadataKey{}).(metadata)
+	return meta.egress, ok && meta.egress != ""
+}
+
+// Interface guard
+var _ logging.ContextLogger = (*contextLogger)(nil)
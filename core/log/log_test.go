@@ -0,0 +1,154 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"uni/unitest"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newObserved returns a logger that records its entries,
+// with the caller, and that panics instead of exiting on
+// fatal entries.
+func newObserved() (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(core, zap.AddCaller(), zap.WithFatalHook(zapcore.WriteThenPanic)), logs
+}
+
+func TestLevels(t *testing.T) {
+	logger, logs := newObserved()
+	l := New(logger)
+	ctx := context.Background()
+
+	for i, tc := range []struct {
+		log    func()
+		expect zapcore.Level
+	}{
+		{log: func() { l.Trace("trace") }, expect: zapcore.DebugLevel},
+		{log: func() { l.Debug("debug") }, expect: zapcore.DebugLevel},
+		{log: func() { l.Info("info") }, expect: zapcore.InfoLevel},
+		{log: func() { l.Warn("warn") }, expect: zapcore.WarnLevel},
+		{log: func() { l.Error("error") }, expect: zapcore.ErrorLevel},
+		{log: func() { l.Fatal("fatal") }, expect: zapcore.FatalLevel},
+		{log: func() { l.Panic("panic") }, expect: zapcore.PanicLevel},
+		{log: func() { l.TraceContext(ctx, "trace") }, expect: zapcore.DebugLevel},
+		{log: func() { l.DebugContext(ctx, "debug") }, expect: zapcore.DebugLevel},
+		{log: func() { l.InfoContext(ctx, "info") }, expect: zapcore.InfoLevel},
+		{log: func() { l.WarnContext(ctx, "warn") }, expect: zapcore.WarnLevel},
+		{log: func() { l.ErrorContext(ctx, "error") }, expect: zapcore.ErrorLevel},
+		{log: func() { l.FatalContext(ctx, "fatal") }, expect: zapcore.FatalLevel},
+		{log: func() { l.PanicContext(ctx, "panic") }, expect: zapcore.PanicLevel},
+	} {
+		func() {
+			defer func() { _ = recover() }() // fatal and panic entries panic
+			tc.log()
+		}()
+		entries := logs.TakeAll()
+		if len(entries) != 1 {
+			t.Errorf("Test %d: expected one entry, got %d", i, len(entries))
+			continue
+		}
+		if entries[0].Level != tc.expect {
+			t.Errorf("Test %d: expected level %s, got %s", i, tc.expect, entries[0].Level)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	logger, logs := newObserved()
+	New(logger).Info("dial ", "example.com", ":", 443)
+	if msg := logs.All()[0].Message; msg != "dial example.com:443" {
+		t.Errorf("expected concatenated args, got %q", msg)
+	}
+}
+
+func TestFields(t *testing.T) {
+	logger, logs := newObserved()
+	l := New(logger)
+
+	ctx := ContextWithNewID(context.Background())
+	ctx = ContextWithIngress(ctx, "socks-in")
+	ctx = ContextWithEgress(ctx, "direct")
+	id, ok := IDFromContext(ctx)
+	if !ok || id == 0 {
+		t.Fatal("expected the context to carry an ID")
+	}
+	if next := NewID(); next <= id {
+		t.Errorf("expected a new ID after %d, got %d", id, next)
+	}
+
+	l.InfoContext(ctx, "connected")
+	l.Info("without context")
+	l.InfoContext(ContextWithEgress(context.Background(), "proxy"), "egress only")
+
+	entries := logs.All()
+	expect := []map[string]any{
+		{"id": id, "ingress": "socks-in", "egress": "direct"},
+		{},
+		{"egress": "proxy"},
+	}
+	for i, e := range entries {
+		if fmt.Sprint(e.ContextMap()) != fmt.Sprint(expect[i]) {
+			t.Errorf("entry %d: expected fields %v, got %v", i, expect[i], e.ContextMap())
+		}
+	}
+
+	// a new ID keeps the tags
+	ctx = ContextWithNewID(ctx)
+	if tag, _ := IngressFromContext(ctx); tag != "socks-in" {
+		t.Errorf("expected the ingress to be kept, got %q", tag)
+	}
+	if tag, _ := EgressFromContext(ctx); tag != "direct" {
+		t.Errorf("expected the egress to be kept, got %q", tag)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	logger, logs := newObserved()
+	l := New(logger)
+	l.Info("plain")
+	l.InfoContext(context.Background(), "with context")
+	for _, e := range logs.All() {
+		if !e.Caller.Defined || filepath.Base(e.Caller.File) != "log_test.go" {
+			t.Errorf("%s: expected the caller to be the test, got %s", e.Message, e.Caller)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	logs := unitest.CaptureLogs(t)
+	Logger("dns").Info("resolved")
+	Logger("").Warn("unnamed")
+
+	entries := logs.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected two entries, got %+v", entries)
+	}
+	if entries[0].Logger != "dns" || entries[0].Message != "resolved" {
+		t.Errorf("expected an entry of the dns logger, got %+v", entries[0])
+	}
+	if entries[1].Logger != "" || entries[1].Level != zapcore.WarnLevel {
+		t.Errorf("expected a warning of the default logger, got %+v", entries[1])
+	}
+}
+
+func TestLoggerFollowsDefaultLogger(t *testing.T) {
+	l := Logger("dns")
+	first := unitest.CaptureLogs(t)
+	l.Info("before")
+	second := unitest.CaptureLogs(t)
+	l.Info("after")
+
+	if entries := first.Entries(); len(entries) != 1 || entries[0].Message != "before" {
+		t.Errorf("expected only the first entry in the first logs, got %+v", entries)
+	}
+	if entries := second.Entries(); len(entries) != 1 || entries[0].Message != "after" || entries[0].Logger != "dns" {
+		t.Errorf("expected only the second entry in the replacing logs, got %+v", entries)
+	}
+}
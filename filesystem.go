@@ -15,11 +15,79 @@
 
 package uni
 
-import "io/fs"
+import (
+	"io/fs"
+	"path"
+	"strings"
 
+	"uni/internal/filesystems"
+)
+
+// FileSystemsAppName is the name of the app that registers the
+// configured file systems; it is provisioned before other apps.
+const FileSystemsAppName = "filesystems"
+
+// FileSystems is a registry of named file systems. Each config
+// has its own registry, which modules in the uni.fs namespace
+// are added to (see the filesystems app); it always has a
+// default file system, which is the local OS unless replaced.
+// Implementations must be safe for concurrent use.
 type FileSystems interface {
 	Register(k string, v fs.FS)
-	Unreister(k string)
+	Unregister(k string)
 	Get(k string) (v fs.FS, ok bool)
 	Default() fs.FS
 }
+
+// FileSystems returns the file system registry of the config
+// that ctx belongs to.
+func (ctx Context) FileSystems() FileSystems {
+	if ctx.cfg == nil || ctx.cfg.fileSystems == nil {
+		// no config (e.g. in tests); still resolve with the defaults
+		return &filesystems.FileSystemMap{}
+	}
+	return ctx.cfg.fileSystems
+}
+
+// ResolveFile resolves name, which is either a plain path in the
+// default file system or of the form "fs_name:path" to refer to
+// path in the file system registered as fs_name, into a file
+// system and the path within it. Config fields that refer to files,
+// like rule-set paths and CA files, should be resolved with this
+// so that they can point into embedded or in-memory file systems.
+//
+// If the part before the colon is not the name of a registered
+// file system, name is taken as a path in the default file system
+// as a whole; so Windows paths like "C:\guard\ca.pem" keep working.
+// Paths in named file systems are relative to its root; a leading
+// slash is ignored.
+func (ctx Context) ResolveFile(name string) (fs.FS, string) {
+	fileSystems := ctx.FileSystems()
+	if fsName, p, ok := strings.Cut(name, ":"); ok {
+		if fsys, ok := fileSystems.Get(fsName); ok && fsName != "" {
+			p = path.Clean("/" + p)[1:]
+			if p == "" {
+				p = "."
+			}
+			return fsys, p
+		}
+	}
+	return fileSystems.Default(), name
+}
+
+// ReadFile reads the file name, given in any form accepted by
+// ResolveFile, and returns its contents.
+func (ctx Context) ReadFile(name string) ([]byte, error) {
+	fsys, p := ctx.ResolveFile(name)
+	return fs.ReadFile(fsys, p)
+}
+
+// OpenFile opens the file name, given in any form accepted by
+// ResolveFile.
+func (ctx Context) OpenFile(name string) (fs.File, error) {
+	fsys, p := ctx.ResolveFile(name)
+	return fsys.Open(p)
+}
+
+// Interface guard
+var _ FileSystems = (*filesystems.FileSystemMap)(nil)
@@ -0,0 +1,91 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystems
+
+import (
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultFileSystemKey is the key of the file system used
+	// for paths that do not name a file system.
+	DefaultFileSystemKey = "default"
+)
+
+// DefaultFileSystem is the file system registered under the
+// default key unless another one replaces it: the local OS.
+var DefaultFileSystem fs.FS = OsFS{}
+
+// FileSystemMap is a concurrency-safe map of named file
+// systems. The zero value is ready to use.
+type FileSystemMap struct {
+	m sync.Map
+}
+
+// Register will add the file system with key to later be retrieved.
+// A call with a nil fs will call Unregister, ensuring that a call
+// to Default() will never be nil.
+func (f *FileSystemMap) Register(k string, v fs.FS) {
+	k = f.key(k)
+	if v == nil {
+		f.Unregister(k)
+		return
+	}
+	f.m.Store(k, v)
+}
+
+// Unregister will remove the file system with key from the map.
+// If the key is the default key, the default is reset to the OS
+// file system instead of deleting it. Modules should call this
+// on cleanup to be safe.
+func (f *FileSystemMap) Unregister(k string) {
+	k = f.key(k)
+	if k == DefaultFileSystemKey {
+		f.m.Store(k, DefaultFileSystem)
+	} else {
+		f.m.Delete(k)
+	}
+}
+
+// Get will get a file system with a given key.
+func (f *FileSystemMap) Get(k string) (v fs.FS, ok bool) {
+	k = f.key(k)
+	c, ok := f.m.Load(k)
+	if !ok {
+		if k == DefaultFileSystemKey {
+			f.m.Store(k, DefaultFileSystem)
+			return DefaultFileSystem, true
+		}
+		return nil, ok
+	}
+	return c.(fs.FS), true
+}
+
+// Default will get the default file system in the map.
+func (f *FileSystemMap) Default() fs.FS {
+	val, _ := f.Get(DefaultFileSystemKey)
+	return val
+}
+
+func (f *FileSystemMap) key(k string) string {
+	k = strings.TrimSpace(k)
+	if k == "" {
+		k = DefaultFileSystemKey
+	}
+	return k
+}
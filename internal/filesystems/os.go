@@ -0,0 +1,44 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystems
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// OsFS is a simple fs.FS implementation that uses the local
+// file system. (We do not use os.DirFS because we do our own
+// rooting or path prefixing without being constrained to a single
+// root folder. The standard os.DirFS implementation is problematic
+// since roots can be dynamic in our application.)
+//
+// OsFS also implements fs.StatFS, fs.GlobFS, fs.ReadDirFS, and fs.ReadFileFS.
+type OsFS struct{}
+
+func (OsFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (OsFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (OsFS) Glob(pattern string) ([]string, error)      { return filepath.Glob(pattern) }
+func (OsFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (OsFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+
+var (
+	_ fs.StatFS     = (*OsFS)(nil)
+	_ fs.GlobFS     = (*OsFS)(nil)
+	_ fs.ReadDirFS  = (*OsFS)(nil)
+	_ fs.ReadFileFS = (*OsFS)(nil)
+)
@@ -58,6 +58,18 @@ func (c *LogBufferCore) FlushTo(logger *zap.Logger) {
 	c.fields = nil
 }
 
+// Entries returns a copy of the buffered log entries and
+// their fields, in the order they were written.
+func (c *LogBufferCore) Entries() ([]zapcore.Entry, [][]zapcore.Field) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]zapcore.Entry, len(c.entries))
+	copy(entries, c.entries)
+	fields := make([][]zapcore.Field, len(c.fields))
+	copy(fields, c.fields)
+	return entries, fields
+}
+
 type LogBufferCoreInterface interface {
 	zapcore.Core
 	FlushTo(*zap.Logger)
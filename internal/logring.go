@@ -0,0 +1,202 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// LogRingEntry is a log entry kept by a LogRingCore,
+// with its fields decoded into plain values.
+type LogRingEntry struct {
+	Time    time.Time      `json:"ts"`
+	Level   zapcore.Level  `json:"level"`
+	Logger  string         `json:"logger,omitempty"`
+	Message string         `json:"msg"`
+	Caller  string         `json:"caller,omitempty"`
+	Stack   string         `json:"stacktrace,omitempty"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// LogRingCore is a zapcore.Core that keeps the last entries
+// written to it in memory, in a ring buffer, and passes new
+// entries on to its subscribers. Unlike LogBufferCore, it
+// keeps the context fields added with With.
+type LogRingCore struct {
+	*logRing
+	level  zapcore.LevelEnabler
+	fields []zapcore.Field
+}
+
+// logRing is the ring buffer shared by a
+// LogRingCore and the cores derived from it.
+type logRing struct {
+	mu      sync.Mutex
+	entries []LogRingEntry
+	next    int  // index the next entry is written to
+	full    bool // whether entries wrapped around
+	subs    map[chan LogRingEntry]struct{}
+	closed  bool
+}
+
+// NewLogRingCore returns a core that keeps the
+// last size entries enabled by level.
+func NewLogRingCore(size int, level zapcore.LevelEnabler) *LogRingCore {
+	return &LogRingCore{
+		logRing: &logRing{
+			entries: make([]LogRingEntry, size),
+			subs:    make(map[chan LogRingEntry]struct{}),
+		},
+		level: level,
+	}
+}
+
+// SetLevel sets the levels of the entries kept by
+// the core. It must be called before the core is
+// used.
+func (c *LogRingCore) SetLevel(level zapcore.LevelEnabler) {
+	c.level = level
+}
+
+func (c *LogRingCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl)
+}
+
+func (c *LogRingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &LogRingCore{
+		logRing: c.logRing,
+		level:   c.level,
+		fields:  append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *LogRingCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *LogRingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	e := LogRingEntry{
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Logger:  entry.LoggerName,
+		Message: entry.Message,
+		Stack:   entry.Stack,
+	}
+	if entry.Caller.Defined {
+		e.Caller = entry.Caller.TrimmedPath()
+	}
+	if len(enc.Fields) > 0 {
+		e.Fields = enc.Fields
+	}
+	c.add(e)
+	return nil
+}
+
+func (c *LogRingCore) Sync() error { return nil }
+
+// add keeps e, in place of the oldest entry if the
+// ring is full, and sends it to the subscribers.
+// Subscribers that are not keeping up miss it.
+func (r *logRing) add(e LogRingEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+	for ch := range r.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Entries returns a copy of the kept entries,
+// oldest first.
+func (r *logRing) Entries() []LogRingEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshot()
+}
+
+func (r *logRing) snapshot() []LogRingEntry {
+	if !r.full {
+		return append([]LogRingEntry(nil), r.entries[:r.next]...)
+	}
+	entries := make([]LogRingEntry, 0, len(r.entries))
+	entries = append(entries, r.entries[r.next:]...)
+	return append(entries, r.entries[:r.next]...)
+}
+
+// Subscribe returns the kept entries, oldest first, and a
+// channel that receives the entries written from then on;
+// up to buffer entries are queued for a slow receiver,
+// later ones are dropped. The channel is closed when the
+// core is closed or the returned function is called.
+func (r *logRing) Subscribe(buffer int) ([]LogRingEntry, <-chan LogRingEntry, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan LogRingEntry, buffer)
+	if r.closed {
+		close(ch)
+		return r.snapshot(), ch, func() {}
+	}
+	r.subs[ch] = struct{}{}
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if _, ok := r.subs[ch]; ok {
+				delete(r.subs, ch)
+				close(ch)
+			}
+		})
+	}
+	return r.snapshot(), ch, unsubscribe
+}
+
+// Close closes the channels of all subscribers;
+// entries written afterwards are not kept.
+func (r *logRing) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for ch := range r.subs {
+		delete(r.subs, ch)
+		close(ch)
+	}
+	return nil
+}
+
+var _ zapcore.Core = (*LogRingCore)(nil)
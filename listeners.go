@@ -16,10 +16,18 @@
 package uni
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/netip"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // listenFdsStart is the first file descriptor number for systemd socket activation.
@@ -111,3 +119,609 @@ func IsUnixNetwork(netw string) bool {
 func IsFdNetwork(netw string) bool {
 	return strings.HasPrefix(netw, "fd")
 }
+
+// PortRangeSize returns how many ports are in
+// pa's port range. Port ranges are inclusive,
+// so the size is the difference of start and
+// end ports plus one.
+func (na NetworkAddress) PortRangeSize() uint {
+	if na.EndPort < na.StartPort {
+		return 0
+	}
+	return (na.EndPort - na.StartPort) + 1
+}
+
+// Listen is similar to net.Listen, with a few differences:
+//
+// Listen announces on the network address using the port calculated by adding
+// portOffset to the start port. (For network types that do not use ports, the
+// portOffset is ignored.)
+//
+// The provided ListenConfig is used to create the listener. Its Control function,
+// if set, may be wrapped by an internally-used Control function. The provided
+// context may be used to cancel long operations early. The context is not used
+// to close the listener after it has been created.
+//
+// Listeners are shared: if a socket for the same network and address is
+// already open in this process, e.g. by the config that is being replaced
+// during a reload, it is reused rather than bound again, and the socket
+// is only really closed once every user of it has closed its listener.
+// This keeps ports from bouncing during config reloads.
+//
+// File descriptor networks (fd, fdgram) wrap sockets that were passed in
+// by the parent process, e.g. by systemd socket activation. The host may
+// be a descriptor number or the name of a socket given in LISTEN_FDNAMES.
+//
+// The return value will be a net.Listener for stream-oriented networks
+// (tcp, unix, unixpacket, fd) and a net.PacketConn for datagram networks
+// (udp, unixgram, fdgram).
+func (na NetworkAddress) Listen(ctx context.Context, portOffset uint, config net.ListenConfig) (any, error) {
+	if na.IsFdNetwork() {
+		return na.listenFd()
+	}
+	address := na.JoinHostPort(portOffset)
+	return listenReusable(ctx, na.Network, address, config)
+}
+
+// ListenAll is like Listen, but opens a listener for every
+// port in na's port range, in order. If any of them fails to
+// open, the ones opened so far are closed again and an error
+// is returned, so it either fully succeeds or has no effect.
+func (na NetworkAddress) ListenAll(ctx context.Context, config net.ListenConfig) ([]any, error) {
+	size := na.PortRangeSize()
+	if na.IsUnixNetwork() || na.IsFdNetwork() {
+		size = 1
+	}
+	lns := make([]any, 0, size)
+	for offset := range size {
+		ln, err := na.Listen(ctx, offset, config)
+		if err != nil {
+			for _, ln := range lns {
+				_ = ln.(io.Closer).Close()
+			}
+			return nil, fmt.Errorf("listening on %s: %v", na.JoinHostPort(offset), err)
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+// listenFd wraps the already-open file descriptor given as
+// the host of an fd or fdgram address into a listener or
+// packet conn, respectively.
+func (na NetworkAddress) listenFd() (any, error) {
+	fd, err := na.fd()
+	if err != nil {
+		return nil, err
+	}
+	lnKey := listenerKey(na.Network, strconv.Itoa(fd))
+
+	if na.Network == "fdgram" {
+		sharedPc, _, err := listenerPool.LoadOrNew(lnKey, func() (Destructor, error) {
+			pc, err := inheritedPacketConn(lnKey)
+			if pc == nil && err == nil {
+				pc, err = net.FilePacketConn(inheritedFile(fd, na.String()))
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &sharedPacketConn{PacketConn: pc, key: lnKey}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &fakeClosePacketConn{sharedPacketConn: sharedPc.(*sharedPacketConn)}, nil
+	}
+
+	sharedLn, _, err := listenerPool.LoadOrNew(lnKey, func() (Destructor, error) {
+		ln, err := inheritedListener(lnKey)
+		if ln == nil && err == nil {
+			ln, err = net.FileListener(inheritedFile(fd, na.String()))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &sharedListener{Listener: ln, key: lnKey}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fakeCloseListener{sharedListener: sharedLn.(*sharedListener)}, nil
+}
+
+// fd returns the file descriptor number of an fd or fdgram
+// address. The host is either the number itself or the name
+// of a socket passed in via systemd socket activation.
+func (na NetworkAddress) fd() (int, error) {
+	if fd, err := strconv.ParseUint(na.Host, 0, strconv.IntSize); err == nil {
+		return int(fd), nil
+	}
+	fd, err := getFdByName(na.Host)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file descriptor %q: %v", na.Host, err)
+	}
+	return fd, nil
+}
+
+// inheritedFile returns the *os.File for the inherited
+// descriptor fd. The file is kept open for the lifetime of
+// the process, since the net package only duplicates it;
+// that way the socket can be listened on again later, even
+// after all of its listeners were closed in the meantime.
+func inheritedFile(fd int, name string) *os.File {
+	inheritedFilesMu.Lock()
+	defer inheritedFilesMu.Unlock()
+	if f, ok := inheritedFiles[fd]; ok {
+		return f
+	}
+	f := os.NewFile(uintptr(fd), name)
+	inheritedFiles[fd] = f
+	return f
+}
+
+// SystemdListenFds returns the names of the sockets passed to this
+// process by systemd socket activation, indexed by their position;
+// the socket at index i has the file descriptor listenFdsStart+i.
+// Sockets without a name are given the name "unknown", like systemd
+// does. It returns nil if no sockets were passed to this process.
+func SystemdListenFds() ([]string, error) {
+	fdsEnv := os.Getenv("LISTEN_FDS")
+	if fdsEnv == "" {
+		return nil, nil
+	}
+	if pidEnv := os.Getenv("LISTEN_PID"); pidEnv != "" {
+		pid, err := strconv.Atoi(pidEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LISTEN_PID: %v", err)
+		}
+		if pid != os.Getpid() {
+			// the sockets were meant for another process
+			// (e.g. our parent), so they are not ours to use
+			return nil, nil
+		}
+	}
+	n, err := strconv.Atoi(fdsEnv)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %q", fdsEnv)
+	}
+
+	names := make([]string, n)
+	var fdNames []string
+	if env := os.Getenv("LISTEN_FDNAMES"); env != "" {
+		fdNames = strings.Split(env, ":")
+	}
+	for i := range names {
+		names[i] = "unknown"
+		if i < len(fdNames) && fdNames[i] != "" {
+			names[i] = fdNames[i]
+		}
+	}
+	return names, nil
+}
+
+// getFdByName returns the file descriptor number of the first
+// socket passed by systemd socket activation with the given name,
+// to this process or, if it is upgrading, the one it took over from.
+func getFdByName(name string) (int, error) {
+	names, err := SystemdListenFds()
+	if err != nil {
+		return 0, err
+	}
+	for i, fdName := range names {
+		if fdName == name {
+			return listenFdsStart + i, nil
+		}
+	}
+	// after an upgrade, the sockets are those of
+	// the process this one took over from
+	if fd, ok := inheritedFdByName(name); ok {
+		return fd, nil
+	}
+	return 0, fmt.Errorf("no socket named %q was passed by the service manager", name)
+}
+
+// isLoopback returns true if the hostname of na
+// refers to a loopback interface on the local
+// machine. It does not do DNS lookups.
+func (na NetworkAddress) isLoopback() bool {
+	if na.IsUnixNetwork() || na.IsFdNetwork() {
+		return true
+	}
+	if na.Host == "localhost" {
+		return true
+	}
+	if ip, err := netip.ParseAddr(na.Host); err == nil {
+		return ip.IsLoopback()
+	}
+	return false
+}
+
+// isWildcardInterface returns true if the host of na
+// is empty or an unspecified address, i.e. if it
+// listens on all interfaces.
+func (na NetworkAddress) isWildcardInterface() bool {
+	if na.Host == "" {
+		return true
+	}
+	if ip, err := netip.ParseAddr(na.Host); err == nil {
+		return ip.IsUnspecified()
+	}
+	return false
+}
+
+// ParseNetworkAddress parses addr into its individual
+// components. The input string is expected to be of
+// the form "network/host:port-range" where any part is
+// optional. The default network, if unspecified, is tcp.
+// Port ranges are inclusive.
+//
+// Network addresses are distinct from URLs and do not
+// use URL syntax.
+func ParseNetworkAddress(addr string) (NetworkAddress, error) {
+	return ParseNetworkAddressWithDefaults(addr, "tcp", 0)
+}
+
+// ParseNetworkAddressWithDefaults is like ParseNetworkAddress but allows
+// the default network and port to be specified.
+func ParseNetworkAddressWithDefaults(addr, defaultNetwork string, defaultPort uint) (NetworkAddress, error) {
+	var host, port string
+	network, host, port, err := SplitNetworkAddress(addr)
+	if err != nil {
+		return NetworkAddress{}, err
+	}
+	if network == "" {
+		network = defaultNetwork
+	}
+	if IsUnixNetwork(network) || IsFdNetwork(network) {
+		if host == "" {
+			return NetworkAddress{}, fmt.Errorf("missing socket path or file descriptor: %s", addr)
+		}
+		return NetworkAddress{
+			Network: network,
+			Host:    host,
+		}, nil
+	}
+	var start, end uint64
+	if port == "" && defaultPort > 0 {
+		port = strconv.FormatUint(uint64(defaultPort), 10)
+	}
+	if port != "" {
+		before, after, found := strings.Cut(port, "-")
+		if !found {
+			after = before
+		}
+		start, err = strconv.ParseUint(before, 10, 16)
+		if err != nil {
+			return NetworkAddress{}, fmt.Errorf("invalid start port: %v", err)
+		}
+		end, err = strconv.ParseUint(after, 10, 16)
+		if err != nil {
+			return NetworkAddress{}, fmt.Errorf("invalid end port: %v", err)
+		}
+		if end < start {
+			return NetworkAddress{}, fmt.Errorf("end port must not be less than start port")
+		}
+		if (end - start) > maxPortSpan {
+			return NetworkAddress{}, fmt.Errorf("port range exceeds %d ports", maxPortSpan)
+		}
+	}
+	return NetworkAddress{
+		Network:   network,
+		Host:      host,
+		StartPort: uint(start),
+		EndPort:   uint(end),
+	}, nil
+}
+
+// SplitNetworkAddress splits a into its network, host, and port components.
+// Note that port may be a port range (:X-Y), or omitted for unix sockets.
+func SplitNetworkAddress(a string) (network, host, port string, err error) {
+	beforeSlash, afterSlash, slashFound := strings.Cut(a, "/")
+	if slashFound {
+		network = strings.ToLower(strings.TrimSpace(beforeSlash))
+		a = afterSlash
+		if IsUnixNetwork(network) || IsFdNetwork(network) {
+			host = a
+			return network, host, port, err
+		}
+	}
+
+	host, port, err = net.SplitHostPort(a)
+	firstErr := err
+
+	if err != nil {
+		// in general, if there was an error, it was likely "missing port",
+		// so try removing square brackets around an IPv6 host, adding a bogus
+		// port to take advantage of standard library's robust parser, then
+		// strip the artificial port.
+		host, _, err = net.SplitHostPort(net.JoinHostPort(strings.Trim(a, "[]"), "0"))
+		port = ""
+	}
+
+	if err != nil {
+		err = errors.Join(firstErr, err)
+	}
+
+	return network, host, port, err
+}
+
+// maxPortSpan is the largest number of ports
+// a single network address may span.
+const maxPortSpan = 65535
+
+// listenReusable opens a listener or packet conn for network and
+// address, sharing the underlying socket with any other user of
+// the same network address in this process. A socket handed over
+// by the process this one is taking over from is used if there
+// is one.
+func listenReusable(ctx context.Context, network, address string, config net.ListenConfig) (any, error) {
+	lnKey := listenerKey(network, address)
+
+	if strings.HasPrefix(network, "udp") || network == "unixgram" {
+		sharedPc, _, err := listenerPool.LoadOrNew(lnKey, func() (Destructor, error) {
+			pc, err := inheritedPacketConn(lnKey)
+			if pc == nil && err == nil {
+				pc, err = config.ListenPacket(ctx, network, address)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &sharedPacketConn{PacketConn: pc, key: lnKey}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &fakeClosePacketConn{sharedPacketConn: sharedPc.(*sharedPacketConn)}, nil
+	}
+
+	sharedLn, _, err := listenerPool.LoadOrNew(lnKey, func() (Destructor, error) {
+		ln, err := inheritedListener(lnKey)
+		if ln == nil && err == nil {
+			ln, err = config.Listen(ctx, network, address)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &sharedListener{Listener: ln, key: lnKey}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fakeCloseListener{sharedListener: sharedLn.(*sharedListener)}, nil
+}
+
+// listenerKey returns the key under which the socket for
+// network and address is kept in the listener pool.
+func listenerKey(network, address string) string {
+	return network + "/" + address
+}
+
+// fakeCloseListener is a private wrapper over a listener that
+// is shared. The state of fakeCloseListener is not shared.
+// This allows one user of a socket to "close" the listener
+// while in reality the socket stays open for other users of
+// the listener. In this way, servers become hot-swappable
+// while the listener remains running. Listeners should be
+// re-wrapped in a new fakeCloseListener each time the listener
+// is reused. This type is atomic and values must not be copied.
+type fakeCloseListener struct {
+	closed int32 // accessed atomically; belongs to this struct only
+	*sharedListener
+}
+
+// Accept accepts connections until Close() is called.
+func (fcl *fakeCloseListener) Accept() (net.Conn, error) {
+	for {
+		// if the listener is already "closed", return error
+		if atomic.LoadInt32(&fcl.closed) == 1 {
+			return nil, fakeClosedErr(fcl.Addr())
+		}
+
+		// call underlying accept
+		conn, err := fcl.sharedListener.Accept()
+		if err == nil {
+			return conn, nil
+		}
+
+		var netErr net.Error
+		timeout := errors.As(err, &netErr) && netErr.Timeout()
+
+		// since Accept() returned an error, it may be because our reference to
+		// the listener (this fakeCloseListener) may have been closed, i.e. the
+		// server is shutting down; in that case, we need to clear the deadline
+		// that we set when Close() was called, and return a non-temporary and
+		// non-timeout error value to the caller, masking the "true" error, so
+		// that server loops / goroutines won't retry, linger, and leak
+		if atomic.LoadInt32(&fcl.closed) == 1 {
+			// we dereference the sharedListener explicitly even though it's embedded
+			// so that it's clear in the code that side-effects are shared with other
+			// users of this listener, not just our own reference to it
+			_ = fcl.sharedListener.clearDeadline()
+			if timeout {
+				return nil, fakeClosedErr(fcl.Addr())
+			}
+			return nil, err
+		}
+
+		// another user of the socket closed its listener, which set a
+		// deadline to kick its server out of Accept(); that deadline is
+		// not meant for us, so clear it and keep accepting
+		if timeout && fcl.sharedListener.deadlineSet() {
+			_ = fcl.sharedListener.clearDeadline()
+			continue
+		}
+
+		return nil, err
+	}
+}
+
+// Close stops accepting new connections without closing the
+// underlying listener. The underlying listener is closed once
+// the last user of it closes its fakeCloseListener.
+func (fcl *fakeCloseListener) Close() error {
+	if atomic.CompareAndSwapInt32(&fcl.closed, 0, 1) {
+		// There are two ways to get an Accept() function to
+		// return to the server loop that called it: close the
+		// listener, or set a deadline in the past. We can't
+		// close the socket yet since others may be using it,
+		// but we can set the deadline in the past; the other
+		// users see a temporary error, retry and clear it.
+		_ = fcl.sharedListener.setDeadline()
+		_, _ = listenerPool.Delete(fcl.sharedListener.key)
+	}
+	return nil
+}
+
+// sharedListener is a wrapper over an underlying listener. The listener
+// and the other fields on the struct are shared state that is synchronized,
+// so sharedListener structs must never be copied (always use a pointer).
+type sharedListener struct {
+	net.Listener
+	key        string // uniquely identifies this listener
+	deadline   bool   // whether a deadline is currently set
+	deadlineMu sync.Mutex
+}
+
+func (sl *sharedListener) deadlineSet() bool {
+	sl.deadlineMu.Lock()
+	defer sl.deadlineMu.Unlock()
+	return sl.deadline
+}
+
+func (sl *sharedListener) clearDeadline() error {
+	var err error
+	sl.deadlineMu.Lock()
+	if sl.deadline {
+		switch ln := sl.Listener.(type) {
+		case deadliner:
+			err = ln.SetDeadline(time.Time{})
+		}
+		sl.deadline = false
+	}
+	sl.deadlineMu.Unlock()
+	return err
+}
+
+func (sl *sharedListener) setDeadline() error {
+	timeInPast := time.Now().Add(-1 * time.Minute)
+	var err error
+	sl.deadlineMu.Lock()
+	if !sl.deadline {
+		switch ln := sl.Listener.(type) {
+		case deadliner:
+			err = ln.SetDeadline(timeInPast)
+		}
+		sl.deadline = true
+	}
+	sl.deadlineMu.Unlock()
+	return err
+}
+
+// Destruct is called by the UsagePool when the listener is
+// finally not being used anymore. It closes the socket.
+func (sl *sharedListener) Destruct() error {
+	return sl.Listener.Close()
+}
+
+// fakeClosePacketConn is like fakeCloseListener, but for PacketConns.
+type fakeClosePacketConn struct {
+	closed int32 // accessed atomically; belongs to this struct only
+	*sharedPacketConn
+}
+
+// ReadFrom reads packets until Close() is called.
+func (fcpc *fakeClosePacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	for {
+		if atomic.LoadInt32(&fcpc.closed) == 1 {
+			return 0, nil, fakeClosedErr(fcpc.LocalAddr())
+		}
+		n, addr, err = fcpc.sharedPacketConn.ReadFrom(p)
+		if err == nil {
+			return n, addr, nil
+		}
+		var netErr net.Error
+		timeout := errors.As(err, &netErr) && netErr.Timeout()
+		if atomic.LoadInt32(&fcpc.closed) == 1 {
+			if timeout {
+				fcpc.sharedPacketConn.clearDeadline()
+				return 0, nil, fakeClosedErr(fcpc.LocalAddr())
+			}
+			return n, addr, err
+		}
+		// the deadline was set by another user closing its conn; see
+		// fakeCloseListener.Accept()
+		if timeout && fcpc.sharedPacketConn.clearDeadline() {
+			continue
+		}
+		return n, addr, err
+	}
+}
+
+// Close won't close the underlying socket unless there is no more reference, then listenerPool will close it.
+func (fcpc *fakeClosePacketConn) Close() error {
+	if atomic.CompareAndSwapInt32(&fcpc.closed, 0, 1) {
+		// unblock ReadFrom() calls to kick old servers out of their loops
+		fcpc.sharedPacketConn.deadline.Store(true)
+		_ = fcpc.SetReadDeadline(time.Now())
+		_, _ = listenerPool.Delete(fcpc.sharedPacketConn.key)
+	}
+	return nil
+}
+
+// sharedPacketConn is like sharedListener, but for net.PacketConns.
+type sharedPacketConn struct {
+	net.PacketConn
+	key      string
+	deadline atomic.Bool // whether a read deadline was set by a fake close
+}
+
+// clearDeadline clears the read deadline if it was set by a
+// fake close, and reports whether it did so.
+func (spc *sharedPacketConn) clearDeadline() bool {
+	if !spc.deadline.CompareAndSwap(true, false) {
+		return false
+	}
+	_ = spc.SetReadDeadline(time.Time{})
+	return true
+}
+
+// Destruct closes the underlying socket.
+func (spc *sharedPacketConn) Destruct() error {
+	return spc.PacketConn.Close()
+}
+
+// deadliner is a type that has a SetDeadline method;
+// listeners for stream-oriented networks have it.
+type deadliner interface {
+	SetDeadline(time.Time) error
+}
+
+// fakeClosedErr returns an error value that is not temporary
+// nor a timeout, suitable for making the caller think the
+// listener is actually closed.
+func fakeClosedErr(addr net.Addr) error {
+	return &net.OpError{
+		Op:   "accept",
+		Net:  addr.Network(),
+		Addr: addr,
+		Err:  errFakeClosed,
+	}
+}
+
+// errFakeClosed is the underlying error value returned by
+// fakeCloseListener.Accept() after Close() has been called,
+// indicating that it is pretending to be closed so that the
+// server using it can terminate, while the underlying
+// socket is actually left open. It wraps net.ErrClosed.
+var errFakeClosed = fmt.Errorf("listener 'closed' 😉: %w", net.ErrClosed)
+
+var (
+	// listenerPool stores the sockets that are currently open,
+	// so they can be shared across config reloads.
+	listenerPool = NewUsagePool()
+
+	// inheritedFiles keeps the descriptors passed in by the
+	// parent process open, keyed by descriptor number.
+	inheritedFiles   = make(map[int]*os.File)
+	inheritedFilesMu sync.Mutex
+)
@@ -0,0 +1,168 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 k2 <skrik2@outlook.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseNetworkAddress(t *testing.T) {
+	for i, tc := range []struct {
+		input     string
+		expect    NetworkAddress
+		expectErr bool
+	}{
+		{input: ":", expect: NetworkAddress{Network: "tcp"}},
+		{input: "[::]", expect: NetworkAddress{Network: "tcp", Host: "::"}},
+		{input: "localhost", expect: NetworkAddress{Network: "tcp", Host: "localhost"}},
+		{input: "localhost:1234", expect: NetworkAddress{Network: "tcp", Host: "localhost", StartPort: 1234, EndPort: 1234}},
+		{input: "localhost:1234-1234", expect: NetworkAddress{Network: "tcp", Host: "localhost", StartPort: 1234, EndPort: 1234}},
+		{input: "localhost:2-1", expectErr: true},
+		{input: "localhost:0", expect: NetworkAddress{Network: "tcp", Host: "localhost"}},
+		{input: "localhost:1-999999999999", expectErr: true},
+		{input: "udp/localhost:1-2", expect: NetworkAddress{Network: "udp", Host: "localhost", StartPort: 1, EndPort: 2}},
+		{input: "tcp6/[::1]:80", expect: NetworkAddress{Network: "tcp6", Host: "::1", StartPort: 80, EndPort: 80}},
+		{input: "unix//foo/bar", expect: NetworkAddress{Network: "unix", Host: "/foo/bar"}},
+		{input: "unixgram//foo/bar", expect: NetworkAddress{Network: "unixgram", Host: "/foo/bar"}},
+		{input: "unix/", expectErr: true},
+		{input: "fd/3", expect: NetworkAddress{Network: "fd", Host: "3"}},
+		{input: "fdgram/http", expect: NetworkAddress{Network: "fdgram", Host: "http"}},
+	} {
+		actual, err := ParseNetworkAddress(tc.input)
+		if tc.expectErr && err == nil {
+			t.Errorf("Test %d (%q): expected error, got %+v", i, tc.input, actual)
+			continue
+		}
+		if !tc.expectErr && err != nil {
+			t.Errorf("Test %d (%q): unexpected error: %v", i, tc.input, err)
+			continue
+		}
+		if !tc.expectErr && !reflect.DeepEqual(tc.expect, actual) {
+			t.Errorf("Test %d (%q): expected %+v, got %+v", i, tc.input, tc.expect, actual)
+		}
+	}
+}
+
+func TestListenAllPortRange(t *testing.T) {
+	// find two free adjacent ports
+	var na NetworkAddress
+	var lns []any
+	var err error
+	for range 10 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := uint(ln.Addr().(*net.TCPAddr).Port)
+		ln.Close()
+		na, err = ParseNetworkAddress("127.0.0.1:" + strconv.Itoa(int(port)) + "-" + strconv.Itoa(int(port+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lns, err = na.ListenAll(context.Background(), net.ListenConfig{}); err == nil {
+			break
+		}
+	}
+	if err != nil || len(lns) != 2 {
+		t.Fatalf("expected 2 listeners, got %d: %v", len(lns), err)
+	}
+	for i, ln := range lns {
+		if got := uint(ln.(net.Listener).Addr().(*net.TCPAddr).Port); got != na.StartPort+uint(i) {
+			t.Errorf("listener %d: expected port %d, got %d", i, na.StartPort+uint(i), got)
+		}
+		ln.(net.Listener).Close()
+	}
+	if _, ok := listenerPool.References(listenerKey("tcp", na.JoinHostPort(0))); ok {
+		t.Error("expected socket to be released after closing all listeners")
+	}
+}
+
+func TestListenShared(t *testing.T) {
+	na, err := ParseNetworkAddress("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln1, err := na.Listen(context.Background(), 0, net.ListenConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// simulate a reload: the new config opens the same address
+	// before the old one closes its listener
+	ln2, err := na.Listen(context.Background(), 0, net.ListenConfig{})
+	if err != nil {
+		t.Fatalf("expected socket to be shared: %v", err)
+	}
+	addr := ln1.(net.Listener).Addr().String()
+	if addr != ln2.(net.Listener).Addr().String() {
+		t.Fatalf("expected same socket, got %s and %s", addr, ln2.(net.Listener).Addr())
+	}
+
+	ln1.(net.Listener).Close()
+	if _, err := ln1.(net.Listener).Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected closed listener to stop accepting, got %v", err)
+	}
+
+	// the socket must still accept connections for the other user
+	go func() {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := ln2.(net.Listener).Accept()
+	if err != nil {
+		t.Fatalf("expected shared socket to stay open: %v", err)
+	}
+	conn.Close()
+
+	ln2.(net.Listener).Close()
+	if _, ok := listenerPool.References(listenerKey("tcp", "127.0.0.1:0")); ok {
+		t.Error("expected socket to be released after last close")
+	}
+}
+
+func TestSystemdListenFds(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "3")
+	t.Setenv("LISTEN_FDNAMES", "http::admin")
+
+	names, err := SystemdListenFds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"http", "unknown", "admin"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("expected %v, got %v", expect, names)
+	}
+	fd, err := getFdByName("admin")
+	if err != nil || fd != listenFdsStart+2 {
+		t.Errorf("expected fd %d, got %d (%v)", listenFdsStart+2, fd, err)
+	}
+	if _, err := getFdByName("dns"); err == nil {
+		t.Error("expected error for unknown socket name")
+	}
+
+	// sockets passed to another process are not ours
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	if names, _ := SystemdListenFds(); names != nil {
+		t.Errorf("expected no sockets for other process, got %v", names)
+	}
+}
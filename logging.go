@@ -1,10 +1,15 @@
 package uni
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -48,7 +53,9 @@ type Logging struct {
 	// from Go's standard library logger. These logs are common
 	// in dependencies that are not designed specifically for use
 	// in Caddy. Because it is global and unstructured, the sink
-	// lacks most advanced features and customizations.
+	// lacks most advanced features and customizations. The sink
+	// also receives the structured entries that none of the
+	// logs accept, so that they are not lost.
 	Sink *SinkLog `json:"sink,omitempty"`
 
 	// 对日志的自定义
@@ -64,6 +71,15 @@ type Logging struct {
 	// must have their keys added to this list so they
 	// can be closed when cleaning up
 	writerKeys []string
+
+	// the ring log cores of the logs, by log name
+	rings map[string]*RingLog
+
+	// the default logger this config replaced, and
+	// whether its logs were closed; guarded by
+	// defaultLoggerMu
+	prevDefault *defaultCustomLog
+	closed      bool
 }
 
 // SinkLog configures the default Go standard library
@@ -101,14 +117,14 @@ type CustomLog struct {
 // BaseLog contains the common logging parameters for logging.
 type BaseLog struct {
 	// The module that writes out log entries for the sink.
-	WriterRaw json.RawMessage `json:"writer,omitempty" caddy:"namespace=caddy.logging.writers inline_key=output"`
+	WriterRaw json.RawMessage `json:"writer,omitempty" caddy:"namespace=uni.logging.writers inline_key=output"`
 
 	// The encoder is how the log entries are formatted or encoded.
-	EncoderRaw json.RawMessage `json:"encoder,omitempty" caddy:"namespace=caddy.logging.encoders inline_key=format"`
+	EncoderRaw json.RawMessage `json:"encoder,omitempty" caddy:"namespace=uni.logging.encoders inline_key=format"`
 
 	// Tees entries through a zap.Core module which can extract
 	// log entry metadata and fields for further processing.
-	CoreRaw json.RawMessage `json:"core,omitempty" caddy:"namespace=caddy.logging.cores inline_key=module"`
+	CoreRaw json.RawMessage `json:"core,omitempty" caddy:"namespace=uni.logging.cores inline_key=module"`
 
 	// 大于此等级的Log才被记录
 	// Level is the minimum level to emit, and is inclusive.
@@ -144,6 +160,506 @@ type BaseLog struct {
 	encoder      zapcore.Encoder
 	levelEnabler zapcore.LevelEnabler
 	core         zapcore.Core
+	coreModule   zapcore.Core
+}
+
+// openLogs sets up the config and opens all the configured writers.
+// It closes its logs when ctx is canceled, so it should clean up
+// after itself.
+func (logging *Logging) openLogs(ctx Context) error {
+	// make sure to deallocate resources when context is done
+	ctx.OnCancel(func() {
+		err := logging.closeLogs()
+		if err != nil {
+			Log().Error("closing logs", zap.Error(err))
+		}
+	})
+
+	// set up the "sink" log first (std lib's default global logger)
+	if logging.Sink != nil {
+		err := logging.Sink.provision(ctx, logging)
+		if err != nil {
+			return fmt.Errorf("setting up sink log: %v", err)
+		}
+	}
+
+	// then set up the custom logs
+	for name, l := range logging.Logs {
+		// the default log is set up below
+		if name == DefaultLoggerName {
+			continue
+		}
+
+		err := l.provision(ctx, logging)
+		if err != nil {
+			return fmt.Errorf("setting up custom log '%s': %v", name, err)
+		}
+
+		// Any other logs that use the discard writer and no core module
+		// can be deleted entirely. This avoids encoding and processing of each
+		// log entry that would just be thrown away anyway. Notably,
+		// we do not reach this point for the default log, which MUST
+		// exist, otherwise core log emissions would panic because
+		// they use the Log() function directly which expects a non-nil
+		// logger.
+		if _, ok := l.writerOpener.(*DiscardWriter); ok && l.coreModule == nil {
+			delete(logging.Logs, name)
+			continue
+		}
+		logging.addRing(name, l)
+	}
+
+	// as a special case, set up the default structured log last,
+	// so that the entries of its named loggers can be routed to
+	// the other logs
+	return logging.setupNewDefault(ctx)
+}
+
+// setupNewDefault provisions the log named "default", or the
+// production default if the config does not define one, and
+// makes it the default logger returned by Log().
+func (logging *Logging) setupNewDefault(ctx Context) error {
+	if logging.Logs == nil {
+		logging.Logs = make(map[string]*CustomLog)
+	}
+
+	// extract the user-defined default log, if any
+	newDefault := new(defaultCustomLog)
+	if userDefault, ok := logging.Logs[DefaultLoggerName]; ok {
+		newDefault.CustomLog = userDefault
+	} else {
+		// if none, make one with our own default settings
+		var err error
+		newDefault, err = newDefaultProductionLog()
+		if err != nil {
+			return fmt.Errorf("setting up default log: %v", err)
+		}
+		logging.Logs[DefaultLoggerName] = newDefault.CustomLog
+	}
+	newDefault.logging = logging
+
+	// options for the default logger
+	options, err := newDefault.CustomLog.buildOptions()
+	if err != nil {
+		return fmt.Errorf("setting up default log: %v", err)
+	}
+
+	// set up this new log
+	err = newDefault.CustomLog.provision(ctx, logging)
+	if err != nil {
+		return fmt.Errorf("setting up default log: %v", err)
+	}
+	logging.addRing(DefaultLoggerName, newDefault.CustomLog)
+	newDefault.logger = zap.New(logging.routedCore(newDefault.CustomLog), options...)
+
+	// redirect the default logs
+	defaultLoggerMu.Lock()
+	oldDefault := defaultLogger
+	defaultLogger = newDefault
+	logging.prevDefault = oldDefault
+	defaultLoggerMu.Unlock()
+
+	// if the new writer is different, indicate it in the logs for convenience
+	var newDefaultLogWriterKey, currentDefaultLogWriterKey string
+	var newDefaultLogWriterStr, currentDefaultLogWriterStr string
+	if newDefault.writerOpener != nil {
+		newDefaultLogWriterKey = newDefault.writerOpener.WriterKey()
+		newDefaultLogWriterStr = newDefault.writerOpener.String()
+	}
+	if oldDefault.writerOpener != nil {
+		currentDefaultLogWriterKey = oldDefault.writerOpener.WriterKey()
+		currentDefaultLogWriterStr = oldDefault.writerOpener.String()
+	}
+	if newDefaultLogWriterKey != currentDefaultLogWriterKey {
+		oldDefault.logger.Info("redirected default logger",
+			zap.String("from", currentDefaultLogWriterStr),
+			zap.String("to", newDefaultLogWriterStr),
+		)
+	}
+
+	return nil
+}
+
+// closeLogs cleans up resources allocated during openLogs.
+// A successful call to openLogs calls this automatically
+// when the context is canceled. If the default logger is
+// still the one of this config, as when the config failed
+// to load or was stopped, the previous default logger is
+// reinstated if its writers are still open, or else one
+// that writes to stderr.
+func (logging *Logging) closeLogs() error {
+	defaultLoggerMu.Lock()
+	logging.closed = true
+	if defaultLogger.logging == logging {
+		prev := logging.prevDefault
+		if prev == nil || (prev.logging != nil && prev.logging.closed) {
+			var err error
+			prev, err = newDefaultProductionLog()
+			if err != nil {
+				defaultLoggerMu.Unlock()
+				return err
+			}
+		}
+		defaultLogger = prev
+	}
+	defaultLoggerMu.Unlock()
+
+	for _, key := range logging.writerKeys {
+		_, err := writers.Delete(key)
+		if err != nil {
+			log.Printf("[ERROR] Closing log writer %v: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// Logger returns a logger that is ready for the module to use.
+// It is named after the module's ID and writes each entry to
+// the custom logs that accept the name of its logger, and to
+// the sink, if configured, if no custom log accepts it.
+func (logging *Logging) Logger(mod Module) *zap.Logger {
+	modID := string(mod.UniModule().ID)
+	if logging == nil {
+		return Log().Named(modID)
+	}
+
+	var cores []zapcore.Core
+	var options []zap.Option
+	for _, l := range logging.Logs {
+		if !l.matchesModule(modID) {
+			continue
+		}
+		if len(options) == 0 {
+			newOptions, err := l.buildOptions()
+			if err != nil {
+				Log().Error("building options for logger", zap.String("module", modID), zap.Error(err))
+			}
+			options = newOptions
+		}
+		if len(l.Include) == 0 && len(l.Exclude) == 0 {
+			cores = append(cores, l.core)
+			continue
+		}
+		cores = append(cores, &filteringCore{Core: l.core, cl: l})
+	}
+	if logging.Sink != nil && logging.Sink.core != nil {
+		cores = append(cores, &sinkCore{Core: logging.Sink.core, logging: logging})
+	}
+
+	return zap.New(zapcore.NewTee(cores...), options...).Named(modID)
+}
+
+// routedCore returns the core of the default log cl so that
+// entries of named loggers derived from the default logger,
+// like Log().Named("admin"), are routed just like the ones of
+// module loggers: to each custom log that accepts them, or to
+// the sink if none does.
+func (logging *Logging) routedCore(cl *CustomLog) zapcore.Core {
+	cores := []zapcore.Core{&filteringCore{Core: cl.core, cl: cl}}
+	for name, l := range logging.Logs {
+		if name == DefaultLoggerName || l.core == nil {
+			continue
+		}
+		cores = append(cores, &filteringCore{Core: l.core, cl: l})
+	}
+	if logging.Sink != nil && logging.Sink.core != nil {
+		cores = append(cores, &sinkCore{Core: logging.Sink.core, logging: logging})
+	}
+	return zapcore.NewTee(cores...)
+}
+
+// openWriter opens a writer using opener, and returns true if
+// the writer is new, or false if the writer already exists.
+func (logging *Logging) openWriter(opener WriterOpener) (io.WriteCloser, bool, error) {
+	key := opener.WriterKey()
+	writer, loaded, err := writers.LoadOrNew(key, func() (Destructor, error) {
+		w, err := opener.OpenWriter()
+		return writerDestructor{w}, err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	logging.writerKeys = append(logging.writerKeys, key)
+	return writer.(io.WriteCloser), !loaded, nil
+}
+
+// accepted returns true if any custom log accepts
+// entries of the logger with the given name.
+func (logging *Logging) accepted(name string) bool {
+	for _, l := range logging.Logs {
+		if l.loggerAllowed(name, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sl *SinkLog) provision(ctx Context, logging *Logging) error {
+	if err := sl.provisionCommon(ctx, logging); err != nil {
+		return err
+	}
+
+	options, err := sl.buildOptions()
+	if err != nil {
+		return err
+	}
+
+	logger := zap.New(sl.core, options...)
+	ctx.OnCancel(zap.RedirectStdLog(logger))
+	return nil
+}
+
+func (cl *CustomLog) provision(ctx Context, logging *Logging) error {
+	if err := cl.provisionCommon(ctx, logging); err != nil {
+		return err
+	}
+
+	// If both Include and Exclude lists are populated, then each item must
+	// be a superspace or subspace of an item in the other list, because
+	// populating both lists means that any given item is either a rule
+	// or an exception to another rule. But if the item is not a super-
+	// or sub-space of any item in the other list, it is neither a rule
+	// nor an exception, and is a contradiction. Ensure, too, that the
+	// sets do not intersect, which is also a contradiction.
+	if len(cl.Include) > 0 && len(cl.Exclude) > 0 {
+		// prevent intersections
+		for _, allow := range cl.Include {
+			if slices.Contains(cl.Exclude, allow) {
+				return fmt.Errorf("include and exclude must not intersect, but found %s in both lists", allow)
+			}
+		}
+
+		// ensure namespaces are nested
+	outer:
+		for _, allow := range cl.Include {
+			for _, deny := range cl.Exclude {
+				if strings.HasPrefix(allow+".", deny+".") ||
+					strings.HasPrefix(deny+".", allow+".") {
+					continue outer
+				}
+			}
+			return fmt.Errorf("when both include and exclude are populated, each element must be a superspace or subspace of one in the other list; check '%s' in include", allow)
+		}
+	}
+
+	return nil
+}
+
+// matchesModule returns true if any of the
+// loggers of the module may emit to cl.
+func (cl *CustomLog) matchesModule(moduleID string) bool {
+	return cl.loggerAllowed(moduleID, true)
+}
+
+// loggerAllowed returns true if name is allowed to emit
+// to cl. isModule should be true if name is the name of
+// a module and you want to see if ANY of that module's
+// logs would be permitted.
+func (cl *CustomLog) loggerAllowed(name string, isModule bool) bool {
+	// accept all loggers by default
+	if len(cl.Include) == 0 && len(cl.Exclude) == 0 {
+		return true
+	}
+
+	// append a dot so that partial names don't match
+	// (i.e. we don't want "foo.b" to match "foo.bar"); we
+	// will also have to append a dot when we do HasPrefix
+	// below to compensate for when namespaces are equal
+	if name != "" && name != "*" && name != "." {
+		name += "."
+	}
+
+	var longestAccept, longestReject int
+
+	if len(cl.Include) > 0 {
+		for _, namespace := range cl.Include {
+			var hasPrefix bool
+			if isModule {
+				hasPrefix = strings.HasPrefix(namespace+".", name) ||
+					strings.HasPrefix(name, namespace+".")
+			} else {
+				hasPrefix = strings.HasPrefix(name, namespace+".")
+			}
+			if hasPrefix && len(namespace) > longestAccept {
+				longestAccept = len(namespace)
+			}
+		}
+		// the include list was populated, meaning that
+		// a match in this list is absolutely required
+		// if we are to accept the entry
+		if longestAccept == 0 {
+			return false
+		}
+	}
+
+	if len(cl.Exclude) > 0 {
+		for _, namespace := range cl.Exclude {
+			// * == all logs emitted by modules
+			// . == all logs emitted by core
+			if (namespace == "*" && name != ".") ||
+				(namespace == "." && name == ".") {
+				return false
+			}
+			if strings.HasPrefix(name, namespace+".") &&
+				len(namespace) > longestReject {
+				longestReject = len(namespace)
+			}
+		}
+		// the reject list is populated, so we have to
+		// reject this entry if its match is better
+		// than the best from the accept list
+		if longestReject > longestAccept {
+			return false
+		}
+	}
+
+	return (longestAccept > longestReject) ||
+		(len(cl.Include) == 0 && longestReject == 0)
+}
+
+// filteringCore filters log entries based on logger name,
+// according to the rules of a CustomLog.
+type filteringCore struct {
+	zapcore.Core
+	cl *CustomLog
+}
+
+// With properly wraps With.
+func (fc *filteringCore) With(fields []zapcore.Field) zapcore.Core {
+	return &filteringCore{
+		Core: fc.Core.With(fields),
+		cl:   fc.cl,
+	}
+}
+
+// Check only allows the log entry if its logger name
+// is allowed from the include/exclude rules of fc.cl.
+func (fc *filteringCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if fc.cl.loggerAllowed(e.LoggerName, false) {
+		return fc.Core.Check(e, ce)
+	}
+	return ce
+}
+
+// sinkCore passes the log entries that no custom
+// log accepts on to the core of the sink.
+type sinkCore struct {
+	zapcore.Core
+	logging *Logging
+}
+
+// With properly wraps With.
+func (sc *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sinkCore{
+		Core:    sc.Core.With(fields),
+		logging: sc.logging,
+	}
+}
+
+// Check only allows the log entry if no custom log
+// accepts entries of its logger.
+func (sc *sinkCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if sc.logging.accepted(e.LoggerName) {
+		return ce
+	}
+	return sc.Core.Check(e, ce)
+}
+
+func (cl *BaseLog) provisionCommon(ctx Context, logging *Logging) error {
+	if cl.WriterRaw != nil {
+		mod, err := ctx.LoadModule(cl, "WriterRaw")
+		if err != nil {
+			return fmt.Errorf("loading log writer module: %v", err)
+		}
+		cl.writerOpener = mod.(WriterOpener)
+	}
+	if cl.writerOpener == nil {
+		cl.writerOpener = StderrWriter{}
+	}
+	var err error
+	cl.writer, _, err = logging.openWriter(cl.writerOpener)
+	if err != nil {
+		return fmt.Errorf("opening log writer using %#v: %v", cl.writerOpener, err)
+	}
+
+	repl := NewReplacer()
+	level, err := repl.ReplaceOrErr(cl.Level, true, true)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %v", err)
+	}
+
+	// set up the log level
+	cl.levelEnabler, err = parseLevel(strings.ToLower(level))
+	if err != nil {
+		return err
+	}
+
+	if cl.EncoderRaw != nil {
+		// tell the encoder where it writes to, so it can
+		// e.g. color the levels only on a terminal
+		encCtx := ctx
+		if encCtx.Context == nil {
+			encCtx.Context = context.Background()
+		}
+		encCtx.Context = context.WithValue(encCtx.Context, LogWriterCtxKey, cl.writerOpener)
+		mod, err := encCtx.LoadModule(cl, "EncoderRaw")
+		if err != nil {
+			return fmt.Errorf("loading log encoder module: %v", err)
+		}
+		cl.encoder = mod.(zapcore.Encoder)
+	}
+	if cl.encoder == nil {
+		cl.encoder = newDefaultProductionLogEncoder(cl.writerOpener)
+	}
+	cl.buildCore()
+	if cl.CoreRaw != nil {
+		mod, err := ctx.LoadModule(cl, "CoreRaw")
+		if err != nil {
+			return fmt.Errorf("loading log core module: %v", err)
+		}
+		core := mod.(zapcore.Core)
+		cl.coreModule = core
+		cl.core = zapcore.NewTee(cl.core, core)
+	}
+	return nil
+}
+
+func (cl *BaseLog) buildOptions() ([]zap.Option, error) {
+	var options []zap.Option
+	if cl.WithCaller {
+		options = append(options, zap.AddCaller())
+		if cl.WithCallerSkip != 0 {
+			options = append(options, zap.AddCallerSkip(cl.WithCallerSkip))
+		}
+	}
+	if cl.WithStacktrace != "" {
+		levelEnabler, err := parseLevel(strings.ToLower(cl.WithStacktrace))
+		if err != nil {
+			return options, fmt.Errorf("setting up stacktrace: %v", err)
+		}
+		options = append(options, zap.AddStacktrace(levelEnabler))
+	}
+	return options, nil
+}
+
+// parseLevel returns the level enabler of a lowercase level name.
+func parseLevel(level string) (zapcore.LevelEnabler, error) {
+	switch level {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "", "info":
+		return zapcore.InfoLevel, nil
+	case "warn":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	case "panic":
+		return zapcore.PanicLevel, nil
+	case "fatal":
+		return zapcore.FatalLevel, nil
+	default:
+		return nil, fmt.Errorf("unrecognized log level: %s", level)
+	}
 }
 
 func (cl *BaseLog) buildCore() {
@@ -187,6 +703,33 @@ type WriterOpener interface {
 	OpenWriter() (io.WriteCloser, error)
 }
 
+// WriterReopener is implemented by log writers that can
+// reopen the file they write to, so that logs can be rotated
+// by external tools (like logrotate), which move the file
+// away and then signal the process to reopen it.
+type WriterReopener interface {
+	Reopen() error
+}
+
+// ReopenLogs reopens all open log writers that support it;
+// see WriterReopener. It is called on SIGUSR1.
+func ReopenLogs() error {
+	var errs []error
+	writers.Range(func(key, value any) bool {
+		if r, ok := value.(writerDestructor).WriteCloser.(WriterReopener); ok {
+			if err := r.Reopen(); err != nil {
+				errs = append(errs, fmt.Errorf("%v: %v", key, err))
+			}
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// LogWriterCtxKey is the context key of the WriterOpener of the
+// log whose encoder is being provisioned.
+const LogWriterCtxKey CtxKey = "log_writer"
+
 // IsWriterStandardStream returns true if the input is a
 // writer-opener to a standard stream (stdout, stderr).
 func IsWriterStandardStream(wo WriterOpener) bool {
@@ -214,7 +757,7 @@ type LogSampling struct {
 	Thereafter int `json:"thereafter,omitempty"`
 }
 
-// Log represents the log data format.
+// LogEntry represents the log data format. See Write.
 type LogEntry struct {
 	Time     string   `json:"ts"`       // Timestamp of the log entry
 	Level    string   `json:"level"`    // Log level (e.g., Trace, Debug, Info, Warning, Error, Fataland Panic)
@@ -232,6 +775,76 @@ type Extra interface {
 	ExtraToString() (string, error)
 }
 
+// Write writes the entry to logger. The level is one of trace,
+// debug, info, warn (or warning), error, fatal and panic; trace
+// is written at the debug level, and an empty level at info.
+// The entry is timestamped with Time if it is set, in RFC 3339
+// format. Category and Tags are written as fields; so is Extra,
+// inline if it is a zapcore.ObjectMarshaler, or else as the
+// string field "extra".
+func (e LogEntry) Write(logger *zap.Logger) error {
+	var level zapcore.Level
+	switch strings.ToLower(e.Level) {
+	case "trace", "debug":
+		level = zapcore.DebugLevel
+	case "", "info":
+		level = zapcore.InfoLevel
+	case "warn", "warning":
+		level = zapcore.WarnLevel
+	case "error":
+		level = zapcore.ErrorLevel
+	case "fatal":
+		level = zapcore.FatalLevel
+	case "panic":
+		level = zapcore.PanicLevel
+	default:
+		return fmt.Errorf("unrecognized log level: %s", e.Level)
+	}
+	if e.Time != "" {
+		ts, err := time.Parse(time.RFC3339Nano, e.Time)
+		if err != nil {
+			return fmt.Errorf("invalid log entry time: %v", err)
+		}
+		logger = logger.WithOptions(zap.WithClock(fixedClock(ts)))
+	}
+
+	ce := logger.Check(level, "")
+	if ce == nil {
+		return nil
+	}
+	if e.Msg != nil {
+		msg, err := e.Msg.MsgToString()
+		if err != nil {
+			return fmt.Errorf("log entry message: %v", err)
+		}
+		ce.Message = msg
+	}
+	fields := make([]zap.Field, 0, 3)
+	if e.Category != "" {
+		fields = append(fields, zap.String("category", e.Category))
+	}
+	if len(e.Tags) > 0 {
+		fields = append(fields, zap.Strings("tags", e.Tags))
+	}
+	if om, ok := e.Extra.(zapcore.ObjectMarshaler); ok {
+		fields = append(fields, zap.Inline(om))
+	} else if e.Extra != nil {
+		extra, err := e.Extra.ExtraToString()
+		if err != nil {
+			return fmt.Errorf("log entry extra: %v", err)
+		}
+		fields = append(fields, zap.String("extra", extra))
+	}
+	ce.Write(fields...)
+	return nil
+}
+
+// fixedClock is a zapcore.Clock that is always at the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time                         { return time.Time(c) }
+func (c fixedClock) NewTicker(d time.Duration) *time.Ticker { return time.NewTicker(d) }
+
 type (
 	// StdoutWriter writes logs to standard out.
 	StdoutWriter struct{}
@@ -297,14 +910,30 @@ func (DiscardWriter) OpenWriter() (io.WriteCloser, error) {
 	return notClosable{io.Discard}, nil
 }
 
+// writerDestructor wraps an io.WriteCloser
+// so it can be stored in the writers pool.
+type writerDestructor struct {
+	io.WriteCloser
+}
+
+func (wdest writerDestructor) Destruct() error {
+	return wdest.Close()
+}
+
 // notClosable is an io.WriteCloser that can't be closed.
 type notClosable struct{ io.Writer }
 
 func (fc notClosable) Close() error { return nil }
 
+// DefaultLoggerName is the name of the default log.
+const DefaultLoggerName = "default"
+
 type defaultCustomLog struct {
 	*CustomLog
 	logger *zap.Logger
+
+	// the logging config the log belongs to, if any
+	logging *Logging
 }
 
 // newDefaultProductionLog configures a custom log that is
@@ -372,7 +1001,26 @@ func BufferedLog() (*zap.Logger, *zap.Logger, *internal.LogBufferCore) {
 	return defaultLogger.logger, origLogger, bufferCore
 }
 
+// FlushBufferedLog ends the early-startup buffering begun by
+// BufferedLog. If the default logger is still the buffered
+// one (i.e. no config has installed its own logs since),
+// orig is reinstated as the default; then the buffered
+// entries are written to the current default logger.
+func FlushBufferedLog(buffered, orig *zap.Logger, buffer *internal.LogBufferCore) {
+	defaultLoggerMu.Lock()
+	if defaultLogger.logger == buffered {
+		defaultLogger.logger = orig
+	}
+	current := defaultLogger.logger
+	defaultLoggerMu.Unlock()
+	buffer.FlushTo(current)
+}
+
 var (
+	// writers is the pool of open log writers, keyed by
+	// WriterKey, so they can be shared between configs.
+	writers = NewUsagePool()
+
 	defaultLoggerMu  sync.RWMutex
 	defaultLogger, _ = newDefaultProductionLog()
 	coloringEnabled  = os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "xterm-mono"
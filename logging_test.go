@@ -0,0 +1,180 @@
+package uni
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func init() {
+	RegisterModule(testMemoryWriter{})
+	RegisterModule(testLogApp{})
+}
+
+// testLogs holds what testMemoryWriters wrote, by name.
+var (
+	testLogs   = make(map[string]*strings.Builder)
+	testLogsMu sync.Mutex
+)
+
+// testLogged returns what was written to the test log name.
+func testLogged(name string) string {
+	testLogsMu.Lock()
+	defer testLogsMu.Unlock()
+	if b, ok := testLogs[name]; ok {
+		return b.String()
+	}
+	return ""
+}
+
+// testMemoryWriter writes logs to testLogs.
+type testMemoryWriter struct {
+	Name string `json:"name"`
+}
+
+func (testMemoryWriter) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "uni.logging.writers.test_memory",
+		New: func() Module { return new(testMemoryWriter) },
+	}
+}
+
+func (w testMemoryWriter) String() string    { return "memory:" + w.Name }
+func (w testMemoryWriter) WriterKey() string { return "test_memory:" + w.Name }
+
+func (w testMemoryWriter) OpenWriter() (io.WriteCloser, error) {
+	return notClosable{testLogWriter(w.Name)}, nil
+}
+
+type testLogWriter string
+
+func (name testLogWriter) Write(p []byte) (int, error) {
+	testLogsMu.Lock()
+	defer testLogsMu.Unlock()
+	b, ok := testLogs[string(name)]
+	if !ok {
+		b = new(strings.Builder)
+		testLogs[string(name)] = b
+	}
+	return b.Write(p)
+}
+
+// testLogApp logs with the logger of its context.
+type testLogApp struct{}
+
+func (testLogApp) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "test_log_app",
+		New: func() Module { return new(testLogApp) },
+	}
+}
+
+func (*testLogApp) Provision(ctx Context) error {
+	logger := ctx.Logger()
+	logger.Info("provisioning")
+	logger.Named("query").Info("query example.com")
+	logger.Named("misc").Info("nobody wants this")
+	return nil
+}
+
+func (*testLogApp) Start() error { return nil }
+func (*testLogApp) Stop() error  { return nil }
+
+func TestLogRouting(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	err := Load([]byte(`{
+		"admin": {"disabled": true},
+		"logging": {
+			"sink": {"writer": {"output": "test_memory", "name": "sink"}},
+			"logs": {
+				"default": {
+					"writer": {"output": "test_memory", "name": "default"},
+					"exclude": ["admin", "test_log_app.query", "test_log_app.misc"]
+				},
+				"dns": {
+					"writer": {"output": "test_memory", "name": "dns"},
+					"include": ["test_log_app.query"]
+				},
+				"admin": {
+					"writer": {"output": "test_memory", "name": "admin"},
+					"include": ["admin"]
+				}
+			}
+		},
+		"apps": {"test_log_app": {}}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Log().Named("admin.api").Info("admin request")
+	Log().Info("core message")
+
+	for _, tc := range []struct {
+		log      string
+		expect   []string
+		unexpect []string
+	}{
+		{log: "default", expect: []string{"provisioning", "core message"}, unexpect: []string{"example.com", "admin request", "nobody"}},
+		{log: "dns", expect: []string{`"logger":"test_log_app.query"`, "query example.com"}, unexpect: []string{"provisioning", "admin request"}},
+		{log: "admin", expect: []string{"admin request"}, unexpect: []string{"provisioning", "example.com"}},
+		{log: "sink", expect: []string{"nobody wants this"}, unexpect: []string{"provisioning", "example.com", "admin request"}},
+	} {
+		logged := testLogged(tc.log)
+		for _, s := range tc.expect {
+			if !strings.Contains(logged, s) {
+				t.Errorf("expected log %s to contain %q, got: %s", tc.log, s, logged)
+			}
+		}
+		for _, s := range tc.unexpect {
+			if strings.Contains(logged, s) {
+				t.Errorf("expected log %s not to contain %q, got: %s", tc.log, s, logged)
+			}
+		}
+	}
+
+	// once stopped, the logs of the config are no longer used
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+	Log().Info("after stop")
+	if logged := testLogged("default"); strings.Contains(logged, "after stop") {
+		t.Errorf("expected default log to be replaced when stopped, got: %s", logged)
+	}
+}
+
+func TestLogIncludeExcludeContradiction(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	err := Load([]byte(`{
+		"admin": {"disabled": true},
+		"logging": {"logs": {"dns": {
+			"writer": {"output": "discard"},
+			"include": ["kdns.query"],
+			"exclude": ["router"]
+		}}}
+	}`), false)
+	if err == nil || !strings.Contains(err.Error(), "superspace or subspace") {
+		t.Fatalf("expected contradiction error, got: %v", err)
+	}
+}
+
+func TestCustomLogLoggerAllowed(t *testing.T) {
+	cl := &CustomLog{Include: []string{"kdns"}, Exclude: []string{"kdns.query"}}
+	for name, expect := range map[string]bool{
+		"kdns":           true,
+		"kdns.cache":     true,
+		"kdns.query":     false,
+		"kdns.query.udp": false,
+		"kdnsx":          false,
+		"admin":          false,
+	} {
+		if actual := cl.loggerAllowed(name, false); actual != expect {
+			t.Errorf("loggerAllowed(%q): expected %t, got %t", name, expect, actual)
+		}
+	}
+	if !cl.matchesModule("kdns.resolvers.doh") {
+		t.Error("expected submodule of an included namespace to match")
+	}
+}
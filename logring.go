@@ -0,0 +1,301 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"uni/internal"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	RegisterModule(RingLog{})
+}
+
+// RingLog is a log core that keeps the last entries of the
+// log it is configured for in memory, so that they can be
+// inspected through the admin API without access to where
+// the log is written, e.g.:
+//
+//	"logs": {"rules": {"include": ["router"], "core": {"module": "ring"}}}
+//
+// The entries that pass the level of the log are kept.
+//
+// The admin API serves the kept entries at GET /logs/<name>,
+// where name is the name of the log, and streams new entries
+// at GET /logs/<name>/stream, as JSON lines over a chunked
+// response (the admin endpoint refuses WebSocket upgrades);
+// the stream ends when the config is unloaded. Both
+// accept these query parameters to filter the entries:
+//
+// Parameter | Description
+// ----------|------------
+// `level` | The minimum level, e.g. `warn`
+// `logger` | A logger name; entries of it and of the loggers named after it match. May be repeated
+// `field` | `key=value`; the field must have the value. `>` selects fields of nested objects. May be repeated
+// `limit` | The number of most recent entries to return; for streams, to send before new entries. Default all; for streams, 0
+//
+// GET /logs/ lists the logs that keep entries.
+type RingLog struct {
+	*internal.LogRingCore `json:"-"`
+
+	// The number of entries to keep. Default: 1000
+	Size int `json:"size,omitempty"`
+}
+
+// UniModule returns the Uni module information.
+func (RingLog) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "uni.logging.cores.ring",
+		New: func() Module { return new(RingLog) },
+	}
+}
+
+// Provision sets up the ring.
+func (rl *RingLog) Provision(_ Context) error {
+	if rl.Size == 0 {
+		rl.Size = 1000
+	}
+	if rl.Size < 0 {
+		return fmt.Errorf("invalid ring size: %d", rl.Size)
+	}
+	rl.LogRingCore = internal.NewLogRingCore(rl.Size, zapcore.DebugLevel)
+	return nil
+}
+
+// Cleanup ends the streams of the ring.
+func (rl *RingLog) Cleanup() error {
+	return rl.Close()
+}
+
+// addRing makes the entries of the log named name available
+// through the admin API, if its core module is a ring.
+func (logging *Logging) addRing(name string, cl *CustomLog) {
+	rl, ok := cl.coreModule.(*RingLog)
+	if !ok {
+		return
+	}
+	// keep what the log would write
+	rl.SetLevel(cl.levelEnabler)
+	if logging.rings == nil {
+		logging.rings = make(map[string]*RingLog)
+	}
+	logging.rings[name] = rl
+}
+
+// ringLogFilter selects log entries.
+type ringLogFilter struct {
+	level   zapcore.Level
+	loggers []string
+	fields  map[string]string
+	limit   int
+}
+
+// parseRingLogFilter returns the filter of the query of r.
+func parseRingLogFilter(r *http.Request, defaultLimit int) (ringLogFilter, error) {
+	query := r.URL.Query()
+	filter := ringLogFilter{
+		level:   zapcore.DebugLevel,
+		loggers: query["logger"],
+		limit:   defaultLimit,
+	}
+	if level := query.Get("level"); level != "" {
+		if err := filter.level.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+			return filter, fmt.Errorf("invalid level: %v", err)
+		}
+	}
+	for _, field := range query["field"] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return filter, fmt.Errorf("invalid field filter %q; expected key=value", field)
+		}
+		if filter.fields == nil {
+			filter.fields = make(map[string]string)
+		}
+		filter.fields[key] = value
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("invalid limit: %s", limit)
+		}
+		filter.limit = n
+	}
+	return filter, nil
+}
+
+// match returns true if e passes the filter.
+func (f ringLogFilter) match(e internal.LogRingEntry) bool {
+	if e.Level < f.level {
+		return false
+	}
+	if len(f.loggers) > 0 && !slices.ContainsFunc(f.loggers, func(name string) bool {
+		return e.Logger == name || strings.HasPrefix(e.Logger, name+".")
+	}) {
+		return false
+	}
+	for key, expect := range f.fields {
+		var value any = e.Fields
+		for name := range strings.SplitSeq(key, ">") {
+			obj, ok := value.(map[string]any)
+			if !ok {
+				return false
+			}
+			if value, ok = obj[name]; !ok {
+				return false
+			}
+		}
+		if fmt.Sprint(value) != expect {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the entries that pass the filter,
+// up to its limit of the most recent ones.
+func (f ringLogFilter) apply(entries []internal.LogRingEntry) []internal.LogRingEntry {
+	matched := make([]internal.LogRingEntry, 0, len(entries))
+	for _, e := range entries {
+		if f.match(e) {
+			matched = append(matched, e)
+		}
+	}
+	if f.limit >= 0 && len(matched) > f.limit {
+		matched = matched[len(matched)-f.limit:]
+	}
+	return matched
+}
+
+// handleLogs serves the entries kept by the ring
+// log cores of the current config.
+func handleLogs(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	var rings map[string]*RingLog
+	if cfg := ActiveContext().cfg; cfg != nil && cfg.Logging != nil {
+		rings = cfg.Logging.rings
+	}
+
+	name, stream := strings.CutSuffix(strings.Trim(strings.TrimPrefix(r.URL.Path, "/logs"), "/"), "/stream")
+	if name == "" && !stream {
+		logs := make(map[string]any, len(rings))
+		for _, name := range slices.Sorted(maps.Keys(rings)) {
+			logs[name] = map[string]int{"size": rings[name].Size}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(logs)
+	}
+	ring, ok := rings[name]
+	if !ok {
+		return APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("log %q does not keep entries", name),
+		}
+	}
+
+	if stream {
+		return streamLogs(w, r, ring)
+	}
+	filter, err := parseRingLogFilter(r, -1)
+	if err != nil {
+		return APIError{HTTPStatus: http.StatusBadRequest, Err: err}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(filter.apply(ring.Entries()))
+}
+
+// ringLogStreamBuffer is the number of entries queued for
+// a stream; if the client does not keep up, it misses more.
+const ringLogStreamBuffer = 256
+
+// ringLogKeepAlive is how often an empty line is sent on an
+// idle stream, so that a client that went away is noticed.
+var ringLogKeepAlive = 30 * time.Second
+
+// streamLogs writes the entries of ring that pass the filter of
+// r to w, as JSON lines, until the client goes away, the ring
+// is closed, or the admin server shuts down.
+func streamLogs(w http.ResponseWriter, r *http.Request, ring *RingLog) error {
+	filter, err := parseRingLogFilter(r, 0)
+	if err != nil {
+		return APIError{HTTPStatus: http.StatusBadRequest, Err: err}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming not supported")
+	}
+
+	recent, entries, unsubscribe := ring.Subscribe(ringLogStreamBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	for _, e := range filter.apply(recent) {
+		if err := enc.Encode(e); err != nil {
+			return nil
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(ringLogKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-entries:
+			if !ok {
+				return nil
+			}
+			if !filter.match(e) {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return nil
+			}
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return nil
+			}
+		case <-r.Context().Done():
+			return nil
+		}
+		flusher.Flush()
+	}
+}
+
+// Interface guards
+var (
+	_ zapcore.Core = (*RingLog)(nil)
+	_ Provisioner  = (*RingLog)(nil)
+	_ CleanerUpper = (*RingLog)(nil)
+)
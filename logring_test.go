@@ -0,0 +1,142 @@
+package uni
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"uni/internal"
+
+	"go.uber.org/zap"
+)
+
+func TestRingLog(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	err := Load([]byte(`{
+		"admin": {"disabled": true},
+		"logging": {"logs": {"app": {
+			"writer": {"output": "discard"},
+			"core": {"module": "ring", "size": 2},
+			"include": ["test_log_app"]
+		}}},
+		"apps": {"test_log_app": {}}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := handleLogs(w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	get := func(path string) []internal.LogRingEntry {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var entries []internal.LogRingEntry
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return entries
+	}
+
+	// the ring keeps the last two of the three entries
+	entries := get("/logs/app")
+	if len(entries) != 2 || entries[0].Message != "query example.com" || entries[1].Message != "nobody wants this" {
+		t.Fatalf("expected the last two entries, got %+v", entries)
+	}
+	entries = get("/logs/app?logger=test_log_app.query")
+	if len(entries) != 1 || entries[0].Logger != "test_log_app.query" {
+		t.Errorf("expected the entry of the query logger, got %+v", entries)
+	}
+	if entries := get("/logs/app?level=warn"); len(entries) != 0 {
+		t.Errorf("expected no warnings, got %+v", entries)
+	}
+
+	resp, err := http.Get(srv.URL + "/logs/app/stream?field=rule=ads&limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("expected a stream of JSON lines, got %s", ct)
+	}
+
+	logger := ActiveContext().cfg.Logging.Logger(new(testLogApp)).Named("rules")
+	logger.Info("unrelated", zap.String("rule", "other"))
+	logger.With(zap.String("rule", "ads")).Info("rule matched", zap.Dict("dst", zap.String("host", "ads.example")))
+
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() {
+		t.Fatalf("expected a streamed entry: %v", lines.Err())
+	}
+	var e internal.LogRingEntry
+	if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+		t.Fatalf("invalid entry %s: %v", lines.Bytes(), err)
+	}
+	if e.Message != "rule matched" || e.Logger != "test_log_app.rules" {
+		t.Errorf("expected the matching entry, got %s", lines.Bytes())
+	}
+	if dst, _ := e.Fields["dst"].(map[string]any); dst["host"] != "ads.example" {
+		t.Errorf("expected the fields of the entry, got %s", lines.Bytes())
+	}
+
+	// unloading the config ends the stream
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(resp.Body); len(rest) != 0 {
+		t.Errorf("expected the stream to end, got %s", rest)
+	}
+}
+
+func TestRingLogStreamEndsOnShutdown(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	err := Load([]byte(`{
+		"admin": {"disabled": true},
+		"logging": {"logs": {"app": {
+			"writer": {"output": "discard"},
+			"core": {"module": "ring", "size": 2},
+			"include": ["test_log_app"]
+		}}},
+		"apps": {"test_log_app": {}}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := handleLogs(w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	cancelRequestsOnShutdown(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/logs/app/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("expected the stream not to hold up the shutdown: %v", err)
+	}
+	if rest, _ := io.ReadAll(resp.Body); len(rest) != 0 {
+		t.Errorf("expected the stream to end, got %s", rest)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricsNamespace prefixes the names of all of Guard's metrics.
+const metricsNamespace = "guard"
+
+// Metrics is the Prometheus registry of a config. Every config
+// gets its own, so modules can register their collectors while
+// being provisioned without clashing with the collectors of the
+// config being replaced. The admin endpoint serves the registry
+// of the running config at /metrics.
+//
+// Besides the process-wide collectors (Go runtime, process and
+// config reloads), a Metrics holds the collectors shared by the
+// modules that move traffic, so that they all report the same
+// metric names and labels. The traffic collectors are process-wide
+// too, so their counts carry over when the config is reloaded;
+// only the collectors of modules that belong to one config, like
+// the DNS resolvers, start afresh.
+type Metrics struct {
+	*prometheus.Registry
+
+	// RuleMatches counts the routing rules that matched a
+	// connection, by rule and the action that was taken.
+	RuleMatches *prometheus.CounterVec
+
+	// ActiveConnections is the number of open connections,
+	// by ingress and egress.
+	ActiveConnections *prometheus.GaugeVec
+
+	// TransferredBytes counts the bytes relayed, by ingress,
+	// egress and direction ("up" or "down").
+	TransferredBytes *prometheus.CounterVec
+
+	// DNS holds the metrics of DNS resolvers.
+	DNS *DNSMetrics
+}
+
+// DNSMetrics are the metrics of DNS resolvers, by transport
+// name. It can be passed to a core/dns.Resolver as-is.
+type DNSMetrics struct {
+	cacheHits       *prometheus.CounterVec
+	cacheMisses     *prometheus.CounterVec
+	upstreamLatency *prometheus.HistogramVec
+}
+
+// CacheHit records a question answered from the cache.
+func (m *DNSMetrics) CacheHit(transport string) {
+	m.cacheHits.WithLabelValues(transport).Inc()
+}
+
+// CacheMiss records a question that was not in the cache.
+func (m *DNSMetrics) CacheMiss(transport string) {
+	m.cacheMisses.WithLabelValues(transport).Inc()
+}
+
+// ObserveUpstream records an exchange with an upstream server
+// that took d and failed if err is not nil.
+func (m *DNSMetrics) ObserveUpstream(transport string, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.upstreamLatency.WithLabelValues(transport, result).Observe(d.Seconds())
+}
+
+// activeConnections returns the total number of open
+// connections over all ingresses and egresses.
+func (m *Metrics) activeConnections() int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.ActiveConnections.Collect(ch)
+		close(ch)
+	}()
+	var total float64
+	for metric := range ch {
+		var pb dto.Metric
+		if metric.Write(&pb) == nil && pb.Gauge != nil {
+			total += pb.Gauge.GetValue()
+		}
+	}
+	return int(total)
+}
+
+// newMetrics returns a registry with the process-wide collectors
+// and a fresh set of per-config collectors registered.
+func newMetrics() *Metrics {
+	m := &Metrics{
+		Registry:          prometheus.NewRegistry(),
+		RuleMatches:       globalMetrics.ruleMatches,
+		ActiveConnections: globalMetrics.activeConnections,
+		TransferredBytes:  globalMetrics.transferredBytes,
+		DNS: &DNSMetrics{
+			cacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Subsystem: "dns",
+				Name:      "cache_hits_total",
+				Help:      "Counter of DNS questions answered from the cache.",
+			}, []string{"transport"}),
+			cacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Subsystem: "dns",
+				Name:      "cache_misses_total",
+				Help:      "Counter of DNS questions not found in the cache.",
+			}, []string{"transport"}),
+			upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Subsystem: "dns",
+				Name:      "upstream_duration_seconds",
+				Help:      "Histogram of the round-trip times of upstream DNS exchanges.",
+				Buckets:   prometheus.DefBuckets,
+			}, []string{"transport", "result"}),
+		},
+	}
+	m.MustRegister(
+		globalMetrics.goCollector,
+		globalMetrics.processCollector,
+		globalMetrics.configReloads,
+		globalMetrics.configSuccess,
+		globalMetrics.configSuccessTime,
+		globalMetrics.ruleMatches,
+		globalMetrics.activeConnections,
+		globalMetrics.transferredBytes,
+		m.DNS.cacheHits,
+		m.DNS.cacheMisses,
+		m.DNS.upstreamLatency,
+	)
+	return m
+}
+
+// globalMetrics are the collectors that outlive any one config;
+// they are registered with the registry of every config.
+var globalMetrics = struct {
+	goCollector       prometheus.Collector
+	processCollector  prometheus.Collector
+	configReloads     *prometheus.CounterVec
+	configSuccess     prometheus.Gauge
+	configSuccessTime prometheus.Gauge
+	ruleMatches       *prometheus.CounterVec
+	activeConnections *prometheus.GaugeVec
+	transferredBytes  *prometheus.CounterVec
+}{
+	goCollector:      collectors.NewGoCollector(),
+	processCollector: collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	configReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "config",
+		Name:      "reloads_total",
+		Help:      "Counter of config loads, by result.",
+	}, []string{"result"}),
+	configSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "config",
+		Name:      "last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	}),
+	configSuccessTime: prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "config",
+		Name:      "last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	}),
+	ruleMatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "router",
+		Name:      "rule_matches_total",
+		Help:      "Counter of routing rules matched, by rule and action.",
+	}, []string{"rule", "action"}),
+	activeConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_connections",
+		Help:      "Number of open connections, by ingress and egress.",
+	}, []string{"ingress", "egress"}),
+	transferredBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "transferred_bytes_total",
+		Help:      "Counter of bytes relayed, by ingress, egress and direction.",
+	}, []string{"ingress", "egress", "direction"}),
+}
+
+// recordConfigReload updates the config reload metrics
+// with the outcome of a config load.
+func recordConfigReload(err error) {
+	if err != nil {
+		globalMetrics.configReloads.WithLabelValues("failure").Inc()
+		globalMetrics.configSuccess.Set(0)
+		return
+	}
+	globalMetrics.configReloads.WithLabelValues("success").Inc()
+	globalMetrics.configSuccess.Set(1)
+	globalMetrics.configSuccessTime.SetToCurrentTime()
+}
+
+// handleMetrics serves the metrics of the running config
+// in the Prometheus text exposition format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+	metrics := ActiveContext().metrics
+	if metrics == nil {
+		// no config has been loaded yet
+		metrics = newMetrics()
+	}
+	promhttp.HandlerFor(metrics, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, r)
+	return nil
+}
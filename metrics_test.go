@@ -0,0 +1,85 @@
+package uni
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	err := Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "metrics"}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globalMetrics.ruleMatches.Reset()
+	metrics := ActiveContext().Metrics()
+	metrics.RuleMatches.WithLabelValues("block-ads", "reject").Inc()
+	metrics.DNS.CacheHit("local")
+	metrics.DNS.ObserveUpstream("local", 20*time.Millisecond, errors.New("timeout"))
+
+	addr, err := ParseNetworkAddress("localhost:2019")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := (&AdminConfig{Listen: "localhost:2019"}).newAdminHandler(addr)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Host = "localhost:2019"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, expect := range []string{
+		`guard_config_reloads_total{result="success"}`,
+		`guard_config_last_reload_successful 1`,
+		`guard_router_rule_matches_total{action="reject",rule="block-ads"} 1`,
+		`guard_dns_cache_hits_total{transport="local"} 1`,
+		`guard_dns_upstream_duration_seconds_count{result="error",transport="local"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("expected metrics to contain %q", expect)
+		}
+	}
+
+	// a failed load is counted, but the running config keeps its metrics
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_broken_app": {}}}`), true)
+	if err == nil {
+		t.Fatal("expected broken config to fail")
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body = rec.Body.String()
+	for _, expect := range []string{
+		`guard_config_reloads_total{result="failure"}`,
+		`guard_config_last_reload_successful 0`,
+		`guard_router_rule_matches_total{action="reject",rule="block-ads"} 1`,
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("expected metrics after failed load to contain %q", expect)
+		}
+	}
+
+	// traffic metrics carry over to the next config,
+	// while the DNS metrics start afresh
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "reloaded"}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body = rec.Body.String()
+	if !strings.Contains(body, `guard_router_rule_matches_total{action="reject",rule="block-ads"} 1`) {
+		t.Error("expected rule matches to carry over to the reloaded config")
+	}
+	if strings.Contains(body, `guard_dns_cache_hits_total{transport="local"}`) {
+		t.Error("expected DNS metrics of the previous config to be discarded")
+	}
+}
@@ -1 +1,84 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api contains modules in the admin.api namespace, which
+// extend the admin endpoint with additional routes.
 package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"uni"
+)
+
+func init() {
+	uni.RegisterModule(ModulesAPI{})
+}
+
+// ModulesAPI is a module that serves the list of
+// modules registered in this build at /modules.
+type ModulesAPI struct{}
+
+// UniModule returns the Uni module information.
+func (ModulesAPI) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "admin.api.modules",
+		New: func() uni.Module { return new(ModulesAPI) },
+	}
+}
+
+// Routes returns the admin routes for the modules list.
+func (ModulesAPI) Routes() []uni.AdminRoute {
+	return []uni.AdminRoute{
+		{
+			Pattern: "/modules",
+			Handler: uni.AdminHandlerFunc(handleModules),
+		},
+	}
+}
+
+// moduleEntry describes a registered module.
+type moduleEntry struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+func handleModules(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return uni.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	names := uni.Modules()
+	entries := make([]moduleEntry, 0, len(names))
+	for _, name := range names {
+		id := uni.ModuleID(name)
+		entries = append(entries, moduleEntry{
+			ID:        name,
+			Namespace: id.Namespace(),
+			Name:      id.Name(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(entries)
+}
+
+// Interface guard
+var _ uni.AdminRouter = (*ModulesAPI)(nil)
@@ -0,0 +1,300 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package events implements Guard's event system: the "events" app
+// dispatches events emitted by the core and by modules to handler
+// modules in the events.handlers namespace.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"uni"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	uni.RegisterModule(App{})
+}
+
+// App implements a global eventing system within Guard.
+// Modules can emit and subscribe to events, providing
+// hooks into deep parts of the code base that aren't
+// otherwise accessible. Events provide information
+// about what and when things are happening, and this
+// facility allows handlers to take action when events
+// occur, add information to the event's metadata, and
+// even control program flow in some cases.
+//
+// Events are propagated in a DOM-like fashion. An event
+// emitted from module `a.b.c` (the "origin") will first
+// invoke handlers listening to `a.b.c`, then `a.b`,
+// then `a`, then those listening regardless of origin.
+// If a handler returns the special error uni.ErrEventAborted,
+// then propagation immediately stops and the event is
+// marked as aborted. Emitters may optionally choose to
+// adjust program flow based on an abort.
+//
+// Modules can subscribe to events by origin and/or name.
+// A handler is invoked only if it is subscribed to the
+// event by name and origin. Subscriptions should be
+// registered during the provisioning phase, before apps
+// are started.
+//
+// Event handlers are fired synchronously as part of the
+// regular flow of the program. This allows event handlers
+// to control the flow of the program if the origin permits
+// it and also allows handlers to convey new information
+// back into the origin module before it continues.
+// In essence, event handlers are similar to HTTP
+// middleware handlers.
+//
+// Event bindings/subscribers are unordered; i.e.
+// event handlers are invoked in an arbitrary order.
+// Event handlers should not rely on the logic of other
+// handlers to succeed.
+//
+// The entirety of this app module is EXPERIMENTAL and
+// subject to change. Pay attention to release notes.
+type App struct {
+	// Subscriptions bind handlers to one or more events
+	// either globally or scoped to specific modules or module
+	// namespaces.
+	Subscriptions []*Subscription `json:"subscriptions,omitempty"`
+
+	// Map of event name to map of module ID/namespace to handlers
+	subscriptions map[string]map[uni.ModuleID][]Handler
+
+	logger *zap.Logger
+}
+
+// Subscription represents binding of one or more handlers to
+// one or more events.
+type Subscription struct {
+	// The name(s) of the event(s) to bind to. Default: all events.
+	Events []string `json:"events,omitempty"`
+
+	// The ID or namespace of the module(s) from which events
+	// originate to listen to for events. Default: all modules.
+	//
+	// Events propagate up, so events emitted by module "a.b.c"
+	// will also trigger the event for "a.b" and "a". Thus, to
+	// receive all events from "a.b.c" and "a.b.d", for example,
+	// one can subscribe to either "a.b" or all of "a" entirely.
+	Modules []uni.ModuleID `json:"modules,omitempty"`
+
+	// The event handler modules. These implement the actual
+	// behavior to invoke when an event occurs. At least one
+	// handler is required.
+	HandlersRaw []json.RawMessage `json:"handlers,omitempty" caddy:"namespace=events.handlers inline_key=handler"`
+
+	// The decoded handlers; Go code that is subscribing to
+	// an event should set this field directly; HandlersRaw
+	// is meant for JSON configuration to fill out this field.
+	Handlers []Handler `json:"-"`
+}
+
+// UniModule returns the Uni module information.
+func (App) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "events",
+		New: func() uni.Module { return new(App) },
+	}
+}
+
+// Provision sets up the app and subscribes the configured
+// handlers, so that events emitted while the other apps of
+// the config start are already delivered.
+func (app *App) Provision(ctx uni.Context) error {
+	app.logger = ctx.Logger()
+	app.subscriptions = make(map[string]map[uni.ModuleID][]Handler)
+
+	for _, sub := range app.Subscriptions {
+		if sub.HandlersRaw != nil {
+			handlersIface, err := ctx.LoadModule(sub, "HandlersRaw")
+			if err != nil {
+				return fmt.Errorf("loading event subscriber modules: %v", err)
+			}
+			for _, h := range handlersIface.([]any) {
+				sub.Handlers = append(sub.Handlers, h.(Handler))
+			}
+		}
+		if len(sub.Handlers) == 0 {
+			// pointless to bind without any handlers
+			return fmt.Errorf("no handlers defined")
+		}
+		app.Subscribe(sub)
+	}
+
+	return nil
+}
+
+// Start runs the app.
+func (app *App) Start() error { return nil }
+
+// Stop gracefully shuts down the app.
+func (app *App) Stop() error { return nil }
+
+// Subscribe binds one or more event handlers to one or more events
+// according to the subscription s. For now, subscriptions can only
+// be created during the provision phase; new bindings cannot be
+// created after the events app has started.
+func (app *App) Subscribe(s *Subscription) {
+	if app.subscriptions == nil {
+		app.subscriptions = make(map[string]map[uni.ModuleID][]Handler)
+	}
+
+	// handle case of binding to all events
+	if len(s.Events) == 0 {
+		s.Events = []string{""}
+	}
+
+	// handle case of binding to all modules
+	if len(s.Modules) == 0 {
+		s.Modules = []uni.ModuleID{""}
+	}
+
+	for _, eventName := range s.Events {
+		eventName = strings.ToLower(eventName)
+		if app.subscriptions[eventName] == nil {
+			app.subscriptions[eventName] = make(map[uni.ModuleID][]Handler)
+		}
+		for _, originModule := range s.Modules {
+			app.subscriptions[eventName][originModule] = append(app.subscriptions[eventName][originModule], s.Handlers...)
+		}
+	}
+}
+
+// On is syntactic sugar for Subscribe() that binds a single handler
+// to a single event from any module. If the eventName is empty string,
+// it counts for all events.
+func (app *App) On(eventName string, handler Handler) {
+	app.Subscribe(&Subscription{
+		Events:   []string{eventName},
+		Handlers: []Handler{handler},
+	})
+}
+
+// Emit creates and dispatches an event named eventName to all relevant handlers with
+// the metadata data. Events are emitted and propagated synchronously. The returned Event
+// value will have any additional information from the invoked handlers.
+//
+// Note that the data map is not copied, for efficiency. After Emit() is called, the
+// data passed in should not be changed in other goroutines.
+func (app *App) Emit(ctx uni.Context, eventName string, data map[string]any) uni.Event {
+	logger := app.logger
+	if logger == nil {
+		logger = uni.Log().Named("events")
+	}
+
+	e, err := uni.NewEvent(ctx, eventName, data)
+	if err != nil {
+		logger.Error("failed to create event", zap.Error(err))
+		return e
+	}
+
+	var originModuleID uni.ModuleID
+	var originModuleName string
+	if origin := e.Origin(); origin != nil {
+		originModule := origin.UniModule()
+		originModuleID = originModule.ID
+		originModuleName = originModule.String()
+	}
+
+	logger = logger.With(
+		zap.String("id", e.ID().String()),
+		zap.String("origin", originModuleName),
+		zap.String("event", e.Name()),
+	)
+
+	if ce := logger.Check(zapcore.DebugLevel, "event"); ce != nil {
+		ce.Write(zap.Any("data", e.Data))
+	}
+
+	// invoke handlers bound to the event by name and also all events; this for loop
+	// iterates twice at most: once for the event name, once for "" (all events)
+	eventName = e.Name()
+	for {
+		moduleID := originModuleID
+
+		// implement propagation up the module tree (i.e. start with "a.b.c" then "a.b" then "a" then "")
+		for {
+			if app.subscriptions[eventName] == nil {
+				break // shortcut if event not bound at all
+			}
+
+			for _, handler := range app.subscriptions[eventName][moduleID] {
+				select {
+				case <-ctx.Done():
+					logger.Error("context canceled; event handling stopped")
+					return e
+				default:
+				}
+
+				logger.Debug("invoking subscribed handler",
+					zap.String("subscribed_to", eventName),
+					zap.Any("handler", handler))
+
+				if err := handler.Handle(ctx, e); err != nil {
+					aborted := errors.Is(err, uni.ErrEventAborted)
+
+					logger.Error("handler error",
+						zap.Error(err),
+						zap.Bool("aborted", aborted))
+
+					if aborted {
+						e.Aborted = err
+						return e
+					}
+				}
+			}
+
+			if moduleID == "" {
+				break
+			}
+			lastDot := strings.LastIndex(string(moduleID), ".")
+			if lastDot < 0 {
+				moduleID = "" // include handlers bound to events regardless of module
+			} else {
+				moduleID = moduleID[:lastDot]
+			}
+		}
+
+		// include handlers listening to all events
+		if eventName == "" {
+			break
+		}
+		eventName = ""
+	}
+
+	return e
+}
+
+// Handler is a type that can handle events.
+type Handler interface {
+	Handle(context.Context, uni.Event) error
+}
+
+// Interface guards
+var (
+	_ uni.App         = (*App)(nil)
+	_ uni.Provisioner = (*App)(nil)
+)
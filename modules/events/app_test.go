@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"uni"
+)
+
+type recordingHandler struct {
+	name  string
+	calls *[]string
+	err   error
+}
+
+func (h recordingHandler) Handle(_ context.Context, e uni.Event) error {
+	*h.calls = append(*h.calls, h.name+":"+e.Name())
+	return h.err
+}
+
+func TestEmitPropagation(t *testing.T) {
+	var calls []string
+	app := new(App)
+	app.Subscribe(&Subscription{
+		Events:   []string{"Rule_Matched"},
+		Handlers: []Handler{recordingHandler{name: "by-name", calls: &calls}},
+	})
+	app.Subscribe(&Subscription{
+		Handlers: []Handler{recordingHandler{name: "all", calls: &calls}},
+	})
+
+	ctx, cancel := uni.NewContext(uni.Context{Context: context.Background()})
+	defer cancel()
+
+	e := app.Emit(ctx, "rule_matched", map[string]any{"rule": "r1"})
+	if e.Aborted != nil {
+		t.Fatalf("unexpected abort: %v", e.Aborted)
+	}
+	expected := []string{"by-name:rule_matched", "all:rule_matched"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	calls = nil
+	app.Emit(ctx, "app_started", nil)
+	if fmt.Sprint(calls) != "[all:app_started]" {
+		t.Errorf("expected only catch-all handler, got %v", calls)
+	}
+}
+
+func TestEmitAbort(t *testing.T) {
+	var calls []string
+	app := new(App)
+	app.On("egress_switched", recordingHandler{
+		name:  "abort",
+		calls: &calls,
+		err:   fmt.Errorf("denied: %w", uni.ErrEventAborted),
+	})
+	app.On("", recordingHandler{name: "all", calls: &calls})
+
+	ctx, cancel := uni.NewContext(uni.Context{Context: context.Background()})
+	defer cancel()
+
+	e := app.Emit(ctx, "egress_switched", nil)
+	if e.Aborted == nil {
+		t.Fatal("expected event to be aborted")
+	}
+	if fmt.Sprint(calls) != "[abort:egress_switched]" {
+		t.Errorf("expected propagation to stop after abort, got %v", calls)
+	}
+}
+
+func init() {
+	uni.RegisterModule(testOrigin{})
+}
+
+// testOrigin is a module that keeps the context it was
+// provisioned with, to emit events from as the origin.
+type testOrigin struct {
+	ctx uni.Context
+}
+
+func (testOrigin) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "events.test.origin",
+		New: func() uni.Module { return new(testOrigin) },
+	}
+}
+
+func (o *testOrigin) Provision(ctx uni.Context) error {
+	o.ctx = ctx
+	return nil
+}
+
+func TestEmitPropagationByModule(t *testing.T) {
+	var calls []string
+	app := new(App)
+	for _, module := range []uni.ModuleID{"events.test.origin", "events.test", "events", "events.other"} {
+		app.Subscribe(&Subscription{
+			Events:   []string{"rule_matched"},
+			Modules:  []uni.ModuleID{module},
+			Handlers: []Handler{recordingHandler{name: string(module), calls: &calls}},
+		})
+	}
+	app.On("", recordingHandler{name: "all", calls: &calls})
+
+	ctx, cancel := uni.NewContext(uni.Context{Context: context.Background()})
+	defer cancel()
+	mod, err := ctx.LoadModuleByID("events.test.origin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := mod.(*testOrigin)
+
+	// the event goes up from the origin to its namespaces,
+	// then to the handlers of all events; the handlers of
+	// other modules are not invoked
+	e := app.Emit(origin.ctx, "rule_matched", nil)
+	if e.Aborted != nil {
+		t.Fatalf("unexpected abort: %v", e.Aborted)
+	}
+	if e.Origin() != origin {
+		t.Errorf("expected the module to be the origin, got %v", e.Origin())
+	}
+	expected := []string{
+		"events.test.origin:rule_matched",
+		"events.test:rule_matched",
+		"events:rule_matched",
+		"all:rule_matched",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	// aborting in a namespace stops the propagation up
+	calls = nil
+	app.Subscribe(&Subscription{
+		Events:  []string{"rule_matched"},
+		Modules: []uni.ModuleID{"events.test"},
+		Handlers: []Handler{recordingHandler{
+			name:  "abort",
+			calls: &calls,
+			err:   uni.ErrEventAborted,
+		}},
+	})
+	if e := app.Emit(origin.ctx, "rule_matched", nil); e.Aborted == nil {
+		t.Fatal("expected event to be aborted")
+	}
+	expected = []string{
+		"events.test.origin:rule_matched",
+		"events.test:rule_matched",
+		"abort:rule_matched",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"uni"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	uni.RegisterModule(LogHandler{})
+}
+
+// LogHandler is an event handler that writes every event it
+// receives to the "events.handlers.log" logger, so that events
+// can be routed to a dedicated log and picked up by alerting.
+type LogHandler struct {
+	// The level at which to log events. Default: INFO
+	Level string `json:"level,omitempty"`
+
+	level  zapcore.Level
+	logger *zap.Logger
+}
+
+// UniModule returns the Uni module information.
+func (LogHandler) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "events.handlers.log",
+		New: func() uni.Module { return new(LogHandler) },
+	}
+}
+
+// Provision sets up the handler.
+func (h *LogHandler) Provision(ctx uni.Context) error {
+	h.logger = ctx.Logger()
+	h.level = zapcore.InfoLevel
+	if h.Level != "" {
+		if err := h.level.UnmarshalText([]byte(h.Level)); err != nil {
+			return fmt.Errorf("invalid log level %q: %v", h.Level, err)
+		}
+	}
+	return nil
+}
+
+// Handle logs the event.
+func (h *LogHandler) Handle(_ context.Context, e uni.Event) error {
+	var origin string
+	if mod := e.Origin(); mod != nil {
+		origin = string(mod.UniModule().ID)
+	}
+	if ce := h.logger.Check(h.level, e.Name()); ce != nil {
+		ce.Write(
+			zap.String("id", e.ID().String()),
+			zap.Time("timestamp", e.Timestamp()),
+			zap.String("origin", origin),
+			zap.Any("data", e.Data),
+		)
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ Handler         = (*LogHandler)(nil)
+	_ uni.Provisioner = (*LogHandler)(nil)
+)
@@ -0,0 +1,105 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kfs
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+
+	"uni"
+)
+
+func init() {
+	uni.RegisterModule(EmbeddedFS{})
+}
+
+// RegisterEmbedded makes fsys, typically an embed.FS with files
+// compiled into the binary such as rule bundles, available to the
+// uni.fs.embedded module under name. It should be called in init().
+// It panics if name is empty or already registered.
+func RegisterEmbedded(name string, fsys fs.FS) {
+	embeddedMu.Lock()
+	defer embeddedMu.Unlock()
+
+	if name == "" {
+		panic("embedded file system name is required")
+	}
+	if fsys == nil {
+		panic("embedded file system is nil")
+	}
+	if _, ok := embedded[name]; ok {
+		panic(fmt.Sprintf("embedded file system already registered: %s", name))
+	}
+	embedded[name] = fsys
+}
+
+// EmbeddedFS is a file system that was compiled into the binary
+// and registered with RegisterEmbedded.
+type EmbeddedFS struct {
+	// The name the file system was registered with. Required.
+	Name string `json:"name"`
+
+	// An optional subdirectory of the embedded file system
+	// to use as the root.
+	Root string `json:"root,omitempty"`
+
+	fs.FS `json:"-"`
+}
+
+// UniModule returns the Uni module information.
+func (EmbeddedFS) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.fs.embedded",
+		New: func() uni.Module { return new(EmbeddedFS) },
+	}
+}
+
+// Provision looks up the embedded file system.
+func (e *EmbeddedFS) Provision(ctx uni.Context) error {
+	embeddedMu.RLock()
+	fsys, ok := embedded[e.Name]
+	names := make([]string, 0, len(embedded))
+	for name := range embedded {
+		names = append(names, name)
+	}
+	embeddedMu.RUnlock()
+	if !ok {
+		sort.Strings(names)
+		return fmt.Errorf("no embedded file system named %q; available: %v", e.Name, names)
+	}
+
+	if e.Root != "" && e.Root != "." {
+		sub, err := fs.Sub(fsys, e.Root)
+		if err != nil {
+			return fmt.Errorf("embedded file system %q: %v", e.Name, err)
+		}
+		fsys = sub
+	}
+	e.FS = fsys
+	return nil
+}
+
+var (
+	embedded   = make(map[string]fs.FS)
+	embeddedMu sync.RWMutex
+)
+
+// Interface guards
+var (
+	_ fs.FS           = (*EmbeddedFS)(nil)
+	_ uni.Provisioner = (*EmbeddedFS)(nil)
+)
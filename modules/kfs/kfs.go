@@ -1 +1,120 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kfs contains the filesystems app, which registers named
+// file systems with the config, and the file system modules in the
+// uni.fs namespace. Files in a named file system are referred to in
+// config fields as "fs_name:path"; see uni.Context.ResolveFile.
 package kfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"uni"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	uni.RegisterModule(FileSystems{})
+}
+
+// FileSystems is the filesystems app. It loads the configured file
+// system modules and registers each of them under its name, so
+// that other modules of the same config can refer to files in them.
+// This app is provisioned before all other apps.
+type FileSystems struct {
+	// The file systems to register.
+	FileSystems []*FileSystemEntry `json:"filesystems,omitempty"`
+
+	registry uni.FileSystems
+	logger   *zap.Logger
+}
+
+// FileSystemEntry is a file system with the name it is registered under.
+type FileSystemEntry struct {
+	// The name under which the file system is registered.
+	// The name "default" replaces the local OS file system
+	// that paths without a file system name refer to.
+	Name string `json:"name"`
+
+	// The file system module.
+	FileSystemRaw json.RawMessage `json:"file_system,omitempty" caddy:"namespace=uni.fs inline_key=backend"`
+
+	fileSystem fs.FS
+}
+
+// UniModule returns the Uni module information.
+func (FileSystems) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  uni.ModuleID(uni.FileSystemsAppName),
+		New: func() uni.Module { return new(FileSystems) },
+	}
+}
+
+// Provision loads the file system modules and registers them.
+func (f *FileSystems) Provision(ctx uni.Context) error {
+	f.logger = ctx.Logger()
+	f.registry = ctx.FileSystems()
+
+	seen := make(map[string]struct{}, len(f.FileSystems))
+	for _, entry := range f.FileSystems {
+		if entry.Name == "" {
+			return fmt.Errorf("file system name is required")
+		}
+		if _, ok := seen[entry.Name]; ok {
+			return fmt.Errorf("file system %q is defined more than once", entry.Name)
+		}
+		seen[entry.Name] = struct{}{}
+
+		if entry.FileSystemRaw == nil {
+			return fmt.Errorf("file system %q: missing file system module", entry.Name)
+		}
+		val, err := ctx.LoadModule(entry, "FileSystemRaw")
+		if err != nil {
+			return fmt.Errorf("loading file system module %q: %v", entry.Name, err)
+		}
+		entry.fileSystem = val.(fs.FS)
+
+		f.registry.Register(entry.Name, entry.fileSystem)
+		f.logger.Debug("registered file system", zap.String("name", entry.Name))
+	}
+
+	return nil
+}
+
+// Start does nothing; file systems are registered when provisioned.
+func (f *FileSystems) Start() error { return nil }
+
+// Stop does nothing.
+func (f *FileSystems) Stop() error { return nil }
+
+// Cleanup unregisters the file systems.
+func (f *FileSystems) Cleanup() error {
+	for _, entry := range f.FileSystems {
+		if entry.fileSystem != nil {
+			f.registry.Unregister(entry.Name)
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ uni.App          = (*FileSystems)(nil)
+	_ uni.Provisioner  = (*FileSystems)(nil)
+	_ uni.CleanerUpper = (*FileSystems)(nil)
+)
@@ -0,0 +1,113 @@
+package kfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"uni"
+)
+
+func init() {
+	RegisterEmbedded("test_bundle", fstest.MapFS{
+		"rules/cn.txt": {Data: []byte("embedded cn")},
+	})
+}
+
+func TestFileSystemsApp(t *testing.T) {
+	uni.ConfigAutosavePath = filepath.Join(t.TempDir(), "autosave.json")
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "ca.pem"), []byte("local ca"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "shadowed.txt"), []byte("from disk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := fmt.Sprintf(`{
+		"admin": {"disabled": true},
+		"apps": {
+			"filesystems": {
+				"filesystems": [
+					{"name": "etc", "file_system": {"backend": "local", "root": %q}},
+					{"name": "bundle", "file_system": {"backend": "embedded", "name": "test_bundle", "root": "rules"}},
+					{"name": "mem", "file_system": {
+						"backend": "memory",
+						"files": {"shadowed.txt": "from memory", "extra/x.txt": "x"},
+						"base": {"backend": "local", "root": %q}
+					}}
+				]
+			}
+		}
+	}`, root, root)
+	if err := uni.Load([]byte(cfg), true); err != nil {
+		t.Fatal(err)
+	}
+	ctx := uni.ActiveContext()
+
+	for _, tc := range []struct {
+		name   string
+		expect string
+	}{
+		{name: "etc:ca.pem", expect: "local ca"},
+		{name: "etc:/ca.pem", expect: "local ca"},
+		{name: "bundle:cn.txt", expect: "embedded cn"},
+		{name: "mem:shadowed.txt", expect: "from memory"},
+		{name: "mem:ca.pem", expect: "local ca"},
+		{name: "mem:extra/x.txt", expect: "x"},
+		{name: filepath.Join(root, "ca.pem"), expect: "local ca"},
+	} {
+		data, err := ctx.ReadFile(tc.name)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if string(data) != tc.expect {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expect, data)
+		}
+	}
+
+	for _, name := range []string{"etc:../secret", "etc:escape", "mem:escape"} {
+		if data, err := ctx.ReadFile(name); err == nil {
+			t.Errorf("%s: expected path to be confined to root, read %q", name, data)
+		}
+	}
+
+	fsys, _ := ctx.FileSystems().Get("mem")
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if expect := "[ca.pem escape extra shadowed.txt]"; fmt.Sprint(names) != expect {
+		t.Errorf("expected merged listing %s, got %v", expect, names)
+	}
+
+	if err := fsys.(*MemoryFS).WriteFile("/new.txt", []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ctx.ReadFile("mem:new.txt"); err != nil || string(data) != "new" {
+		t.Errorf("expected written file, got %q (%v)", data, err)
+	}
+
+	if err := uni.Load([]byte(`{"admin": {"disabled": true}}`), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ctx.FileSystems().Get("etc"); ok {
+		t.Error("expected file systems to be unregistered after the config was unloaded")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"uni"
+)
+
+func init() {
+	uni.RegisterModule(LocalFS{})
+}
+
+// LocalFS is a file system rooted at a directory of the local
+// OS file system. Paths can never escape the root, neither with
+// ".." elements nor by following symbolic links that point out
+// of it.
+type LocalFS struct {
+	// The directory to which the file system is rooted. Required.
+	Root string `json:"root"`
+
+	root *os.Root
+	fsys fs.FS
+}
+
+// UniModule returns the Uni module information.
+func (LocalFS) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.fs.local",
+		New: func() uni.Module { return new(LocalFS) },
+	}
+}
+
+// Provision opens the root directory.
+func (l *LocalFS) Provision(ctx uni.Context) error {
+	if l.Root == "" {
+		return fmt.Errorf("root directory is required")
+	}
+	root, err := os.OpenRoot(l.Root)
+	if err != nil {
+		return fmt.Errorf("opening root directory: %v", err)
+	}
+	l.root = root
+	l.fsys = root.FS()
+	return nil
+}
+
+// Open opens the named file.
+func (l *LocalFS) Open(name string) (fs.File, error) { return l.fsys.Open(name) }
+
+// Stat returns a FileInfo describing the named file.
+func (l *LocalFS) Stat(name string) (fs.FileInfo, error) { return fs.Stat(l.fsys, name) }
+
+// ReadFile reads the named file and returns its contents.
+func (l *LocalFS) ReadFile(name string) ([]byte, error) { return fs.ReadFile(l.fsys, name) }
+
+// ReadDir reads the named directory.
+func (l *LocalFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(l.fsys, name) }
+
+// Cleanup closes the root directory.
+func (l *LocalFS) Cleanup() error {
+	if l.root != nil {
+		return l.root.Close()
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ fs.StatFS        = (*LocalFS)(nil)
+	_ fs.ReadFileFS    = (*LocalFS)(nil)
+	_ fs.ReadDirFS     = (*LocalFS)(nil)
+	_ uni.Provisioner  = (*LocalFS)(nil)
+	_ uni.CleanerUpper = (*LocalFS)(nil)
+)
@@ -0,0 +1,182 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	"uni"
+)
+
+func init() {
+	uni.RegisterModule(new(MemoryFS))
+}
+
+// MemoryFS is an in-memory file system, optionally layered over
+// another file system: files in memory take precedence over the
+// files of the same name in the base file system, and directory
+// listings contain the files of both. Files can be added from the
+// config or, by Go code such as tests, with WriteFile. It is safe
+// for concurrent use.
+type MemoryFS struct {
+	// Initial files, keyed by their slash-separated path.
+	Files map[string]string `json:"files,omitempty"`
+
+	// An optional file system module to layer the in-memory
+	// files over; it is read-only through this file system.
+	BaseRaw json.RawMessage `json:"base,omitempty" caddy:"namespace=uni.fs inline_key=backend"`
+
+	mu    sync.RWMutex
+	files fstest.MapFS
+	base  fs.FS
+}
+
+// UniModule returns the Uni module information.
+func (*MemoryFS) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.fs.memory",
+		New: func() uni.Module { return new(MemoryFS) },
+	}
+}
+
+// Provision loads the base file system and the initial files.
+func (m *MemoryFS) Provision(ctx uni.Context) error {
+	if m.BaseRaw != nil {
+		val, err := ctx.LoadModule(m, "BaseRaw")
+		if err != nil {
+			return fmt.Errorf("loading base file system: %v", err)
+		}
+		m.base = val.(fs.FS)
+	}
+	for name, data := range m.Files {
+		if err := m.WriteFile(name, []byte(data), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile creates or replaces the file name with data. Parent
+// directories are implied. Files that are already open keep
+// reading their previous contents.
+func (m *MemoryFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	name = strings.TrimPrefix(name, "/")
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = make(fstest.MapFS)
+	}
+	m.files[name] = &fstest.MapFile{
+		Data:    slices.Clone(data),
+		Mode:    perm.Perm(),
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+// Remove removes the in-memory file name. Files of the base file
+// system cannot be removed.
+func (m *MemoryFS) Remove(name string) error {
+	name = strings.TrimPrefix(name, "/")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// Open opens the named file, looking in memory first.
+func (m *MemoryFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	f, err := m.files.Open(name)
+	m.mu.RUnlock()
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || m.base == nil {
+		return f, err
+	}
+	return m.base.Open(name)
+}
+
+// Stat returns a FileInfo describing the named file.
+func (m *MemoryFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	info, err := m.files.Stat(name)
+	m.mu.RUnlock()
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || m.base == nil {
+		return info, err
+	}
+	return fs.Stat(m.base, name)
+}
+
+// ReadFile reads the named file, looking in memory first.
+func (m *MemoryFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	data, err := m.files.ReadFile(name)
+	m.mu.RUnlock()
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || m.base == nil {
+		return data, err
+	}
+	return fs.ReadFile(m.base, name)
+}
+
+// ReadDir reads the named directory, merging the in-memory
+// entries with those of the base file system.
+func (m *MemoryFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	entries, err := m.files.ReadDir(name)
+	m.mu.RUnlock()
+	if m.base == nil {
+		return entries, err
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	memErr := err
+
+	baseEntries, err := fs.ReadDir(m.base, name)
+	if err != nil {
+		if memErr == nil && errors.Is(err, fs.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	for _, e := range baseEntries {
+		if !slices.ContainsFunc(entries, func(mem fs.DirEntry) bool { return mem.Name() == e.Name() }) {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// Interface guards
+var (
+	_ fs.StatFS       = (*MemoryFS)(nil)
+	_ fs.ReadFileFS   = (*MemoryFS)(nil)
+	_ fs.ReadDirFS    = (*MemoryFS)(nil)
+	_ uni.Provisioner = (*MemoryFS)(nil)
+)
@@ -0,0 +1,255 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"os"
+	"time"
+
+	"uni"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/term"
+)
+
+func init() {
+	uni.RegisterModule(ConsoleEncoder{})
+	uni.RegisterModule(JSONEncoder{})
+}
+
+// ConsoleEncoder encodes log entries that are mostly human-readable.
+// Levels are colored by default if the log writes to standard error
+// or standard output, that stream is a terminal, and the NO_COLOR
+// environment variable is not set.
+type ConsoleEncoder struct {
+	zapcore.Encoder `json:"-"`
+	LogEncoderConfig
+}
+
+// UniModule returns the Uni module information.
+func (ConsoleEncoder) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.console",
+		New: func() uni.Module { return new(ConsoleEncoder) },
+	}
+}
+
+// Provision sets up the encoder.
+func (ce *ConsoleEncoder) Provision(ctx uni.Context) error {
+	if ce.LevelFormat == "" {
+		ce.LevelFormat = "upper"
+		if ctx.Context != nil {
+			if wo, ok := ctx.Value(uni.LogWriterCtxKey).(uni.WriterOpener); ok && colorTerminal(wo) {
+				ce.LevelFormat = "color"
+			}
+		}
+	}
+	if ce.TimeFormat == "" {
+		ce.TimeFormat = "wall_milli"
+	}
+	ce.Encoder = ce.wrap(zapcore.NewConsoleEncoder(ce.ZapcoreEncoderConfig()))
+	return nil
+}
+
+// JSONEncoder encodes entries as JSON.
+type JSONEncoder struct {
+	zapcore.Encoder `json:"-"`
+	LogEncoderConfig
+}
+
+// UniModule returns the Uni module information.
+func (JSONEncoder) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.json",
+		New: func() uni.Module { return new(JSONEncoder) },
+	}
+}
+
+// Provision sets up the encoder.
+func (je *JSONEncoder) Provision(_ uni.Context) error {
+	je.Encoder = je.wrap(zapcore.NewJSONEncoder(je.ZapcoreEncoderConfig()))
+	return nil
+}
+
+// LogEncoderConfig holds configuration common to most encoders.
+type LogEncoderConfig struct {
+	MessageKey    *string `json:"message_key,omitempty"`
+	LevelKey      *string `json:"level_key,omitempty"`
+	TimeKey       *string `json:"time_key,omitempty"`
+	NameKey       *string `json:"name_key,omitempty"`
+	CallerKey     *string `json:"caller_key,omitempty"`
+	StacktraceKey *string `json:"stacktrace_key,omitempty"`
+	LineEnding    *string `json:"line_ending,omitempty"`
+
+	// Recognized values are: unix_seconds_float, unix_milli_float, unix_nano, iso8601, rfc3339, rfc3339_nano, wall, wall_milli, wall_nano, common_log.
+	// The value may also be custom format per the Go `time` package layout specification, as described [here](https://pkg.go.dev/time#pkg-constants).
+	TimeFormat string `json:"time_format,omitempty"`
+	TimeLocal  bool   `json:"time_local,omitempty"`
+
+	// Recognized values are: s/second/seconds, ns/nano/nanos, ms/milli/millis, string.
+	// Empty and unrecognized value default to seconds.
+	DurationFormat string `json:"duration_format,omitempty"`
+
+	// Recognized values are: lower, upper, color.
+	// Empty and unrecognized value default to lower.
+	LevelFormat string `json:"level_format,omitempty"`
+
+	// RenameFields maps the names of fields to the names they are
+	// written with, e.g. {"src_ip": "client_ip"}. Only top-level
+	// fields are renamed; to rename the message, level, etc., use
+	// the respective key settings.
+	RenameFields map[string]string `json:"rename_fields,omitempty"`
+}
+
+// ZapcoreEncoderConfig returns the equivalent zapcore.EncoderConfig.
+// If lec is nil, zap.NewProductionEncoderConfig() is returned.
+func (lec *LogEncoderConfig) ZapcoreEncoderConfig() zapcore.EncoderConfig {
+	cfg := zap.NewProductionEncoderConfig()
+	if lec == nil {
+		lec = new(LogEncoderConfig)
+	}
+	if lec.MessageKey != nil {
+		cfg.MessageKey = *lec.MessageKey
+	}
+	if lec.LevelKey != nil {
+		cfg.LevelKey = *lec.LevelKey
+	}
+	if lec.TimeKey != nil {
+		cfg.TimeKey = *lec.TimeKey
+	}
+	if lec.NameKey != nil {
+		cfg.NameKey = *lec.NameKey
+	}
+	if lec.CallerKey != nil {
+		cfg.CallerKey = *lec.CallerKey
+	}
+	if lec.StacktraceKey != nil {
+		cfg.StacktraceKey = *lec.StacktraceKey
+	}
+	if lec.LineEnding != nil {
+		cfg.LineEnding = *lec.LineEnding
+	}
+
+	// time format
+	var timeFormatter zapcore.TimeEncoder
+	switch lec.TimeFormat {
+	case "", "unix_seconds_float":
+		timeFormatter = zapcore.EpochTimeEncoder
+	case "unix_milli_float":
+		timeFormatter = zapcore.EpochMillisTimeEncoder
+	case "unix_nano":
+		timeFormatter = zapcore.EpochNanosTimeEncoder
+	case "iso8601":
+		timeFormatter = zapcore.ISO8601TimeEncoder
+	default:
+		timeFormat := lec.TimeFormat
+		switch lec.TimeFormat {
+		case "rfc3339":
+			timeFormat = time.RFC3339
+		case "rfc3339_nano":
+			timeFormat = time.RFC3339Nano
+		case "wall":
+			timeFormat = "2006/01/02 15:04:05"
+		case "wall_milli":
+			timeFormat = "2006/01/02 15:04:05.000"
+		case "wall_nano":
+			timeFormat = "2006/01/02 15:04:05.000000000"
+		case "common_log":
+			timeFormat = "02/Jan/2006:15:04:05 -0700"
+		}
+		timeFormatter = func(ts time.Time, encoder zapcore.PrimitiveArrayEncoder) {
+			var t time.Time
+			if lec.TimeLocal {
+				t = ts.Local()
+			} else {
+				t = ts.UTC()
+			}
+			encoder.AppendString(t.Format(timeFormat))
+		}
+	}
+	cfg.EncodeTime = timeFormatter
+
+	// duration format
+	var durFormatter zapcore.DurationEncoder
+	switch lec.DurationFormat {
+	case "s", "second", "seconds":
+		durFormatter = zapcore.SecondsDurationEncoder
+	case "ns", "nano", "nanos":
+		durFormatter = zapcore.NanosDurationEncoder
+	case "ms", "milli", "millis":
+		durFormatter = zapcore.MillisDurationEncoder
+	case "string":
+		durFormatter = zapcore.StringDurationEncoder
+	default:
+		durFormatter = zapcore.SecondsDurationEncoder
+	}
+	cfg.EncodeDuration = durFormatter
+
+	// level format
+	var levelFormatter zapcore.LevelEncoder
+	switch lec.LevelFormat {
+	case "upper":
+		levelFormatter = zapcore.CapitalLevelEncoder
+	case "color":
+		levelFormatter = zapcore.CapitalColorLevelEncoder
+	default:
+		levelFormatter = zapcore.LowercaseLevelEncoder
+	}
+	cfg.EncodeLevel = levelFormatter
+
+	return cfg
+}
+
+// wrap returns enc wrapped so that it renames fields
+// as configured, or enc itself if there is nothing
+// to rename.
+func (lec *LogEncoderConfig) wrap(enc zapcore.Encoder) zapcore.Encoder {
+	if len(lec.RenameFields) == 0 {
+		return enc
+	}
+	return renamingEncoder{Encoder: enc, names: lec.RenameFields}
+}
+
+// colorTerminal returns true if wo writes to a standard
+// stream that is a terminal and colors have not been
+// disabled.
+func colorTerminal(wo uni.WriterOpener) bool {
+	var stream *os.File
+	switch wo.(type) {
+	case uni.StderrWriter, *uni.StderrWriter:
+		stream = os.Stderr
+	case uni.StdoutWriter, *uni.StdoutWriter:
+		stream = os.Stdout
+	default:
+		return false
+	}
+	return isTerminal(int(stream.Fd())) &&
+		os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "xterm-mono"
+}
+
+// isTerminal is a variable so tests can pretend
+// that the standard streams are terminals.
+var isTerminal = term.IsTerminal
+
+// Interface guards
+var (
+	_ zapcore.Encoder = (*ConsoleEncoder)(nil)
+	_ zapcore.Encoder = (*JSONEncoder)(nil)
+
+	_ uni.Provisioner = (*ConsoleEncoder)(nil)
+	_ uni.Provisioner = (*JSONEncoder)(nil)
+)
@@ -0,0 +1,204 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"uni"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/term"
+)
+
+// encoderModule is what all encoder modules are.
+type encoderModule interface {
+	zapcore.Encoder
+	uni.Provisioner
+}
+
+// logWith encodes the entries logged by log with the encoder
+// enc, which is provisioned from the JSON config cfg first.
+func logWith(t *testing.T, enc encoderModule, cfg string, log func(*zap.Logger)) string {
+	t.Helper()
+	if err := json.Unmarshal([]byte(cfg), enc); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := uni.NewContext(uni.Context{Context: context.Background()})
+	defer cancel()
+	if err := enc.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	core := zapcore.NewCore(enc, zapcore.AddSync(&buf), zapcore.DebugLevel)
+	log(zap.New(core).Named("router"))
+	return buf.String()
+}
+
+// testEntry logs an entry at a fixed time with a context
+// field, a nested object and a duration.
+func testEntry(logger *zap.Logger) {
+	ts := time.Date(2025, 1, 2, 15, 4, 5, 600_000_000, time.UTC)
+	logger.With(zap.String("src_ip", "10.0.0.1")).
+		WithOptions(zap.WithClock(fixedClock(ts))).
+		Warn("rule matched",
+			zap.String("rule", "block ads"),
+			zap.Duration("took", 1500*time.Millisecond),
+			zap.Dict("dst", zap.String("host", "ads.example"), zap.Int("port", 443)))
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time                         { return time.Time(c) }
+func (c fixedClock) NewTicker(d time.Duration) *time.Ticker { return time.NewTicker(d) }
+
+func TestJSONEncoder(t *testing.T) {
+	out := logWith(t, new(JSONEncoder), `{
+		"time_format": "rfc3339",
+		"level_format": "upper",
+		"message_key": "message",
+		"duration_format": "ms",
+		"rename_fields": {"src_ip": "client_ip", "rule": "rule_id"}
+	}`, testEntry)
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	for key, expect := range map[string]any{
+		"ts":        "2025-01-02T15:04:05Z",
+		"level":     "WARN",
+		"logger":    "router",
+		"message":   "rule matched",
+		"client_ip": "10.0.0.1",
+		"rule_id":   "block ads",
+		"took":      float64(1500),
+	} {
+		if entry[key] != expect {
+			t.Errorf("expected %s=%v, got %v (%s)", key, expect, entry[key], out)
+		}
+	}
+	if _, ok := entry["src_ip"]; ok {
+		t.Errorf("expected src_ip to be renamed: %s", out)
+	}
+}
+
+func TestConsoleEncoder(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	out := logWith(t, new(ConsoleEncoder), `{}`, testEntry)
+	expect := "2025/01/02 15:04:05.600\tWARN\trouter\trule matched\t"
+	if !strings.HasPrefix(out, expect) {
+		t.Errorf("expected console output to start with %q, got %q", expect, out)
+	}
+}
+
+func TestConsoleEncoderColor(t *testing.T) {
+	isTerminal = func(int) bool { return true }
+	t.Cleanup(func() { isTerminal = term.IsTerminal })
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm")
+
+	for i, tc := range []struct {
+		writer uni.WriterOpener
+		config string
+		expect string
+	}{
+		{writer: uni.StderrWriter{}, config: `{}`, expect: "color"},
+		{writer: uni.StdoutWriter{}, config: `{}`, expect: "color"},
+		{writer: &FileWriter{Filename: "guard.log"}, config: `{}`, expect: "upper"},
+		{writer: nil, config: `{}`, expect: "upper"},
+		{writer: uni.StderrWriter{}, config: `{"level_format": "lower"}`, expect: "lower"},
+	} {
+		ctx, cancel := uni.NewContext(uni.Context{Context: context.Background()})
+		if tc.writer != nil {
+			ctx.Context = context.WithValue(ctx.Context, uni.LogWriterCtxKey, tc.writer)
+		}
+		enc := new(ConsoleEncoder)
+		if err := json.Unmarshal([]byte(tc.config), enc); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Provision(ctx); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if enc.LevelFormat != tc.expect {
+			t.Errorf("Test %d: expected level format %s, got %s", i, tc.expect, enc.LevelFormat)
+		}
+	}
+
+	// a log to a file is not colored, whatever stderr is
+	filename := filepath.Join(t.TempDir(), "guard.log")
+	autosave := uni.ConfigAutosavePath
+	uni.ConfigAutosavePath = filepath.Join(t.TempDir(), "autosave.json")
+	t.Cleanup(func() {
+		_ = uni.Stop()
+		uni.ConfigAutosavePath = autosave
+	})
+	err := uni.Load([]byte(`{
+		"admin": {"disabled": true},
+		"logging": {"logs": {"default": {
+			"writer": {"output": "file", "filename": `+strconv.Quote(filename)+`},
+			"encoder": {"format": "console"}
+		}}}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uni.Log().Warn("to the file")
+	if err := uni.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "\tWARN\t") || strings.Contains(string(out), "\x1b[") {
+		t.Errorf("expected an uncolored level, got %q", out)
+	}
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	out := logWith(t, new(LogfmtEncoder), `{"rename_fields": {"src_ip": "client_ip"}}`, testEntry)
+	expect := `ts=2025-01-02T15:04:05.6Z level=warn logger=router msg="rule matched" client_ip=10.0.0.1 ` +
+		`rule="block ads" took=1.5s dst.host=ads.example dst.port=443` + "\n"
+	if out != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, out)
+	}
+
+	out = logWith(t, new(LogfmtEncoder), `{"time_key": "", "level_key": "severity", "level_format": "upper"}`, func(l *zap.Logger) {
+		l.Info("quote \"me\"", zap.Strings("tags", []string{"a", "b c"}), zap.String("odd key=", ""))
+	})
+	expect = `severity=INFO logger=router msg="quote \"me\"" tags="a,b c" odd_key_=""` + "\n"
+	if out != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, out)
+	}
+}
+
+func TestTemplateEncoder(t *testing.T) {
+	out := logWith(t, new(TemplateEncoder), `{
+		"template": "[{level}] {ts} {logger}: {msg} dst={fields.dst.host} {missing} {fields}",
+		"time_format": "15:04:05",
+		"level_format": "upper",
+		"rename_fields": {"src_ip": "client_ip"}
+	}`, testEntry)
+	expect := `[WARN] 15:04:05 router: rule matched dst=ads.example ` +
+		`client_ip=10.0.0.1 dst="{\"host\":\"ads.example\",\"port\":443}" rule="block ads" took=1.5s` + "\n"
+	if out != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, out)
+	}
+
+	// empty placeholders do not leave gaps
+	out = logWith(t, new(TemplateEncoder), `{"time_format": "wall"}`, func(l *zap.Logger) {
+		zap.New(l.Core()).WithOptions(zap.WithClock(fixedClock(time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)))).Info("hello")
+	})
+	if expect := "2025/01/02 00:00:00 info hello\n"; out != expect {
+		t.Errorf("expected %q, got %q", expect, out)
+	}
+}
@@ -0,0 +1,498 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"uni"
+)
+
+func init() {
+	uni.RegisterModule(FileWriter{})
+}
+
+// fileMode is a string made of 1 to 4 octal digits representing
+// a numeric mode as specified with the `chmod` unix command.
+// `"0777"` and `"777"` are thus equivalent values.
+type fileMode os.FileMode
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (m *fileMode) UnmarshalJSON(b []byte) error {
+	if len(b) == 0 {
+		return io.EOF
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	mode, err := parseFileMode(s)
+	if err != nil {
+		return err
+	}
+	*m = fileMode(mode)
+	return nil
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (m fileMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%04o", m))
+}
+
+// parseFileMode parses a file mode string,
+// adding support for `chmod` unix command like
+// 1 to 4 digital octal values.
+func parseFileMode(s string) (os.FileMode, error) {
+	if s == "" || len(s) > 4 {
+		return 0, fmt.Errorf("invalid file mode %q: must be 1 to 4 octal digits", s)
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q: %v", s, err)
+	}
+	return os.FileMode(mode), nil
+}
+
+// FileWriter can write logs to files. By default, log files
+// are rotated ("rolled") when they get large, and old log
+// files get deleted, to ensure that the process does not
+// exhaust disk space.
+//
+// The file is reopened when the process receives SIGUSR1,
+// so it can also be rotated by external tools like logrotate,
+// in which case rolling should be disabled.
+type FileWriter struct {
+	// Filename is the name of the file to write.
+	Filename string `json:"filename,omitempty"`
+
+	// The file permissions mode.
+	// 0600 by default.
+	Mode fileMode `json:"mode,omitempty"`
+
+	// Roll toggles log rolling or rotation, which is
+	// enabled by default.
+	Roll *bool `json:"roll,omitempty"`
+
+	// When a log file reaches approximately this size,
+	// it will be rotated. Default: 100 MB.
+	RollSizeMB int `json:"roll_size_mb,omitempty"`
+
+	// If set, the log file is also rotated at every
+	// multiple of this interval (e.g. "24h" rotates at
+	// midnight) when written to. By default, log files
+	// are not rotated by time.
+	RollInterval uni.Duration `json:"roll_interval,omitempty"`
+
+	// Whether to compress rolled files with gzip.
+	// Default: true
+	RollCompress *bool `json:"roll_gzip,omitempty"`
+
+	// Whether to use local timestamps in rolled filenames,
+	// and to align the roll interval to local time.
+	// Default: false
+	RollLocalTime bool `json:"roll_local_time,omitempty"`
+
+	// The maximum number of rolled log files to keep.
+	// Default: 10
+	RollKeep int `json:"roll_keep,omitempty"`
+
+	// How many days to keep rolled log files. Default: 90
+	RollKeepDays int `json:"roll_keep_days,omitempty"`
+}
+
+// UniModule returns the Uni module information.
+func (FileWriter) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.writers.file",
+		New: func() uni.Module { return new(FileWriter) },
+	}
+}
+
+// Provision sets up the module.
+func (fw *FileWriter) Provision(ctx uni.Context) error {
+	if fw.Filename == "" {
+		return fmt.Errorf("filename is required")
+	}
+	if fw.Mode == 0 {
+		fw.Mode = 0o600
+	}
+	if fw.RollSizeMB < 0 || fw.RollKeep < 0 || fw.RollKeepDays < 0 || fw.RollInterval < 0 {
+		return fmt.Errorf("roll settings must not be negative")
+	}
+	if fw.RollSizeMB == 0 {
+		fw.RollSizeMB = 100
+	}
+	if fw.RollKeep == 0 {
+		fw.RollKeep = 10
+	}
+	if fw.RollKeepDays == 0 {
+		fw.RollKeepDays = 90
+	}
+	return nil
+}
+
+func (fw FileWriter) String() string {
+	fpath, err := filepath.Abs(fw.Filename)
+	if err == nil {
+		return fpath
+	}
+	return fw.Filename
+}
+
+// WriterKey returns a unique key representing this fw.
+func (fw FileWriter) WriterKey() string {
+	return "file:" + fw.Filename
+}
+
+// OpenWriter opens a new file writer.
+func (fw FileWriter) OpenWriter() (io.WriteCloser, error) {
+	rf := &rollingFile{
+		filename: fw.Filename,
+		mode:     os.FileMode(fw.Mode),
+		now:      time.Now,
+	}
+	if rf.mode == 0 {
+		rf.mode = 0o600
+	}
+	if fw.Roll == nil || *fw.Roll {
+		rf.roll = true
+		rf.maxSize = int64(fw.RollSizeMB) * 1024 * 1024
+		rf.interval = time.Duration(fw.RollInterval)
+		rf.compress = fw.RollCompress == nil || *fw.RollCompress
+		rf.localTime = fw.RollLocalTime
+		rf.keep = fw.RollKeep
+		rf.maxAge = time.Duration(fw.RollKeepDays) * 24 * time.Hour
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// backupTimeFormat is the format of the timestamp
+// in the names of rolled log files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rollingFile is an append-only log file that is rotated
+// when it gets too large or too old. Rolled files are named
+// after the log file with the time of the rotation inserted
+// before the extension, e.g. "access-2025-01-02T15-04-05.000.log";
+// they are compressed and pruned in the background.
+type rollingFile struct {
+	filename  string
+	mode      os.FileMode
+	roll      bool
+	maxSize   int64         // 0 means no size limit
+	interval  time.Duration // 0 means no time-based rotation
+	compress  bool
+	localTime bool
+	keep      int           // 0 means no limit
+	maxAge    time.Duration // 0 means no limit
+	now       func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	nextRoll time.Time
+	closed   bool
+
+	millMu sync.Mutex
+	millWg sync.WaitGroup
+}
+
+// open opens (or creates) the log file for appending.
+// It must be called with mu held, or before rf is shared.
+func (rf *rollingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.filename), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(rf.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, rf.mode)
+	if err != nil {
+		return err
+	}
+	// the mode passed to OpenFile only applies to new files
+	// and is subject to the umask, so enforce it explicitly
+	if err := f.Chmod(rf.mode); err != nil && !os.IsPermission(err) {
+		f.Close()
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	rf.nextRoll = time.Time{} // set by the next write
+	return nil
+}
+
+// nextRollAfter returns the first multiple of the roll
+// interval after t, aligned to local time if configured.
+func (rf *rollingFile) nextRollAfter(t time.Time) time.Time {
+	var offset time.Duration
+	if rf.localTime {
+		_, secs := t.Zone()
+		offset = time.Duration(secs) * time.Second
+	}
+	return t.Add(offset).Truncate(rf.interval).Add(rf.interval).Add(-offset)
+}
+
+// Write writes p to the log file, rotating
+// it first if p would not fit or if the roll
+// interval has elapsed.
+func (rf *rollingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+	now := rf.now()
+	if rf.roll && rf.size > 0 {
+		tooLarge := rf.maxSize > 0 && rf.size+int64(len(p)) > rf.maxSize
+		tooOld := !rf.nextRoll.IsZero() && !now.Before(rf.nextRoll)
+		if tooLarge || tooOld {
+			if err := rf.rotate(now); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if rf.roll && rf.interval > 0 && rf.nextRoll.IsZero() {
+		rf.nextRoll = rf.nextRollAfter(now)
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current log file aside as of time now,
+// opens a new one and starts compressing and pruning rolled
+// files in the background. It must be called with mu held.
+func (rf *rollingFile) rotate(now time.Time) error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+
+	t := now
+	if !rf.localTime {
+		t = t.UTC()
+	}
+	backup := rf.backupName(t)
+	// do not overwrite a file rolled within the same millisecond
+	for {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			break
+		}
+		t = t.Add(time.Millisecond)
+		backup = rf.backupName(t)
+	}
+	if err := os.Rename(rf.filename, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.millWg.Add(1)
+	go func() {
+		defer rf.millWg.Done()
+		rf.mill(now)
+	}()
+	return nil
+}
+
+// backupName returns the name of the log
+// file when it is rolled at time t.
+func (rf *rollingFile) backupName(t time.Time) string {
+	dir, prefix, ext := rf.nameParts()
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+// nameParts returns the directory of the log file, and
+// the prefix and extension of the names of rolled files.
+func (rf *rollingFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(rf.filename)
+	base := filepath.Base(rf.filename)
+	ext = filepath.Ext(base)
+	prefix = strings.TrimSuffix(base, ext) + "-"
+	return
+}
+
+// rolledFile is a rolled log file found on disk.
+type rolledFile struct {
+	path string
+	time time.Time
+}
+
+// rolledFiles returns the rolled log files of the
+// log file, newest first.
+func (rf *rollingFile) rolledFiles() ([]rolledFile, error) {
+	dir, prefix, ext := rf.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	loc := time.UTC
+	if rf.localTime {
+		loc = time.Local
+	}
+	var files []rolledFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		ts, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if ts, ok = strings.CutSuffix(ts, ".gz"); !ok {
+			ts = name[len(prefix):]
+		}
+		if ts, ok = strings.CutSuffix(ts, ext); !ok {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, ts, loc)
+		if err != nil {
+			continue
+		}
+		files = append(files, rolledFile{path: filepath.Join(dir, name), time: t})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].time.After(files[j].time) })
+	return files, nil
+}
+
+// mill deletes rolled files that exceed the retention
+// limits as of time now and compresses the remaining ones
+// if enabled.
+func (rf *rollingFile) mill(now time.Time) {
+	rf.millMu.Lock()
+	defer rf.millMu.Unlock()
+
+	files, err := rf.rolledFiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] listing rolled log files of %s: %v\n", rf.filename, err)
+		return
+	}
+	cutoff := now.Add(-rf.maxAge)
+	for i, f := range files {
+		if (rf.keep > 0 && i >= rf.keep) || (rf.maxAge > 0 && f.time.Before(cutoff)) {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "[ERROR] removing rolled log file: %v\n", err)
+			}
+			continue
+		}
+		if rf.compress && !strings.HasSuffix(f.path, ".gz") {
+			if err := rf.compressFile(f.path); err != nil {
+				fmt.Fprintf(os.Stderr, "[ERROR] compressing rolled log file: %v\n", err)
+			}
+		}
+	}
+}
+
+// compressFile replaces the file at path with
+// a gzipped copy of it at path + ".gz".
+func (rf *rollingFile) compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// write to a temporary file first, so that an interrupted
+	// compression never leaves a truncated archive behind
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, rf.mode)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Reopen closes the log file and opens it again by name,
+// so that writes go to a new file if the old one has been
+// moved away (e.g. by logrotate).
+func (rf *rollingFile) Reopen() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return os.ErrClosed
+	}
+	if rf.file != nil {
+		if err := rf.file.Close(); err != nil {
+			return err
+		}
+		rf.file = nil
+	}
+	return rf.open()
+}
+
+// Close closes the log file and waits for
+// background compression and pruning to finish.
+func (rf *rollingFile) Close() error {
+	rf.mu.Lock()
+	rf.closed = true
+	var err error
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.mu.Unlock()
+	rf.millWg.Wait()
+	return err
+}
+
+// Interface guards
+var (
+	_ uni.Provisioner    = (*FileWriter)(nil)
+	_ uni.WriterOpener   = (*FileWriter)(nil)
+	_ uni.WriterReopener = (*rollingFile)(nil)
+	_ json.Unmarshaler   = (*fileMode)(nil)
+	_ json.Marshaler     = (*fileMode)(nil)
+)
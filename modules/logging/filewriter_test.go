@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"uni"
+)
+
+// openTestFile opens a rolling file configured by fw in a
+// temporary directory, with a clock controlled by the test.
+func openTestFile(t *testing.T, fw FileWriter, clock *time.Time) *rollingFile {
+	t.Helper()
+	fw.Filename = filepath.Join(t.TempDir(), "audit.log")
+	if err := fw.Provision(uni.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := fw.OpenWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf := w.(*rollingFile)
+	rf.now = func() time.Time { return *clock }
+	t.Cleanup(func() { rf.Close() })
+	return rf
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFileWriterRollsBySize(t *testing.T) {
+	clock := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	noGzip := false
+	rf := openTestFile(t, FileWriter{RollKeep: 2, RollCompress: &noGzip}, &clock)
+	rf.maxSize = 10
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		clock = clock.Add(time.Second)
+	}
+	rf.Close()
+
+	dir := filepath.Dir(rf.filename)
+	expect := []string{
+		"audit-2025-01-02T15-04-07.000.log", // second
+		"audit-2025-01-02T15-04-08.000.log", // third
+		"audit.log",                         // fourth
+	}
+	if actual := listDir(t, dir); strings.Join(actual, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expected files %v, got %v", expect, actual)
+	}
+	contents, _ := os.ReadFile(filepath.Join(dir, expect[0]))
+	if string(contents) != "second\n" {
+		t.Errorf("expected oldest kept file to contain second line, got %q", contents)
+	}
+	contents, _ = os.ReadFile(rf.filename)
+	if string(contents) != "fourth\n" {
+		t.Errorf("expected current file to contain last line, got %q", contents)
+	}
+}
+
+func TestFileWriterRollsByInterval(t *testing.T) {
+	clock := time.Date(2025, 1, 2, 23, 59, 0, 0, time.UTC)
+	rf := openTestFile(t, FileWriter{RollInterval: uni.Duration(24 * time.Hour)}, &clock)
+
+	if _, err := rf.Write([]byte("before midnight\n")); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(30 * time.Second)
+	if _, err := rf.Write([]byte("still before midnight\n")); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(time.Minute)
+	if _, err := rf.Write([]byte("after midnight\n")); err != nil {
+		t.Fatal(err)
+	}
+	rf.Close()
+
+	rolled := filepath.Join(filepath.Dir(rf.filename), "audit-2025-01-03T00-00-30.000.log.gz")
+	f, err := os.Open(rolled)
+	if err != nil {
+		t.Fatalf("expected compressed rolled file: %v (have %v)", err, listDir(t, filepath.Dir(rf.filename)))
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, _ := io.ReadAll(gz)
+	if string(contents) != "before midnight\nstill before midnight\n" {
+		t.Errorf("unexpected rolled contents %q", contents)
+	}
+	contents, _ = os.ReadFile(rf.filename)
+	if string(contents) != "after midnight\n" {
+		t.Errorf("unexpected current contents %q", contents)
+	}
+}
+
+func TestFileWriterPrunesByAge(t *testing.T) {
+	clock := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	noGzip := false
+	rf := openTestFile(t, FileWriter{RollKeepDays: 7, RollCompress: &noGzip}, &clock)
+	rf.maxSize = 1
+
+	dir := filepath.Dir(rf.filename)
+	stale := filepath.Join(dir, "audit-2025-05-01T00-00-00.000.log.gz")
+	recent := filepath.Join(dir, "audit-2025-05-30T00-00-00.000.log.gz")
+	unrelated := filepath.Join(dir, "other-2025-05-01T00-00-00.000.log")
+	for _, name := range []string{stale, recent, unrelated} {
+		if err := os.WriteFile(name, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rf.Write([]byte("a"))
+	rf.Write([]byte("b"))
+	rf.Close()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale rolled file to be removed")
+	}
+	for _, name := range []string{recent, unrelated} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("expected %s to be kept: %v", filepath.Base(name), err)
+		}
+	}
+}
+
+func TestFileWriterReopen(t *testing.T) {
+	clock := time.Now()
+	rf := openTestFile(t, FileWriter{}, &clock)
+
+	rf.Write([]byte("before\n"))
+	moved := rf.filename + ".1"
+	if err := os.Rename(rf.filename, moved); err != nil {
+		t.Fatal(err)
+	}
+	rf.Write([]byte("still old\n"))
+	if err := rf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	rf.Write([]byte("after\n"))
+	rf.Close()
+
+	if contents, _ := os.ReadFile(moved); string(contents) != "before\nstill old\n" {
+		t.Errorf("unexpected contents of moved file %q", contents)
+	}
+	if contents, _ := os.ReadFile(rf.filename); string(contents) != "after\n" {
+		t.Errorf("unexpected contents of reopened file %q", contents)
+	}
+	if _, err := rf.Write([]byte("closed\n")); err == nil {
+		t.Error("expected write after close to fail")
+	}
+}
+
+func TestFileWriterMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+	var fw FileWriter
+	if err := json.Unmarshal([]byte(`{"mode": "0640"}`), &fw); err != nil {
+		t.Fatal(err)
+	}
+	if fw.Mode != 0o640 {
+		t.Fatalf("expected mode 0640, got %o", fw.Mode)
+	}
+	for _, bad := range []string{`{"mode": "0999"}`, `{"mode": "12345"}`, `{"mode": ""}`} {
+		if err := json.Unmarshal([]byte(bad), &fw); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+
+	clock := time.Now()
+	rf := openTestFile(t, fw, &clock)
+	info, err := os.Stat(rf.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("expected file mode 0640, got %o", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"uni"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	uni.RegisterModule(FilterEncoder{})
+}
+
+// FilterEncoder can filter (manipulate) fields on
+// log entries before they are actually encoded by
+// an underlying encoder. It can be used with any
+// log through its `encoder`, to redact or anonymize
+// the client addresses, domains, user names and such
+// that must not be stored as they are.
+type FilterEncoder struct {
+	// The underlying encoder that actually encodes the
+	// log entries. If not specified, defaults to "json".
+	WrappedRaw json.RawMessage `json:"wrap,omitempty" caddy:"namespace=uni.logging.encoders inline_key=format"`
+
+	// A map of field names to their filters. Note that this
+	// is not a module map; the keys are field names.
+	//
+	// Nested fields can be referenced by representing a
+	// layer of nesting with `>`. In other words, for an
+	// object like `{"a":{"b":0}}`, the inner field can
+	// be referenced as `a>b`.
+	//
+	// The following fields are fundamental to the log and
+	// cannot be filtered because they are added by the
+	// underlying logging library as special cases: ts,
+	// level, logger, and msg.
+	FieldsRaw map[string]json.RawMessage `json:"fields,omitempty" caddy:"namespace=uni.logging.encoders.filter inline_key=filter"`
+
+	wrapped zapcore.Encoder
+	Fields  map[string]LogFieldFilter `json:"-"`
+
+	// enc is where the fields are added to: the wrapped
+	// encoder, or the encoder of the object being filtered
+	enc zapcore.ObjectEncoder
+
+	// used to keep keys correct when nesting
+	keyPrefix string
+}
+
+// UniModule returns the Uni module information.
+func (FilterEncoder) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.filter",
+		New: func() uni.Module { return new(FilterEncoder) },
+	}
+}
+
+// Provision sets up the encoder.
+func (fe *FilterEncoder) Provision(ctx uni.Context) error {
+	for k, v := range fe.FieldsRaw {
+		if v == nil {
+			return fmt.Errorf("field %q: no filter configured", k)
+		}
+	}
+
+	if fe.WrappedRaw == nil {
+		// if wrap is not specified, default to JSON
+		je := new(JSONEncoder)
+		if err := je.Provision(ctx); err != nil {
+			return fmt.Errorf("provisioning fallback encoder module: %v", err)
+		}
+		fe.wrapped = je
+	} else {
+		// set up wrapped encoder
+		val, err := ctx.LoadModule(fe, "WrappedRaw")
+		if err != nil {
+			return fmt.Errorf("loading wrapped encoder module: %v", err)
+		}
+		fe.wrapped = val.(zapcore.Encoder)
+	}
+	fe.enc = fe.wrapped
+
+	// set up each field filter
+	if fe.Fields == nil {
+		fe.Fields = make(map[string]LogFieldFilter)
+	}
+	vals, err := ctx.LoadModule(fe, "FieldsRaw")
+	if err != nil {
+		return fmt.Errorf("loading log filter modules: %v", err)
+	}
+	for fieldName, modIface := range vals.(map[string]any) {
+		fe.Fields[fieldName] = modIface.(LogFieldFilter)
+	}
+
+	return nil
+}
+
+// nested returns an encoder that filters the
+// fields of the object key, which are added
+// to enc.
+func (fe *FilterEncoder) nested(key string, enc zapcore.ObjectEncoder) *FilterEncoder {
+	return &FilterEncoder{
+		Fields:    fe.Fields,
+		wrapped:   fe.wrapped,
+		enc:       enc,
+		keyPrefix: fe.keyPrefix + key + ">",
+	}
+}
+
+// AddArray is part of the zapcore.ObjectEncoder interface.
+// Array elements do not get filtered.
+func (fe *FilterEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	if !fe.filtered(key, marshaler) {
+		return fe.enc.AddArray(key, marshaler)
+	}
+	return nil
+}
+
+// AddObject is part of the zapcore.ObjectEncoder interface.
+// The fields of the object are filtered as well.
+func (fe *FilterEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	if fe.filtered(key, marshaler) {
+		return nil
+	}
+	return fe.enc.AddObject(key, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		return marshaler.MarshalLogObject(fe.nested(key, enc))
+	}))
+}
+
+// AddBinary is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddBinary(key string, value []byte) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddBinary(key, value)
+	}
+}
+
+// AddByteString is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddByteString(key string, value []byte) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddByteString(key, value)
+	}
+}
+
+// AddBool is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddBool(key string, value bool) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddBool(key, value)
+	}
+}
+
+// AddComplex128 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddComplex128(key string, value complex128) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddComplex128(key, value)
+	}
+}
+
+// AddComplex64 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddComplex64(key string, value complex64) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddComplex64(key, value)
+	}
+}
+
+// AddDuration is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddDuration(key string, value time.Duration) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddDuration(key, value)
+	}
+}
+
+// AddFloat64 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddFloat64(key string, value float64) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddFloat64(key, value)
+	}
+}
+
+// AddFloat32 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddFloat32(key string, value float32) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddFloat32(key, value)
+	}
+}
+
+// AddInt is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddInt(key string, value int) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddInt(key, value)
+	}
+}
+
+// AddInt64 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddInt64(key string, value int64) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddInt64(key, value)
+	}
+}
+
+// AddInt32 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddInt32(key string, value int32) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddInt32(key, value)
+	}
+}
+
+// AddInt16 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddInt16(key string, value int16) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddInt16(key, value)
+	}
+}
+
+// AddInt8 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddInt8(key string, value int8) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddInt8(key, value)
+	}
+}
+
+// AddString is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddString(key, value string) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddString(key, value)
+	}
+}
+
+// AddTime is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddTime(key string, value time.Time) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddTime(key, value)
+	}
+}
+
+// AddUint is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddUint(key string, value uint) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddUint(key, value)
+	}
+}
+
+// AddUint64 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddUint64(key string, value uint64) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddUint64(key, value)
+	}
+}
+
+// AddUint32 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddUint32(key string, value uint32) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddUint32(key, value)
+	}
+}
+
+// AddUint16 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddUint16(key string, value uint16) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddUint16(key, value)
+	}
+}
+
+// AddUint8 is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddUint8(key string, value uint8) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddUint8(key, value)
+	}
+}
+
+// AddUintptr is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddUintptr(key string, value uintptr) {
+	if !fe.filtered(key, value) {
+		fe.enc.AddUintptr(key, value)
+	}
+}
+
+// AddReflected is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) AddReflected(key string, value any) error {
+	if !fe.filtered(key, value) {
+		return fe.enc.AddReflected(key, value)
+	}
+	return nil
+}
+
+// OpenNamespace is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) OpenNamespace(key string) {
+	fe.keyPrefix += key + ">"
+	fe.enc.OpenNamespace(key)
+}
+
+// Clone is part of the zapcore.ObjectEncoder interface.
+func (fe *FilterEncoder) Clone() zapcore.Encoder {
+	wrapped := fe.wrapped.Clone()
+	return &FilterEncoder{
+		Fields:    fe.Fields,
+		wrapped:   wrapped,
+		enc:       wrapped,
+		keyPrefix: fe.keyPrefix,
+	}
+}
+
+// EncodeEntry partially implements the zapcore.Encoder interface.
+func (fe *FilterEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	// the fields of the entry are filtered into a clone,
+	// so that they are not kept by the encoder afterwards
+	clone := fe.Clone().(*FilterEncoder)
+	for _, field := range fields {
+		field.AddTo(clone)
+	}
+	return clone.wrapped.EncodeEntry(ent, nil)
+}
+
+// filtered returns true if the field was filtered.
+// If true is returned, the field was filtered and
+// added to the underlying encoder (so do not do
+// that again). If false was returned, the field has
+// not yet been added to the underlying encoder.
+func (fe *FilterEncoder) filtered(key string, value any) bool {
+	filter, ok := fe.Fields[fe.keyPrefix+key]
+	if !ok {
+		return false
+	}
+	filter.Filter(zap.Any(key, value)).AddTo(fe.enc)
+	return true
+}
+
+// Interface guards
+var (
+	_ zapcore.Encoder = (*FilterEncoder)(nil)
+	_ uni.Provisioner = (*FilterEncoder)(nil)
+)
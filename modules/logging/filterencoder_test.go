@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFilterEncoder(t *testing.T) {
+	out := logWith(t, new(FilterEncoder), `{
+		"wrap": {"format": "json", "time_key": ""},
+		"fields": {
+			"src_ip": {"filter": "ip_mask"},
+			"user": {"filter": "hash", "salt": "pepper", "length": 12},
+			"password": {"filter": "delete"},
+			"note": {"filter": "replace", "value": "REDACTED"},
+			"dst>host": {"filter": "regexp", "regexp": "^[^.]+\\.", "value": "*."},
+			"dst>addrs": {"filter": "ip_mask", "ipv4_cidr": 16, "ipv6_cidr": 32},
+			"dst>meta>token": {"filter": "delete"}
+		}
+	}`, func(l *zap.Logger) {
+		l.With(zap.String("src_ip", "203.0.113.77:5353")).Info("query",
+			zap.String("user", "alice"),
+			zap.String("password", "hunter2"),
+			zap.Int("note", 42),
+			zap.Dict("dst",
+				zap.String("host", "mail.example.com"),
+				zap.Strings("addrs", []string{"198.51.100.9", "[2001:db8:1234:5678::1]:443", "localhost"}),
+				zap.Dict("meta", zap.String("token", "secret"), zap.Int("ttl", 300))))
+	})
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	sum := sha256.Sum256([]byte("pepperalice"))
+	for key, expect := range map[string]any{
+		"src_ip": "203.0.113.0:5353",
+		"user":   hex.EncodeToString(sum[:])[:12],
+		"note":   "REDACTED",
+	} {
+		if entry[key] != expect {
+			t.Errorf("expected %s=%v, got %v (%s)", key, expect, entry[key], out)
+		}
+	}
+	if _, ok := entry["password"]; ok {
+		t.Errorf("expected password to be deleted: %s", out)
+	}
+
+	dst, _ := entry["dst"].(map[string]any)
+	if dst["host"] != "*.example.com" {
+		t.Errorf("expected nested host to be replaced, got %v (%s)", dst["host"], out)
+	}
+	addrs, _ := json.Marshal(dst["addrs"])
+	if expect := `["198.51.0.0","[2001:db8::]:443","localhost"]`; string(addrs) != expect {
+		t.Errorf("expected nested addresses %s, got %s", expect, addrs)
+	}
+	meta, _ := dst["meta"].(map[string]any)
+	if _, ok := meta["token"]; ok || meta["ttl"] != float64(300) {
+		t.Errorf("expected only the token of the nested object to be deleted: %s", out)
+	}
+}
+
+func TestFilterEncoderWrapsLogfmt(t *testing.T) {
+	out := logWith(t, new(FilterEncoder), `{
+		"wrap": {"format": "logfmt", "time_key": ""},
+		"fields": {"client": {"filter": "ip_mask"}}
+	}`, func(l *zap.Logger) {
+		l.Info("conn", zap.String("client", "2001:db8:aaaa:bbbb:cccc::1"))
+		l.Info("conn", zap.String("client", "10.1.2.3"))
+	})
+	expect := "level=info logger=router msg=conn client=2001:db8:aaaa:bbbb::\n" +
+		"level=info logger=router msg=conn client=10.1.2.0\n"
+	if out != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, out)
+	}
+}
+
+type testClient struct {
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+}
+
+func TestFilterEncoderNonStringFields(t *testing.T) {
+	out := logWith(t, new(FilterEncoder), `{
+		"wrap": {"format": "json", "time_key": ""},
+		"fields": {
+			"uid": {"filter": "hash"},
+			"client": {"filter": "ip_mask"},
+			"peer": {"filter": "ip_mask"},
+			"ok": {"filter": "regexp", "regexp": ".+", "value": "x"}
+		}
+	}`, func(l *zap.Logger) {
+		l.Info("conn",
+			zap.Int("uid", 1001),
+			zap.Dict("client", zap.String("ip", "203.0.113.77"), zap.Int("port", 5353)),
+			zap.Any("peer", testClient{IP: "198.51.100.9", Port: 443}),
+			zap.Bool("ok", true))
+	})
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	sum := sha256.Sum256([]byte("1001"))
+	if expect := hex.EncodeToString(sum[:])[:8]; entry["uid"] != expect {
+		t.Errorf("expected hashed uid %s, got %v (%s)", expect, entry["uid"], out)
+	}
+	for key, expect := range map[string]string{
+		"client": "203.0.113.0",
+		"peer":   "198.51.100.0",
+	} {
+		obj, _ := entry[key].(map[string]any)
+		if obj["ip"] != expect {
+			t.Errorf("expected the IP of %s to be masked to %s, got %v (%s)", key, expect, obj["ip"], out)
+		}
+	}
+	if entry["ok"] != "x" {
+		t.Errorf("expected the bool to be replaced, got %v (%s)", entry["ok"], out)
+	}
+}
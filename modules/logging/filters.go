@@ -0,0 +1,370 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+
+	"uni"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	uni.RegisterModule(DeleteFilter{})
+	uni.RegisterModule(HashFilter{})
+	uni.RegisterModule(ReplaceFilter{})
+	uni.RegisterModule(IPMaskFilter{})
+	uni.RegisterModule(RegexpFilter{})
+}
+
+// LogFieldFilter can filter (or manipulate)
+// a field in a log entry.
+type LogFieldFilter interface {
+	Filter(zapcore.Field) zapcore.Field
+}
+
+// DeleteFilter is a Uni log field filter that
+// deletes the field.
+type DeleteFilter struct{}
+
+// UniModule returns the Uni module information.
+func (DeleteFilter) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.filter.delete",
+		New: func() uni.Module { return new(DeleteFilter) },
+	}
+}
+
+// Filter filters the input field.
+func (DeleteFilter) Filter(in zapcore.Field) zapcore.Field {
+	in.Type = zapcore.SkipType
+	return in
+}
+
+// HashFilter is a Uni log field filter that replaces the
+// field with a prefix of the hex-encoded SHA-256 hash of
+// the salt and its value, so that entries of the same user
+// or client can be correlated without storing who they are.
+// Arrays and objects have each of their values hashed; other
+// values, like numbers, are hashed as strings.
+type HashFilter struct {
+	// The salt that is hashed before the value. Without a
+	// secret salt, short values like IPv4 addresses can be
+	// recovered from their hash by brute force, so it is
+	// best set from the environment, e.g. "{env.LOG_SALT}".
+	Salt string `json:"salt,omitempty"`
+
+	// The number of hex digits of the hash to keep,
+	// from 1 to 64. Default: 8
+	Length int `json:"length,omitempty"`
+}
+
+// UniModule returns the Uni module information.
+func (HashFilter) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.filter.hash",
+		New: func() uni.Module { return new(HashFilter) },
+	}
+}
+
+// Provision sets up the filter.
+func (f *HashFilter) Provision(_ uni.Context) error {
+	if f.Length == 0 {
+		f.Length = 8
+	}
+	if f.Length < 0 || f.Length > 2*sha256.Size {
+		return fmt.Errorf("hash length must be from 1 to %d, got %d", 2*sha256.Size, f.Length)
+	}
+	return nil
+}
+
+// Filter filters the input field.
+func (f HashFilter) Filter(in zapcore.Field) zapcore.Field {
+	return filterStrings(in, f.hash)
+}
+
+// hash returns the hash prefix of s.
+func (f HashFilter) hash(s string) string {
+	if s == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(f.Salt + s))
+	return hex.EncodeToString(sum[:])[:f.Length]
+}
+
+// ReplaceFilter is a Uni log field filter that
+// replaces the field with the indicated string.
+type ReplaceFilter struct {
+	Value string `json:"value,omitempty"`
+}
+
+// UniModule returns the Uni module information.
+func (ReplaceFilter) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.filter.replace",
+		New: func() uni.Module { return new(ReplaceFilter) },
+	}
+}
+
+// Filter filters the input field with the replacement value.
+func (f *ReplaceFilter) Filter(in zapcore.Field) zapcore.Field {
+	return zap.String(in.Key, f.Value)
+}
+
+// IPMaskFilter is a Uni log field filter that masks IP
+// addresses in a string, or in each value of an array or
+// object. The string may be a comma-separated list of IP
+// addresses, which may have ports, like "203.0.113.7:53,
+// [2001:db8::1]:53"; values that are not IP addresses are
+// left as they are, as strings.
+type IPMaskFilter struct {
+	// The IPv4 prefix length to keep. Default: 24
+	IPv4MaskRaw int `json:"ipv4_cidr,omitempty"`
+
+	// The IPv6 prefix length to keep. Default: 64
+	IPv6MaskRaw int `json:"ipv6_cidr,omitempty"`
+}
+
+// UniModule returns the Uni module information.
+func (IPMaskFilter) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.filter.ip_mask",
+		New: func() uni.Module { return new(IPMaskFilter) },
+	}
+}
+
+// Provision sets up the filter.
+func (m *IPMaskFilter) Provision(_ uni.Context) error {
+	if m.IPv4MaskRaw == 0 {
+		m.IPv4MaskRaw = 24
+	}
+	if m.IPv6MaskRaw == 0 {
+		m.IPv6MaskRaw = 64
+	}
+	if m.IPv4MaskRaw < 0 || m.IPv4MaskRaw > 32 {
+		return fmt.Errorf("ipv4_cidr must be from 0 to 32, got %d", m.IPv4MaskRaw)
+	}
+	if m.IPv6MaskRaw < 0 || m.IPv6MaskRaw > 128 {
+		return fmt.Errorf("ipv6_cidr must be from 0 to 128, got %d", m.IPv6MaskRaw)
+	}
+	return nil
+}
+
+// Filter filters the input field.
+func (m IPMaskFilter) Filter(in zapcore.Field) zapcore.Field {
+	return filterStrings(in, m.mask)
+}
+
+// mask returns s with the IP addresses in it masked.
+func (m IPMaskFilter) mask(s string) string {
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		value := strings.TrimSpace(part)
+		host, port, err := net.SplitHostPort(value)
+		if err != nil {
+			host = value // no port
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			continue
+		}
+		bits := m.IPv6MaskRaw
+		if addr.Is4() || addr.Is4In6() {
+			addr = addr.Unmap()
+			bits = m.IPv4MaskRaw
+		}
+		prefix, err := addr.WithZone("").Prefix(bits)
+		if err != nil {
+			continue
+		}
+		masked := prefix.Addr().String()
+		if port != "" {
+			masked = net.JoinHostPort(masked, port)
+		}
+		parts[i] = strings.Replace(part, value, masked, 1)
+	}
+	return strings.Join(parts, ",")
+}
+
+// RegexpFilter is a Uni log field filter that replaces
+// the parts of the field that match a regular expression
+// with the indicated string, in which `$1` and `${name}`
+// expand to the submatches. Arrays and objects have each
+// of their values replaced; other values, like numbers,
+// are matched as strings.
+type RegexpFilter struct {
+	// The regular expression pattern defining what to replace.
+	RawRegexp string `json:"regexp,omitempty"`
+
+	// The value to use as replacement
+	Value string `json:"value,omitempty"`
+
+	regexp *regexp.Regexp
+}
+
+// UniModule returns the Uni module information.
+func (RegexpFilter) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.filter.regexp",
+		New: func() uni.Module { return new(RegexpFilter) },
+	}
+}
+
+// Provision compiles m's regexp.
+func (m *RegexpFilter) Provision(_ uni.Context) error {
+	r, err := regexp.Compile(m.RawRegexp)
+	if err != nil {
+		return fmt.Errorf("compiling regexp: %v", err)
+	}
+	m.regexp = r
+	return nil
+}
+
+// Filter filters the input field.
+func (m *RegexpFilter) Filter(in zapcore.Field) zapcore.Field {
+	return filterStrings(in, func(s string) string {
+		return m.regexp.ReplaceAllString(s, m.Value)
+	})
+}
+
+// filterStrings returns the field with filter applied to its
+// string value. Fields of other types are filtered in their
+// encoded form, so that no value passes unfiltered: arrays and
+// objects have filter applied to each of their values, and
+// other values, like numbers, to their string, e.g. a hashed
+// integer is written as the string of its hash. Fields that
+// cannot be encoded are deleted.
+func filterStrings(in zapcore.Field, filter func(string) string) zapcore.Field {
+	switch in.Type {
+	case zapcore.SkipType:
+		return in
+	case zapcore.StringType:
+		in.String = filter(in.String)
+		return in
+	case zapcore.ByteStringType:
+		return zap.String(in.Key, filter(string(in.Interface.([]byte))))
+	case zapcore.StringerType:
+		return zap.String(in.Key, filter(in.Interface.(fmt.Stringer).String()))
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	in.AddTo(enc)
+	if in.Type == zapcore.InlineMarshalerType {
+		fields, _ := filterValue(enc.Fields, filter).(map[string]any)
+		return zap.Inline(filteredObject(fields))
+	}
+	value, ok := enc.Fields[in.Key]
+	if !ok {
+		// encoding failed; see zapcore.Field.AddTo
+		in.Type = zapcore.SkipType
+		return in
+	}
+	switch filtered := filterValue(value, filter).(type) {
+	case string:
+		return zap.String(in.Key, filtered)
+	case []any:
+		values := make([]string, len(filtered))
+		for i, elem := range filtered {
+			s, ok := elem.(string)
+			if !ok {
+				return zap.Any(in.Key, filtered)
+			}
+			values[i] = s
+		}
+		return zap.Strings(in.Key, values)
+	case nil:
+		return zap.Skip()
+	default:
+		return zap.Any(in.Key, filtered)
+	}
+}
+
+// filterValue returns v, a value encoded by a
+// zapcore.MapObjectEncoder, with filter applied
+// to every value in it.
+func filterValue(v any, filter func(string) string) any {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return filter(val)
+	case json.Number:
+		return filter(val.String())
+	case []any:
+		out := make([]any, len(val))
+		for i, elem := range val {
+			out[i] = filterValue(elem, filter)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for key, elem := range val {
+			out[key] = filterValue(elem, filter)
+		}
+		return out
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		uintptr, float32, float64, complex64, complex128, time.Time, time.Duration:
+		return filter(fmt.Sprint(val))
+	}
+
+	// a reflected value; filter its JSON form
+	b, err := json.Marshal(v)
+	if err != nil {
+		return filter(fmt.Sprint(v))
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var decoded any
+	if err := dec.Decode(&decoded); err != nil {
+		return filter(string(b))
+	}
+	return filterValue(decoded, filter)
+}
+
+// filteredObject is a filtered inline object.
+type filteredObject map[string]any
+
+// MarshalLogObject satisfies the zapcore.ObjectMarshaler interface.
+func (o filteredObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for key, value := range o {
+		zap.Any(key, value).AddTo(enc)
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ LogFieldFilter = (*DeleteFilter)(nil)
+	_ LogFieldFilter = (*HashFilter)(nil)
+	_ LogFieldFilter = (*ReplaceFilter)(nil)
+	_ LogFieldFilter = (*IPMaskFilter)(nil)
+	_ LogFieldFilter = (*RegexpFilter)(nil)
+
+	_ uni.Provisioner = (*HashFilter)(nil)
+	_ uni.Provisioner = (*IPMaskFilter)(nil)
+	_ uni.Provisioner = (*RegexpFilter)(nil)
+)
@@ -0,0 +1,414 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"uni"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	uni.RegisterModule(LogfmtEncoder{})
+}
+
+// LogfmtEncoder encodes log entries as logfmt: one line of
+// space-separated key=value pairs per entry, e.g.
+//
+//	ts=2025-01-02T15:04:05Z level=info logger=admin msg="config loaded" apps=3
+//
+// Values are quoted if they contain spaces, quotes, equal signs
+// or control characters. Fields of nested objects are flattened
+// into dotted keys; arrays are written as comma-separated lists.
+type LogfmtEncoder struct {
+	zapcore.Encoder `json:"-"`
+	LogEncoderConfig
+}
+
+// UniModule returns the Uni module information.
+func (LogfmtEncoder) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.logfmt",
+		New: func() uni.Module { return new(LogfmtEncoder) },
+	}
+}
+
+// Provision sets up the encoder.
+func (le *LogfmtEncoder) Provision(_ uni.Context) error {
+	if le.TimeFormat == "" {
+		le.TimeFormat = "rfc3339_nano"
+	}
+	if le.DurationFormat == "" {
+		le.DurationFormat = "string"
+	}
+	le.Encoder = le.wrap(newLogfmtEncoder(le.ZapcoreEncoderConfig()))
+	return nil
+}
+
+var logfmtPool = buffer.NewPool()
+
+// logfmtEncoder is a zapcore.Encoder that writes logfmt.
+type logfmtEncoder struct {
+	cfg    *zapcore.EncoderConfig
+	buf    *buffer.Buffer // the encoded context fields
+	prefix string         // the keys of the open namespaces
+}
+
+func newLogfmtEncoder(cfg zapcore.EncoderConfig) *logfmtEncoder {
+	return &logfmtEncoder{cfg: &cfg, buf: logfmtPool.Get()}
+}
+
+// Clone implements zapcore.Encoder.
+func (enc *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := &logfmtEncoder{cfg: enc.cfg, buf: logfmtPool.Get(), prefix: enc.prefix}
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+// EncodeEntry implements zapcore.Encoder.
+func (enc *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := &logfmtEncoder{cfg: enc.cfg, buf: logfmtPool.Get()}
+	cfg := enc.cfg
+
+	if cfg.TimeKey != "" && cfg.EncodeTime != nil {
+		final.addEncoded(cfg.TimeKey, func(ae zapcore.ArrayEncoder) { cfg.EncodeTime(ent.Time, ae) })
+	}
+	if cfg.LevelKey != "" && cfg.EncodeLevel != nil {
+		final.addEncoded(cfg.LevelKey, func(ae zapcore.ArrayEncoder) { cfg.EncodeLevel(ent.Level, ae) })
+	}
+	if cfg.NameKey != "" && ent.LoggerName != "" {
+		nameEncoder := cfg.EncodeName
+		if nameEncoder == nil {
+			nameEncoder = zapcore.FullNameEncoder
+		}
+		final.addEncoded(cfg.NameKey, func(ae zapcore.ArrayEncoder) { nameEncoder(ent.LoggerName, ae) })
+	}
+	if ent.Caller.Defined {
+		if cfg.CallerKey != "" && cfg.EncodeCaller != nil {
+			final.addEncoded(cfg.CallerKey, func(ae zapcore.ArrayEncoder) { cfg.EncodeCaller(ent.Caller, ae) })
+		}
+		if cfg.FunctionKey != "" {
+			final.AddString(cfg.FunctionKey, ent.Caller.Function)
+		}
+	}
+	if cfg.MessageKey != "" {
+		final.AddString(cfg.MessageKey, ent.Message)
+	}
+
+	if enc.buf.Len() > 0 {
+		if final.buf.Len() > 0 {
+			final.buf.AppendByte(' ')
+		}
+		final.buf.Write(enc.buf.Bytes())
+	}
+	final.prefix = enc.prefix
+	for _, field := range fields {
+		field.AddTo(final)
+	}
+	final.prefix = ""
+
+	if ent.Stack != "" && cfg.StacktraceKey != "" {
+		final.AddString(cfg.StacktraceKey, ent.Stack)
+	}
+	if cfg.LineEnding != "" {
+		final.buf.AppendString(cfg.LineEnding)
+	} else {
+		final.buf.AppendString(zapcore.DefaultLineEnding)
+	}
+	return final.buf, nil
+}
+
+// addKey starts a new key=value pair.
+func (enc *logfmtEncoder) addKey(key string) {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+	appendLogfmtKey(enc.buf, enc.prefix+key)
+	enc.buf.AppendByte('=')
+}
+
+// addEncoded adds the value that encode appends, using the
+// encoder functions of the config (e.g. for time and level).
+func (enc *logfmtEncoder) addEncoded(key string, encode func(zapcore.ArrayEncoder)) {
+	values := &logfmtArrayEncoder{cfg: enc.cfg}
+	encode(values)
+	enc.addKey(key)
+	appendLogfmtValue(enc.buf, values.String())
+}
+
+// AddArray is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	values := &logfmtArrayEncoder{cfg: enc.cfg}
+	err := marshaler.MarshalLogArray(values)
+	enc.addKey(key)
+	appendLogfmtValue(enc.buf, values.String())
+	return err
+}
+
+// AddObject is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	prefix := enc.prefix
+	enc.prefix += key + "."
+	err := marshaler.MarshalLogObject(enc)
+	enc.prefix = prefix
+	return err
+}
+
+// AddBinary is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddBinary(key string, value []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(value))
+}
+
+// AddByteString is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddByteString(key string, value []byte) {
+	enc.AddString(key, string(value))
+}
+
+// AddBool is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddBool(key string, value bool) {
+	enc.addKey(key)
+	enc.buf.AppendBool(value)
+}
+
+// AddComplex128 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddComplex128(key string, value complex128) {
+	enc.addKey(key)
+	enc.buf.AppendString(strconv.FormatComplex(value, 'g', -1, 128))
+}
+
+// AddComplex64 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddComplex64(key string, value complex64) {
+	enc.addKey(key)
+	enc.buf.AppendString(strconv.FormatComplex(complex128(value), 'g', -1, 64))
+}
+
+// AddDuration is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddDuration(key string, value time.Duration) {
+	if enc.cfg.EncodeDuration == nil {
+		enc.AddInt64(key, int64(value))
+		return
+	}
+	enc.addEncoded(key, func(ae zapcore.ArrayEncoder) { enc.cfg.EncodeDuration(value, ae) })
+}
+
+// AddFloat64 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddFloat64(key string, value float64) {
+	enc.addKey(key)
+	enc.buf.AppendFloat(value, 64)
+}
+
+// AddFloat32 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddFloat32(key string, value float32) {
+	enc.addKey(key)
+	enc.buf.AppendFloat(float64(value), 32)
+}
+
+// AddInt is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddInt(key string, value int) { enc.AddInt64(key, int64(value)) }
+
+// AddInt64 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddInt64(key string, value int64) {
+	enc.addKey(key)
+	enc.buf.AppendInt(value)
+}
+
+// AddInt32 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddInt32(key string, value int32) { enc.AddInt64(key, int64(value)) }
+
+// AddInt16 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddInt16(key string, value int16) { enc.AddInt64(key, int64(value)) }
+
+// AddInt8 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddInt8(key string, value int8) { enc.AddInt64(key, int64(value)) }
+
+// AddString is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddString(key, value string) {
+	enc.addKey(key)
+	appendLogfmtValue(enc.buf, value)
+}
+
+// AddTime is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddTime(key string, value time.Time) {
+	if enc.cfg.EncodeTime == nil {
+		enc.AddString(key, value.Format(time.RFC3339Nano))
+		return
+	}
+	enc.addEncoded(key, func(ae zapcore.ArrayEncoder) { enc.cfg.EncodeTime(value, ae) })
+}
+
+// AddUint is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddUint(key string, value uint) { enc.AddUint64(key, uint64(value)) }
+
+// AddUint64 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddUint64(key string, value uint64) {
+	enc.addKey(key)
+	enc.buf.AppendUint(value)
+}
+
+// AddUint32 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddUint32(key string, value uint32) { enc.AddUint64(key, uint64(value)) }
+
+// AddUint16 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddUint16(key string, value uint16) { enc.AddUint64(key, uint64(value)) }
+
+// AddUint8 is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddUint8(key string, value uint8) { enc.AddUint64(key, uint64(value)) }
+
+// AddUintptr is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddUintptr(key string, value uintptr) { enc.AddUint64(key, uint64(value)) }
+
+// AddReflected is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) AddReflected(key string, value any) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	enc.AddString(key, string(b))
+	return nil
+}
+
+// OpenNamespace is part of the zapcore.ObjectEncoder interface.
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.prefix += key + "."
+}
+
+// logfmtArrayEncoder collects the elements of an array,
+// which are written as a comma-separated list.
+type logfmtArrayEncoder struct {
+	cfg   *zapcore.EncoderConfig
+	elems []string
+}
+
+func (ae *logfmtArrayEncoder) String() string { return strings.Join(ae.elems, ",") }
+
+func (ae *logfmtArrayEncoder) AppendArray(marshaler zapcore.ArrayMarshaler) error {
+	nested := &logfmtArrayEncoder{cfg: ae.cfg}
+	err := marshaler.MarshalLogArray(nested)
+	ae.elems = append(ae.elems, "["+nested.String()+"]")
+	return err
+}
+
+func (ae *logfmtArrayEncoder) AppendObject(marshaler zapcore.ObjectMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	if err := marshaler.MarshalLogObject(m); err != nil {
+		return err
+	}
+	return ae.AppendReflected(m.Fields)
+}
+
+func (ae *logfmtArrayEncoder) AppendReflected(value any) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	ae.elems = append(ae.elems, string(b))
+	return nil
+}
+
+func (ae *logfmtArrayEncoder) AppendDuration(value time.Duration) {
+	if ae.cfg == nil || ae.cfg.EncodeDuration == nil {
+		ae.AppendInt64(int64(value))
+		return
+	}
+	ae.cfg.EncodeDuration(value, ae)
+}
+
+func (ae *logfmtArrayEncoder) AppendTime(value time.Time) {
+	if ae.cfg == nil || ae.cfg.EncodeTime == nil {
+		ae.AppendString(value.Format(time.RFC3339Nano))
+		return
+	}
+	ae.cfg.EncodeTime(value, ae)
+}
+
+func (ae *logfmtArrayEncoder) AppendBool(v bool)         { ae.AppendString(strconv.FormatBool(v)) }
+func (ae *logfmtArrayEncoder) AppendByteString(v []byte) { ae.AppendString(string(v)) }
+func (ae *logfmtArrayEncoder) AppendComplex128(v complex128) {
+	ae.AppendString(strconv.FormatComplex(v, 'g', -1, 128))
+}
+func (ae *logfmtArrayEncoder) AppendComplex64(v complex64) {
+	ae.AppendString(strconv.FormatComplex(complex128(v), 'g', -1, 64))
+}
+func (ae *logfmtArrayEncoder) AppendFloat64(v float64) {
+	ae.AppendString(strconv.FormatFloat(v, 'g', -1, 64))
+}
+func (ae *logfmtArrayEncoder) AppendFloat32(v float32) {
+	ae.AppendString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+}
+func (ae *logfmtArrayEncoder) AppendInt(v int)         { ae.AppendInt64(int64(v)) }
+func (ae *logfmtArrayEncoder) AppendInt64(v int64)     { ae.AppendString(strconv.FormatInt(v, 10)) }
+func (ae *logfmtArrayEncoder) AppendInt32(v int32)     { ae.AppendInt64(int64(v)) }
+func (ae *logfmtArrayEncoder) AppendInt16(v int16)     { ae.AppendInt64(int64(v)) }
+func (ae *logfmtArrayEncoder) AppendInt8(v int8)       { ae.AppendInt64(int64(v)) }
+func (ae *logfmtArrayEncoder) AppendString(v string)   { ae.elems = append(ae.elems, v) }
+func (ae *logfmtArrayEncoder) AppendUint(v uint)       { ae.AppendUint64(uint64(v)) }
+func (ae *logfmtArrayEncoder) AppendUint64(v uint64)   { ae.AppendString(strconv.FormatUint(v, 10)) }
+func (ae *logfmtArrayEncoder) AppendUint32(v uint32)   { ae.AppendUint64(uint64(v)) }
+func (ae *logfmtArrayEncoder) AppendUint16(v uint16)   { ae.AppendUint64(uint64(v)) }
+func (ae *logfmtArrayEncoder) AppendUint8(v uint8)     { ae.AppendUint64(uint64(v)) }
+func (ae *logfmtArrayEncoder) AppendUintptr(v uintptr) { ae.AppendUint64(uint64(v)) }
+
+// appendLogfmtKey appends key, with the characters that
+// are not allowed in logfmt keys replaced by underscores.
+func appendLogfmtKey(buf *buffer.Buffer, key string) {
+	if key == "" {
+		buf.AppendByte('_')
+		return
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			r = '_'
+		}
+		buf.AppendString(string(r))
+	}
+}
+
+// appendLogfmtValue appends value, quoted if necessary.
+func appendLogfmtValue(buf *buffer.Buffer, value string) {
+	if logfmtNeedsQuoting(value) {
+		buf.AppendString(strconv.Quote(value))
+		return
+	}
+	buf.AppendString(value)
+}
+
+func logfmtNeedsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Interface guards
+var (
+	_ zapcore.Encoder      = (*LogfmtEncoder)(nil)
+	_ zapcore.Encoder      = (*logfmtEncoder)(nil)
+	_ zapcore.ArrayEncoder = (*logfmtArrayEncoder)(nil)
+	_ uni.Provisioner      = (*LogfmtEncoder)(nil)
+)
@@ -16,10 +16,20 @@
 package logging
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
 	"uni"
 )
 
@@ -28,10 +38,13 @@ func init() {
 }
 
 // NetWriter implements a log writer that outputs to a network socket. If
-// the socket goes down, it will dump logs to stderr while it attempts to
-// reconnect.
+// the socket goes down, it will dump logs to stderr (or to a disk spool,
+// if configured) while it attempts to reconnect.
 type NetWriter struct {
-	// The address of the network socket to which to connect.
+	// The address of the network socket to which to connect. The
+	// network may be tcp, udp, unix or unixgram (or their variants);
+	// "tcp+tls" connects over TCP with TLS, e.g.
+	// "tcp+tls/logs.example.com:6514".
 	Address string `json:"address,omitempty"`
 
 	// The timeout to wait while connecting to the socket.
@@ -42,10 +55,85 @@ type NetWriter struct {
 	// to stderr instead until a connection can be re-established.
 	SoftStart bool `json:"soft_start,omitempty"`
 
-	addr uni.NetworkAddress
+	// Configures TLS for "tcp+tls" addresses.
+	TLS *NetWriterTLS `json:"tls,omitempty"`
+
+	// If set, each log entry is sent as an RFC 5424 syslog
+	// message. Over stream sockets, messages are framed by octet
+	// counting (RFC 6587); over datagram sockets, each message is
+	// sent in its own datagram (RFC 5426).
+	Syslog *SyslogFormat `json:"syslog,omitempty"`
+
+	// If set, log entries that cannot be sent while the socket is
+	// down are stored on disk, and sent in order as soon as the
+	// connection is re-established (even after a restart), instead
+	// of being dumped to stderr.
+	Spool *NetWriterSpool `json:"spool,omitempty"`
+
+	addr      uni.NetworkAddress
+	network   string // the network to dial
+	tlsConfig *tls.Config
+}
+
+// NetWriterTLS configures the TLS client of a NetWriter.
+type NetWriterTLS struct {
+	// PEM files of the root certificate authorities to trust
+	// when verifying the server's certificate. By default,
+	// the system roots are trusted. Like the client certificate
+	// files, they may be given as fs_name:path.
+	RootCAPEMFiles []string `json:"root_ca_pem_files,omitempty"`
+
+	// A PEM-encoded client certificate and its key, presented
+	// to servers that require client authentication.
+	ClientCertificateFile    string `json:"client_certificate_file,omitempty"`
+	ClientCertificateKeyFile string `json:"client_certificate_key_file,omitempty"`
+
+	// The server name to verify the server's certificate against
+	// and to send in the SNI extension. By default, the host of
+	// the address.
+	ServerName string `json:"server_name,omitempty"`
+
+	// If true, the server's certificate is not verified. This
+	// makes TLS susceptible to man-in-the-middle attacks, so
+	// use it only for testing.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// SyslogFormat configures the header of RFC 5424 syslog messages.
+// The severity of a message is derived from the "level" field of
+// JSON-encoded log entries; other entries are sent as "info".
+type SyslogFormat struct {
+	// The facility, by keyword (e.g. "daemon", "local0") or
+	// number. Default: "daemon"
+	Facility string `json:"facility,omitempty"`
+
+	// The APP-NAME of the messages. Default: "guard"
+	AppName string `json:"app_name,omitempty"`
+
+	// The HOSTNAME of the messages. Default: the host name
+	// reported by the operating system.
+	Hostname string `json:"hostname,omitempty"`
+
+	// The MSGID of the messages, if any.
+	MsgID string `json:"msg_id,omitempty"`
+
+	facility int
 }
 
-// CaddyModule returns the Caddy module information.
+// NetWriterSpool configures the disk spool of a NetWriter.
+type NetWriterSpool struct {
+	// The file in which to store unsent log entries. Default:
+	// a file named after the address in the "log_spool" folder
+	// of the data directory.
+	Path string `json:"path,omitempty"`
+
+	// The maximum size of the spool. Log entries that do not fit
+	// are dropped, and how many were dropped is reported once the
+	// spool has been sent. Default: 100 MB
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+}
+
+// UniModule returns the Uni module information.
 func (NetWriter) UniModule() uni.ModuleInfo {
 	return uni.ModuleInfo{
 		ID:  "uni.logging.writers.net",
@@ -53,26 +141,254 @@ func (NetWriter) UniModule() uni.ModuleInfo {
 	}
 }
 
+// Provision sets up the module.
+func (nw *NetWriter) Provision(ctx uni.Context) error {
+	repl := uni.NewReplacer()
+	address, err := repl.ReplaceOrErr(nw.Address, true, true)
+	if err != nil {
+		return fmt.Errorf("invalid host in address: %v", err)
+	}
+
+	nw.addr, err = uni.ParseNetworkAddress(address)
+	if err != nil {
+		return fmt.Errorf("parsing network address '%s': %v", address, err)
+	}
+
+	if nw.addr.PortRangeSize() != 1 {
+		return fmt.Errorf("multiple ports not supported")
+	}
+
+	nw.network = nw.addr.Network
+	if network, ok := strings.CutSuffix(nw.network, "+tls"); ok {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return fmt.Errorf("TLS is not supported over %s", network)
+		}
+		nw.network = network
+		nw.tlsConfig, err = nw.TLS.makeTLSConfig(ctx, nw.addr.Host)
+		if err != nil {
+			return fmt.Errorf("setting up TLS: %v", err)
+		}
+	} else if nw.TLS != nil {
+		return fmt.Errorf("TLS is configured, but the network of the address is not tcp+tls")
+	}
+
+	if nw.DialTimeout < 0 {
+		return fmt.Errorf("timeout cannot be less than 0")
+	}
+	if nw.DialTimeout == 0 {
+		nw.DialTimeout = uni.Duration(10 * time.Second)
+	}
+
+	if nw.Syslog != nil {
+		if err := nw.Syslog.provision(); err != nil {
+			return fmt.Errorf("syslog: %v", err)
+		}
+	}
+
+	if nw.Spool != nil {
+		if nw.Spool.MaxSizeMB < 0 {
+			return fmt.Errorf("spool size cannot be less than 0")
+		}
+		if nw.Spool.MaxSizeMB == 0 {
+			nw.Spool.MaxSizeMB = 100
+		}
+		if nw.Spool.Path == "" {
+			name := strings.NewReplacer("/", "_", ":", "_", "[", "", "]", "").Replace(nw.addr.String())
+			nw.Spool.Path = filepath.Join(uni.AppDataDir(), "log_spool", name+".spool")
+		}
+	}
+
+	return nil
+}
+
 func (nw NetWriter) String() string {
 	return nw.addr.String()
 }
 
 // WriterKey returns a unique key representing this nw.
-func (nw NetWriter) Writerkey() string {
+func (nw NetWriter) WriterKey() string {
 	return nw.addr.String()
 }
 
-// UnmarshalCaddyfile sets up the handler from Caddyfile tokens. Syntax:
-//
-//	net <address> {
-//	    dial_timeout <duration>
-//	    soft_start
-//	}
-// func (nw *NetWriter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error
+// OpenWriter opens a new network connection.
+func (nw NetWriter) OpenWriter() (io.WriteCloser, error) {
+	reconn := &reDialerConn{
+		nw:      nw,
+		timeout: time.Duration(nw.DialTimeout),
+	}
+	if nw.Spool != nil {
+		spool, err := openDiskSpool(nw.Spool.Path, int64(nw.Spool.MaxSizeMB)*1024*1024)
+		if err != nil {
+			return nil, fmt.Errorf("opening spool: %v", err)
+		}
+		reconn.spool = spool
+	}
+	conn, err := reconn.dial()
+	if err != nil {
+		if !nw.SoftStart {
+			reconn.closeSpool()
+			return nil, err
+		}
+		// don't block config load if remote is down or some other external problem;
+		// we can dump logs to stderr (or the spool) for now (see issue #5520)
+		fmt.Fprintf(os.Stderr, "[ERROR] net log writer failed to connect: %v (will retry connection and print errors here in the meantime)\n", err)
+		return reconn, nil
+	}
+	reconn.Conn = conn
+	// entries spooled by a previous run go out first
+	if err := reconn.replay(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] net log writer failed to send spooled logs: %v\n", err)
+	}
+	return reconn, nil
+}
+
+// makeTLSConfig returns the TLS client config for
+// connecting to host. The files are resolved with ctx,
+// so they may be given as fs_name:path.
+func (t *NetWriterTLS) makeTLSConfig(ctx uni.Context, host string) (*tls.Config, error) {
+	if t == nil {
+		t = new(NetWriterTLS)
+	}
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify, //nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if len(t.RootCAPEMFiles) > 0 {
+		pool := x509.NewCertPool()
+		for _, file := range t.RootCAPEMFiles {
+			pem, err := ctx.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("reading root CA file: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in root CA file %s", file)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+	if t.ClientCertificateFile != "" || t.ClientCertificateKeyFile != "" {
+		if t.ClientCertificateFile == "" || t.ClientCertificateKeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must both be set")
+		}
+		certPEM, err := ctx.ReadFile(t.ClientCertificateFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client certificate: %v", err)
+		}
+		keyPEM, err := ctx.ReadFile(t.ClientCertificateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client certificate key: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// syslogFacilities maps the facility keywords of RFC 5424
+// (and their common names) to their numbers.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+func (s *SyslogFormat) provision() error {
+	if s.Facility == "" {
+		s.Facility = "daemon"
+	}
+	if n, ok := syslogFacilities[strings.ToLower(s.Facility)]; ok {
+		s.facility = n
+	} else if n, err := strconv.Atoi(s.Facility); err == nil && n >= 0 && n <= 23 {
+		s.facility = n
+	} else {
+		return fmt.Errorf("unknown facility: %s", s.Facility)
+	}
+	if s.AppName == "" {
+		s.AppName = "guard"
+	}
+	if s.Hostname == "" {
+		s.Hostname, _ = os.Hostname()
+	}
+	for name, value := range map[string]*string{
+		"app_name": &s.AppName,
+		"hostname": &s.Hostname,
+		"msg_id":   &s.MsgID,
+	} {
+		if strings.ContainsFunc(*value, func(r rune) bool { return r <= ' ' || r > '~' }) {
+			return fmt.Errorf("%s must consist of printable ASCII characters without spaces: %q", name, *value)
+		}
+	}
+	return nil
+}
 
-// TODO
-// I'm not sure, if this is necessary
-// func (nw *NetWriter)UnmarshalJSONFile() error
+// syslogSeverities maps log levels to syslog severities.
+var syslogSeverities = map[string]int{
+	"debug":  7,
+	"info":   6,
+	"warn":   4,
+	"error":  3,
+	"dpanic": 2,
+	"panic":  2,
+	"fatal":  1,
+}
+
+// syslogSeverity returns the severity of the log entry b.
+func syslogSeverity(b []byte) int {
+	if len(b) > 0 && b[0] == '{' {
+		var entry struct {
+			Level string `json:"level"`
+		}
+		if json.Unmarshal(b, &entry) == nil {
+			if sev, ok := syslogSeverities[strings.ToLower(entry.Level)]; ok {
+				return sev
+			}
+		}
+	}
+	return syslogSeverities["info"]
+}
+
+// frame returns the log entry b as it is to be written to
+// the socket.
+func (nw NetWriter) frame(b []byte) []byte {
+	s := nw.Syslog
+	if s == nil {
+		return b
+	}
+	nilIfEmpty := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+	msg := fmt.Appendf(nil, "<%d>1 %s %s %s %d %s - %s",
+		s.facility*8+syslogSeverity(b),
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilIfEmpty(s.Hostname),
+		nilIfEmpty(s.AppName),
+		os.Getpid(),
+		nilIfEmpty(s.MsgID),
+		bytes.TrimRight(b, "\r\n"))
+	if nw.isDatagram() {
+		return msg
+	}
+	return append(strconv.AppendInt(nil, int64(len(msg)), 10), append([]byte{' '}, msg...)...)
+}
+
+// isDatagram returns true if nw writes to a datagram socket.
+func (nw NetWriter) isDatagram() bool {
+	return strings.HasPrefix(nw.network, "udp") || nw.network == "unixgram"
+}
 
 // redialerConn wraps an underlying Conn so that if any
 // writes fail, the connection is redialed and the write
@@ -83,29 +399,33 @@ type reDialerConn struct {
 	nw         NetWriter
 	timeout    time.Duration
 	lastReDial time.Time
+	spool      *diskSpool
 }
 
 // Write wraps the underlying Conn.Write method, but if that fails,
 // it will re-dial the connection anew and try writing again.
 func (reconn *reDialerConn) Write(b []byte) (n int, err error) {
+	frame := reconn.nw.frame(b)
+
 	reconn.connMu.RLock()
 	conn := reconn.Conn
+	spooling := reconn.spool.pending()
 	reconn.connMu.RUnlock()
-	if conn != nil {
-		if n, err = conn.Write(b); err == nil {
-			return n, err
+	if conn != nil && !spooling {
+		if _, err = conn.Write(frame); err == nil {
+			return len(b), nil
 		}
 	}
 
 	// problem with the connection - lock it and try to fix it
 	reconn.connMu.Lock()
-	defer reconn.connMu.RUnlock()
+	defer reconn.connMu.Unlock()
 
 	// if multiple concurrent writes failed on the same broken conn, then
 	// one of them might have already re-dialed by now; try writing again
-	if reconn.Conn != nil {
-		if n, err := reconn.Conn.Write(b); err == nil {
-			return n, err
+	if reconn.Conn != nil && !reconn.spool.pending() {
+		if _, err = reconn.Conn.Write(frame); err == nil {
+			return len(b), nil
 		}
 	}
 
@@ -116,25 +436,91 @@ func (reconn *reDialerConn) Write(b []byte) (n int, err error) {
 	if time.Since(reconn.lastReDial) > 10*time.Second {
 		reconn.lastReDial = time.Now()
 		conn2, err2 := reconn.dial()
-		if err2 != nil {
-			// logger socket still offline; instead of discarding the log, dump it to stderr
-			os.Stderr.Write(b)
-			return n, err
-		}
-
-		if n, err = conn2.Write(b); err == nil {
+		if err2 == nil {
 			if reconn.Conn != nil {
 				reconn.Conn.Close()
 			}
 			reconn.Conn = conn2
+			// spooled entries must go out before this one
+			if err = reconn.replay(); err == nil {
+				if _, err = conn2.Write(frame); err == nil {
+					return len(b), nil
+				}
+			}
+		} else {
+			err = err2
 		}
-	} else {
-		// last redial attempt was too recent; just dump to stderr for now
-		os.Stderr.Write(b)
 	}
-	return n, err
+
+	// logger socket still offline; instead of discarding the log, spool it
+	// or dump it to stderr
+	if reconn.spool != nil {
+		if err := reconn.spool.append(frame); err != nil && err != errSpoolFull {
+			os.Stderr.Write(b)
+			return 0, err
+		}
+		return len(b), nil
+	}
+	os.Stderr.Write(b)
+	if err == nil {
+		err = fmt.Errorf("not connected to %s", reconn.nw)
+	}
+	return 0, err
+}
+
+// replay sends the spooled entries over the connection. On failure,
+// the connection is closed and the unsent entries stay in the spool.
+// It must be called with connMu held, or before reconn is shared.
+func (reconn *reDialerConn) replay() error {
+	if !reconn.spool.pending() {
+		return nil
+	}
+	dropped := reconn.spool.dropped
+	err := reconn.spool.replay(reconn.Conn)
+	if err != nil {
+		reconn.Conn.Close()
+		reconn.Conn = nil
+		return err
+	}
+	if dropped > 0 {
+		fmt.Fprintf(os.Stderr, "[WARNING] net log writer spool for %s was full; %d log entries were dropped\n", reconn.nw, dropped)
+	}
+	return nil
 }
 
 func (reconn *reDialerConn) dial() (net.Conn, error) {
-	return net.DialTimeout(reconn.nw.addr.Network, reconn.nw.addr.JoinHostPort(0), reconn.timeout)
+	address := reconn.nw.addr.JoinHostPort(0)
+	if reconn.nw.tlsConfig != nil {
+		dialer := &net.Dialer{Timeout: reconn.timeout}
+		return tls.DialWithDialer(dialer, reconn.nw.network, address, reconn.nw.tlsConfig)
+	}
+	return net.DialTimeout(reconn.nw.network, address, reconn.timeout)
+}
+
+func (reconn *reDialerConn) closeSpool() error {
+	if reconn.spool == nil {
+		return nil
+	}
+	return reconn.spool.close()
+}
+
+// Close closes the connection and the spool.
+func (reconn *reDialerConn) Close() error {
+	reconn.connMu.Lock()
+	defer reconn.connMu.Unlock()
+	var err error
+	if reconn.Conn != nil {
+		err = reconn.Conn.Close()
+		reconn.Conn = nil
+	}
+	if err2 := reconn.closeSpool(); err == nil {
+		err = err2
+	}
+	return err
 }
+
+// Interface guards
+var (
+	_ uni.Provisioner  = (*NetWriter)(nil)
+	_ uni.WriterOpener = (*NetWriter)(nil)
+)
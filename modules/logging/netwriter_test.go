@@ -0,0 +1,406 @@
+package logging
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"uni"
+	_ "uni/modules/kfs"
+)
+
+func openTestNetWriter(t *testing.T, nw NetWriter) *reDialerConn {
+	t.Helper()
+	if err := nw.Provision(uni.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := nw.OpenWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w.(*reDialerConn)
+}
+
+// readOctetCounted reads one RFC 6587 octet-counted frame.
+func readOctetCounted(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		t.Fatalf("invalid frame length %q: %v", length, err)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+func TestNetWriterSyslogOverTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	w := openTestNetWriter(t, NetWriter{
+		Address: "tcp/" + ln.Addr().String(),
+		Syslog:  &SyslogFormat{Facility: "local0", Hostname: "fw1", MsgID: "audit"},
+	})
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w.Write([]byte(`{"level":"warn","msg":"blocked"}` + "\n"))
+	w.Write([]byte("plain text\n"))
+
+	r := bufio.NewReader(conn)
+	header := `^<%d>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z fw1 guard ` + strconv.Itoa(os.Getpid()) + ` audit - `
+	for i, expect := range []*regexp.Regexp{
+		regexp.MustCompile(strings.Replace(header, "%d", "132", 1) + `\{"level":"warn","msg":"blocked"\}$`), // local0*8 + warning
+		regexp.MustCompile(strings.Replace(header, "%d", "134", 1) + `plain text$`),                         // local0*8 + info
+	} {
+		if actual := readOctetCounted(t, r); !expect.MatchString(actual) {
+			t.Errorf("Test %d: message %q does not match %s", i, actual, expect)
+		}
+	}
+}
+
+func TestNetWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w := openTestNetWriter(t, NetWriter{
+		Address: "udp/" + pc.LocalAddr().String(),
+		Syslog:  &SyslogFormat{},
+	})
+	w.Write([]byte(`{"level":"error","msg":"one"}` + "\n"))
+	w.Write([]byte(`{"level":"debug","msg":"two"}` + "\n"))
+
+	buf := make([]byte, 1024)
+	for i, expect := range []string{`<27>1 `, `<31>1 `} { // daemon*8 + error, daemon*8 + debug
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := string(buf[:n]); !strings.HasPrefix(msg, expect) || strings.HasSuffix(msg, "\n") {
+			t.Errorf("Test %d: expected one message per datagram starting with %q, got %q", i, expect, msg)
+		}
+	}
+}
+
+// writeTestCert writes a certificate for name (and its key) signed by
+// parent to dir, and returns it; if parent is nil, it is self-signed.
+func writeTestCert(t *testing.T, dir, name string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// serveTestTLSLogs accepts one TLS connection that requires a
+// client certificate signed by ca, and sends the common name of
+// the client with the first line it sent.
+func serveTestTLSLogs(t *testing.T, server, ca tls.Certificate) (net.Addr, <-chan string) {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			received <- "handshake: " + err.Error()
+			return
+		}
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName + ": " + line
+	}()
+	return ln.Addr(), received
+}
+
+func expectTestTLSLog(t *testing.T, w io.Writer, received <-chan string) {
+	t.Helper()
+	if _, err := w.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case actual := <-received:
+		if expect := "client: hello\n"; actual != expect {
+			t.Errorf("expected %q, got %q", expect, actual)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for log entry")
+	}
+}
+
+func TestNetWriterTLSClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeTestCert(t, dir, "ca", nil)
+	server := writeTestCert(t, dir, "logs.test", &ca)
+	writeTestCert(t, dir, "client", &ca)
+	addr, received := serveTestTLSLogs(t, server, ca)
+
+	w := openTestNetWriter(t, NetWriter{
+		Address: "tcp+tls/" + addr.String(),
+		TLS: &NetWriterTLS{
+			RootCAPEMFiles:           []string{filepath.Join(dir, "ca.crt")},
+			ClientCertificateFile:    filepath.Join(dir, "client.crt"),
+			ClientCertificateKeyFile: filepath.Join(dir, "client.key"),
+			ServerName:               "logs.test",
+		},
+	})
+	expectTestTLSLog(t, w, received)
+}
+
+func TestNetWriterTLSFilesFromFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeTestCert(t, dir, "ca", nil)
+	server := writeTestCert(t, dir, "logs.test", &ca)
+	writeTestCert(t, dir, "client", &ca)
+	addr, received := serveTestTLSLogs(t, server, ca)
+
+	// the files are only in memory
+	files := make(map[string]string)
+	for _, name := range []string{"ca.crt", "client.crt", "client.key"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["tls/"+name] = string(data)
+	}
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autosave := uni.ConfigAutosavePath
+	uni.ConfigAutosavePath = filepath.Join(t.TempDir(), "autosave.json")
+	t.Cleanup(func() {
+		_ = uni.Stop()
+		uni.ConfigAutosavePath = autosave
+	})
+	err = uni.Load([]byte(`{
+		"admin": {"disabled": true},
+		"apps": {"filesystems": {"filesystems": [
+			{"name": "secrets", "file_system": {"backend": "memory", "files": `+string(filesJSON)+`}}
+		]}}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nw := NetWriter{
+		Address: "tcp+tls/" + addr.String(),
+		TLS: &NetWriterTLS{
+			RootCAPEMFiles:           []string{"secrets:tls/ca.crt"},
+			ClientCertificateFile:    "secrets:tls/client.crt",
+			ClientCertificateKeyFile: "secrets:/tls/client.key",
+			ServerName:               "logs.test",
+		},
+	}
+	if err := nw.Provision(uni.ActiveContext()); err != nil {
+		t.Fatal(err)
+	}
+	w, err := nw.OpenWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	expectTestTLSLog(t, w, received)
+
+	nw.TLS.RootCAPEMFiles = []string{"secrets:tls/missing.crt"}
+	if err := nw.Provision(uni.ActiveContext()); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestNetWriterRejectsTLSWithoutTLSNetwork(t *testing.T) {
+	nw := NetWriter{Address: "udp+tls/127.0.0.1:514"}
+	if err := nw.Provision(uni.Context{}); err == nil {
+		t.Error("expected TLS over UDP to be rejected")
+	}
+	nw = NetWriter{Address: "tcp/127.0.0.1:514", TLS: &NetWriterTLS{}}
+	if err := nw.Provision(uni.Context{}); err == nil {
+		t.Error("expected TLS config without tcp+tls network to be rejected")
+	}
+}
+
+func TestNetWriterSpool(t *testing.T) {
+	// find a free port, and keep the collector down for now
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spoolPath := filepath.Join(t.TempDir(), "spool")
+	w := openTestNetWriter(t, NetWriter{
+		Address:   "tcp/" + addr,
+		SoftStart: true,
+		Spool:     &NetWriterSpool{Path: spoolPath},
+	})
+	w.spool.maxSize = 4 + int64(len("one\n")) + 4 + int64(len("two\n"))
+	for _, line := range []string{"one\n", "two\n", "dropped\n"} {
+		if n, err := w.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("expected spooled write to succeed, got %d, %v", n, err)
+		}
+	}
+
+	// a new writer (e.g. after a restart) picks up the spool
+	// and sends it first once the collector is back
+	w.Close()
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("could not listen on %s again: %v", addr, err)
+	}
+	defer ln.Close()
+	w = openTestNetWriter(t, NetWriter{
+		Address: "tcp/" + addr,
+		Spool:   &NetWriterSpool{Path: spoolPath},
+	})
+	w.Write([]byte("three\n"))
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for _, expect := range []string{"one\n", "two\n", "three\n"} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if line, err := r.ReadString('\n'); line != expect {
+			t.Fatalf("expected %q, got %q (%v)", expect, line, err)
+		}
+	}
+	if info, err := os.Stat(spoolPath); err != nil || info.Size() != 0 {
+		t.Errorf("expected spool to be empty after replay: %v, %v", info, err)
+	}
+}
+
+func TestDiskSpoolPartialReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool")
+	s, err := openDiskSpool(path, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	for _, rec := range []string{"a", "b", "c"} {
+		if err := s.append([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the collector goes away after the first record
+	fw := &failingWriter{failAfter: 1}
+	if err := s.replay(fw); err == nil {
+		t.Fatal("expected replay to fail")
+	}
+	if !s.pending() {
+		t.Fatal("expected unsent records to stay in the spool")
+	}
+	s.append([]byte("d"))
+
+	fw = &failingWriter{failAfter: -1}
+	if err := s.replay(fw); err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.Join(fw.written, ""); actual != "bcd" {
+		t.Errorf("expected remaining records in order, got %q", actual)
+	}
+	if s.pending() {
+		t.Error("expected spool to be empty")
+	}
+}
+
+type failingWriter struct {
+	failAfter int
+	written   []string
+}
+
+func (fw *failingWriter) Write(b []byte) (int, error) {
+	if fw.failAfter == 0 {
+		return 0, net.ErrClosed
+	}
+	fw.failAfter--
+	fw.written = append(fw.written, string(b))
+	return len(b), nil
+}
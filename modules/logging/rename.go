@@ -0,0 +1,180 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// renamingEncoder wraps an encoder and renames the
+// top-level fields of the log entries it encodes.
+type renamingEncoder struct {
+	zapcore.Encoder
+	names map[string]string
+}
+
+// rename returns the name key is written with.
+func (re renamingEncoder) rename(key string) string {
+	if name, ok := re.names[key]; ok {
+		return name
+	}
+	return key
+}
+
+// Clone implements zapcore.Encoder.
+func (re renamingEncoder) Clone() zapcore.Encoder {
+	return renamingEncoder{Encoder: re.Encoder.Clone(), names: re.names}
+}
+
+// EncodeEntry implements zapcore.Encoder.
+func (re renamingEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	renamed := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		field.Key = re.rename(field.Key)
+		renamed[i] = field
+	}
+	return re.Encoder.EncodeEntry(ent, renamed)
+}
+
+// AddArray is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	return re.Encoder.AddArray(re.rename(key), marshaler)
+}
+
+// AddObject is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	return re.Encoder.AddObject(re.rename(key), marshaler)
+}
+
+// AddBinary is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddBinary(key string, value []byte) {
+	re.Encoder.AddBinary(re.rename(key), value)
+}
+
+// AddByteString is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddByteString(key string, value []byte) {
+	re.Encoder.AddByteString(re.rename(key), value)
+}
+
+// AddBool is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddBool(key string, value bool) {
+	re.Encoder.AddBool(re.rename(key), value)
+}
+
+// AddComplex128 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddComplex128(key string, value complex128) {
+	re.Encoder.AddComplex128(re.rename(key), value)
+}
+
+// AddComplex64 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddComplex64(key string, value complex64) {
+	re.Encoder.AddComplex64(re.rename(key), value)
+}
+
+// AddDuration is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddDuration(key string, value time.Duration) {
+	re.Encoder.AddDuration(re.rename(key), value)
+}
+
+// AddFloat64 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddFloat64(key string, value float64) {
+	re.Encoder.AddFloat64(re.rename(key), value)
+}
+
+// AddFloat32 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddFloat32(key string, value float32) {
+	re.Encoder.AddFloat32(re.rename(key), value)
+}
+
+// AddInt is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddInt(key string, value int) {
+	re.Encoder.AddInt(re.rename(key), value)
+}
+
+// AddInt64 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddInt64(key string, value int64) {
+	re.Encoder.AddInt64(re.rename(key), value)
+}
+
+// AddInt32 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddInt32(key string, value int32) {
+	re.Encoder.AddInt32(re.rename(key), value)
+}
+
+// AddInt16 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddInt16(key string, value int16) {
+	re.Encoder.AddInt16(re.rename(key), value)
+}
+
+// AddInt8 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddInt8(key string, value int8) {
+	re.Encoder.AddInt8(re.rename(key), value)
+}
+
+// AddString is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddString(key, value string) {
+	re.Encoder.AddString(re.rename(key), value)
+}
+
+// AddTime is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddTime(key string, value time.Time) {
+	re.Encoder.AddTime(re.rename(key), value)
+}
+
+// AddUint is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddUint(key string, value uint) {
+	re.Encoder.AddUint(re.rename(key), value)
+}
+
+// AddUint64 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddUint64(key string, value uint64) {
+	re.Encoder.AddUint64(re.rename(key), value)
+}
+
+// AddUint32 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddUint32(key string, value uint32) {
+	re.Encoder.AddUint32(re.rename(key), value)
+}
+
+// AddUint16 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddUint16(key string, value uint16) {
+	re.Encoder.AddUint16(re.rename(key), value)
+}
+
+// AddUint8 is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddUint8(key string, value uint8) {
+	re.Encoder.AddUint8(re.rename(key), value)
+}
+
+// AddUintptr is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddUintptr(key string, value uintptr) {
+	re.Encoder.AddUintptr(re.rename(key), value)
+}
+
+// AddReflected is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) AddReflected(key string, value any) error {
+	return re.Encoder.AddReflected(re.rename(key), value)
+}
+
+// OpenNamespace is part of the zapcore.ObjectEncoder interface.
+func (re renamingEncoder) OpenNamespace(key string) {
+	re.Encoder.OpenNamespace(re.rename(key))
+}
+
+// Interface guard
+var _ zapcore.Encoder = (*renamingEncoder)(nil)
@@ -0,0 +1,158 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// errSpoolFull is returned when a record does not fit into the spool.
+var errSpoolFull = errors.New("spool is full")
+
+// diskSpool is a bounded FIFO of records stored in a file, so that
+// they survive restarts. Each record is stored as its length (four
+// bytes, big endian) followed by its contents. A diskSpool is not
+// safe for concurrent use.
+type diskSpool struct {
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+
+	// the number of records that did not fit since
+	// the spool was last emptied
+	dropped int
+}
+
+// openDiskSpool opens the spool at path, creating it if
+// it does not exist. Records already in it are kept.
+func openDiskSpool(path string, maxSize int64) (*diskSpool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	s := &diskSpool{path: path, maxSize: maxSize}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *diskSpool) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+// pending returns true if there are records in the spool.
+func (s *diskSpool) pending() bool {
+	return s != nil && s.size > 0
+}
+
+// append adds rec to the end of the spool, or returns
+// errSpoolFull if it does not fit.
+func (s *diskSpool) append(rec []byte) error {
+	if s.size+4+int64(len(rec)) > s.maxSize {
+		s.dropped++
+		return errSpoolFull
+	}
+	buf := make([]byte, 4, 4+len(rec))
+	binary.BigEndian.PutUint32(buf, uint32(len(rec)))
+	buf = append(buf, rec...)
+	n, err := s.file.Write(buf)
+	s.size += int64(n)
+	return err
+}
+
+// replay writes the records in the spool to w, in order, with one
+// call to Write each. The records that were written are removed; if
+// writing fails, the rest are kept and the error is returned.
+func (s *diskSpool) replay(w io.Writer) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	var hdr [4]byte
+	for {
+		// a truncated record at the end (e.g. because the
+		// process crashed while writing it) is dropped
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			break
+		}
+		rec := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		if _, err := io.ReadFull(r, rec); err != nil {
+			break
+		}
+		if _, err := w.Write(rec); err != nil {
+			if err2 := s.keepFrom(f, offset); err2 != nil {
+				return errors.Join(err, err2)
+			}
+			return err
+		}
+		offset += int64(len(hdr) + len(rec))
+	}
+
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	s.size = 0
+	s.dropped = 0
+	return nil
+}
+
+// keepFrom replaces the spool with the records of f
+// from offset on.
+func (s *diskSpool) keepFrom(f *os.File, offset int64) error {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, f)
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.file.Close()
+	return s.open()
+}
+
+func (s *diskSpool) close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,226 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"uni"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	uni.RegisterModule(TemplateEncoder{})
+}
+
+// defaultLogTemplate is the template of the template
+// encoder if none is configured.
+const defaultLogTemplate = "{ts} {level} {logger} {msg} {fields}"
+
+// TemplateEncoder encodes each log entry as a line made from a
+// template with placeholders. The placeholders of the entry are:
+//
+// Placeholder | Description
+// ------------|---------------
+// `{ts}` | The time of the entry, formatted per `time_format`
+// `{level}` | The level, formatted per `level_format`
+// `{logger}` | The name of the logger
+// `{caller}` | The file and line that logged the entry, if enabled
+// `{msg}` | The message
+// `{stacktrace}` | The stack trace, if enabled
+// `{fields}` | All fields, as logfmt key=value pairs sorted by key
+// `{fields.*}` | The value of a field; dots select fields of nested objects
+//
+// The global placeholders, like `{env.*}` and `{system.hostname}`,
+// can be used as well. Unknown placeholders are replaced by empty
+// strings; a space next to an empty placeholder is removed with it.
+type TemplateEncoder struct {
+	zapcore.Encoder `json:"-"`
+	LogEncoderConfig
+
+	// The template of each line. Default:
+	// `{ts} {level} {logger} {msg} {fields}`
+	Template string `json:"template,omitempty"`
+}
+
+// UniModule returns the Uni module information.
+func (TemplateEncoder) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.logging.encoders.template",
+		New: func() uni.Module { return new(TemplateEncoder) },
+	}
+}
+
+// Provision sets up the encoder.
+func (te *TemplateEncoder) Provision(_ uni.Context) error {
+	if te.Template == "" {
+		te.Template = defaultLogTemplate
+	}
+	if te.TimeFormat == "" {
+		te.TimeFormat = "wall_milli"
+	}
+	if te.DurationFormat == "" {
+		te.DurationFormat = "string"
+	}
+	cfg := te.ZapcoreEncoderConfig()
+	te.Encoder = te.wrap(&templateEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		cfg:              &cfg,
+		template:         te.Template,
+	})
+	return nil
+}
+
+// emptyMark stands in for the values of empty placeholders.
+const emptyMark = "\x00"
+
+// emptyMarkCleaner removes empty marks, and a space next to
+// each, so that empty values do not leave gaps.
+var emptyMarkCleaner = strings.NewReplacer(" "+emptyMark, "", emptyMark+" ", "", emptyMark, "")
+
+// templateEncoder is a zapcore.Encoder that fills in a template.
+// The context fields are collected in the embedded map.
+type templateEncoder struct {
+	*zapcore.MapObjectEncoder
+	cfg      *zapcore.EncoderConfig
+	template string
+}
+
+// Clone implements zapcore.Encoder.
+func (enc *templateEncoder) Clone() zapcore.Encoder {
+	clone := zapcore.NewMapObjectEncoder()
+	maps.Copy(clone.Fields, enc.Fields)
+	return &templateEncoder{MapObjectEncoder: clone, cfg: enc.cfg, template: enc.template}
+}
+
+// EncodeEntry implements zapcore.Encoder.
+func (enc *templateEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	all := enc.Clone().(*templateEncoder)
+	for _, field := range fields {
+		field.AddTo(all)
+	}
+
+	repl := uni.NewReplacer().WithoutFile()
+	repl.Map(func(key string) (any, bool) {
+		switch key {
+		case "ts":
+			return enc.encode(func(ae zapcore.ArrayEncoder) { enc.cfg.EncodeTime(ent.Time, ae) }), true
+		case "level":
+			return enc.encode(func(ae zapcore.ArrayEncoder) { enc.cfg.EncodeLevel(ent.Level, ae) }), true
+		case "logger":
+			return ent.LoggerName, true
+		case "caller":
+			if !ent.Caller.Defined {
+				return "", true
+			}
+			return ent.Caller.TrimmedPath(), true
+		case "msg":
+			return ent.Message, true
+		case "stacktrace":
+			return ent.Stack, true
+		case "fields":
+			return enc.formatFields(all.Fields), true
+		}
+		if path, ok := strings.CutPrefix(key, "fields."); ok {
+			var value any = all.Fields
+			for name := range strings.SplitSeq(path, ".") {
+				obj, ok := value.(map[string]any)
+				if !ok {
+					return "", true
+				}
+				if value, ok = obj[name]; !ok {
+					return "", true
+				}
+			}
+			return enc.formatValue(value), true
+		}
+		return nil, false
+	})
+
+	// empty values are marked, so that the marks can be
+	// removed along with one of the spaces around them
+	line := repl.ReplaceAll(enc.template, emptyMark)
+	line = emptyMarkCleaner.Replace(line)
+
+	buf := logfmtPool.Get()
+	buf.AppendString(line)
+	if enc.cfg.LineEnding != "" {
+		buf.AppendString(enc.cfg.LineEnding)
+	} else {
+		buf.AppendString(zapcore.DefaultLineEnding)
+	}
+	return buf, nil
+}
+
+// encode returns what an encoder function of the config appends.
+func (enc *templateEncoder) encode(encode func(zapcore.ArrayEncoder)) string {
+	values := &logfmtArrayEncoder{cfg: enc.cfg}
+	encode(values)
+	return values.String()
+}
+
+// formatFields returns fields as logfmt key=value pairs.
+func (enc *templateEncoder) formatFields(fields map[string]any) string {
+	buf := logfmtPool.Get()
+	defer buf.Free()
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		if buf.Len() > 0 {
+			buf.AppendByte(' ')
+		}
+		appendLogfmtKey(buf, key)
+		buf.AppendByte('=')
+		appendLogfmtValue(buf, enc.formatValue(fields[key]))
+	}
+	return buf.String()
+}
+
+// formatValue returns the value of a field as
+// collected by a zapcore.MapObjectEncoder.
+func (enc *templateEncoder) formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return enc.encode(func(ae zapcore.ArrayEncoder) { enc.cfg.EncodeTime(v, ae) })
+	case time.Duration:
+		return enc.encode(func(ae zapcore.ArrayEncoder) { enc.cfg.EncodeDuration(v, ae) })
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64:
+		return fmt.Sprint(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+// Interface guards
+var (
+	_ zapcore.Encoder = (*TemplateEncoder)(nil)
+	_ zapcore.Encoder = (*templateEncoder)(nil)
+	_ uni.Provisioner = (*TemplateEncoder)(nil)
+)
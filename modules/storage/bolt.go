@@ -0,0 +1,237 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"uni"
+
+	"github.com/caddyserver/certmagic"
+	"go.etcd.io/bbolt"
+)
+
+func init() {
+	uni.RegisterModule(BoltStorage{})
+}
+
+// BoltStorage is a storage in a single database file, using the
+// embedded key-value store bbolt. Besides serving as the storage
+// of a config, it offers transactional buckets for caches that
+// must survive restarts, like DNS caches and fake-IP mappings;
+// see View and Update.
+//
+// The database file is locked by the process that opens it, so
+// another Guard instance configured with the same file waits until
+// it is released (up to the open timeout) instead of corrupting it.
+// Within a process, configs using the same file share one handle,
+// so reloads do not wait for themselves. Use file_system storage
+// for a store that several instances use at the same time.
+type BoltStorage struct {
+	// The path of the database file, which is created if it
+	// does not exist. Default: storage.db in the Guard data
+	// directory.
+	Path string `json:"path,omitempty"`
+
+	// How long to wait for another process to release the
+	// database file. Default: 10s
+	Timeout uni.Duration `json:"timeout,omitempty"`
+
+	*kvStorage `json:"-"`
+
+	db  *bbolt.DB
+	key string
+}
+
+// UniModule returns the Uni module information.
+func (BoltStorage) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.storage.bolt",
+		New: func() uni.Module { return new(BoltStorage) },
+	}
+}
+
+// Provision opens the database file.
+func (s *BoltStorage) Provision(ctx uni.Context) error {
+	if s.Path == "" {
+		s.Path = filepath.Join(uni.AppDataDir(), "storage.db")
+	}
+	absPath, err := filepath.Abs(s.Path)
+	if err != nil {
+		return fmt.Errorf("resolving database path: %v", err)
+	}
+	s.key = absPath
+	timeout := time.Duration(s.Timeout)
+	if timeout <= 0 {
+		timeout = defaultBoltTimeout
+	}
+
+	val, _, err := boltDBs.LoadOrNew(s.key, func() (uni.Destructor, error) {
+		if err := os.MkdirAll(filepath.Dir(absPath), 0o700); err != nil {
+			return nil, err
+		}
+		db, err := bbolt.Open(absPath, 0o600, &bbolt.Options{Timeout: timeout})
+		if err != nil {
+			return nil, err
+		}
+		err = db.Update(func(tx *bbolt.Tx) error {
+			for _, name := range []string{keysBucket, locksBucket} {
+				if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &sharedBoltDB{DB: db, kv: newKVStorage(boltDB{db})}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("opening database %s: %v", absPath, err)
+	}
+	shared := val.(*sharedBoltDB)
+	s.db = shared.DB
+	s.kvStorage = shared.kv
+	return nil
+}
+
+// CertMagicStorage returns the storage itself.
+func (s *BoltStorage) CertMagicStorage() (certmagic.Storage, error) {
+	return s, nil
+}
+
+// View runs fn in a read-only transaction on the bucket called
+// bucket. The bucket is nil if it was never written to.
+func (s *BoltStorage) View(bucket string, fn func(*bbolt.Bucket) error) error {
+	if err := checkBucketName(bucket); err != nil {
+		return err
+	}
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return fn(tx.Bucket([]byte(bucket)))
+	})
+}
+
+// Update runs fn in a read-write transaction on the bucket called
+// bucket, which is created if needed. All writes of fn are committed
+// together when it returns nil, and none of them if it returns an
+// error.
+func (s *BoltStorage) Update(bucket string, fn func(*bbolt.Bucket) error) error {
+	if err := checkBucketName(bucket); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// Cleanup releases the database file.
+func (s *BoltStorage) Cleanup() error {
+	if s.db == nil {
+		return nil
+	}
+	_, err := boltDBs.Delete(s.key)
+	return err
+}
+
+// checkBucketName returns an error if bucket cannot be used
+// by View and Update.
+func checkBucketName(bucket string) error {
+	if bucket == "" {
+		return fmt.Errorf("bucket name is required")
+	}
+	if bucket == keysBucket || bucket == locksBucket {
+		return fmt.Errorf("bucket name %q is reserved", bucket)
+	}
+	return nil
+}
+
+// sharedBoltDB is an open database in the boltDBs pool. The
+// storage on top of it is shared as well, so that waiting for
+// a lock is woken up by its release in any config.
+type sharedBoltDB struct {
+	*bbolt.DB
+	kv *kvStorage
+}
+
+// Destruct closes the database.
+func (db *sharedBoltDB) Destruct() error {
+	return db.Close()
+}
+
+// boltDB is the kvBackend of BoltStorage.
+type boltDB struct{ db *bbolt.DB }
+
+func (db boltDB) view(fn func(kvTx) error) error {
+	return db.db.View(func(tx *bbolt.Tx) error { return fn(boltTx{tx}) })
+}
+
+func (db boltDB) update(fn func(kvTx) error) error {
+	return db.db.Update(func(tx *bbolt.Tx) error { return fn(boltTx{tx}) })
+}
+
+type boltTx struct{ tx *bbolt.Tx }
+
+func (tx boltTx) get(bucket, key string) ([]byte, bool) {
+	v := tx.tx.Bucket([]byte(bucket)).Get([]byte(key))
+	if v == nil {
+		return nil, false
+	}
+	// values are only valid during the transaction
+	return slices.Clone(v), true
+}
+
+func (tx boltTx) put(bucket, key string, value []byte) error {
+	return tx.tx.Bucket([]byte(bucket)).Put([]byte(key), value)
+}
+
+func (tx boltTx) del(bucket, key string) error {
+	return tx.tx.Bucket([]byte(bucket)).Delete([]byte(key))
+}
+
+func (tx boltTx) scan(bucket, prefix string, fn func(string, []byte) bool) {
+	c := tx.tx.Bucket([]byte(bucket)).Cursor()
+	p := []byte(prefix)
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if !fn(string(k), slices.Clone(v)) {
+			return
+		}
+	}
+}
+
+// defaultBoltTimeout is how long to wait for the database
+// file to be released by another process by default.
+const defaultBoltTimeout = 10 * time.Second
+
+// boltDBs holds the open database files, keyed by absolute path.
+var boltDBs = uni.NewUsagePool()
+
+// Interface guards
+var (
+	_ certmagic.Storage    = (*BoltStorage)(nil)
+	_ uni.StorageConverter = (*BoltStorage)(nil)
+	_ uni.Provisioner      = (*BoltStorage)(nil)
+	_ uni.CleanerUpper     = (*BoltStorage)(nil)
+)
@@ -0,0 +1,56 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"uni"
+
+	"github.com/caddyserver/certmagic"
+)
+
+func init() {
+	uni.RegisterModule(FileStorage{})
+}
+
+// FileStorage is a certmagic.Storage backed by the local file
+// system: every key is a file under the root directory. Locks are
+// lock files, so any number of Guard instances can share the same
+// directory, e.g. on a network file system.
+type FileStorage struct {
+	// The base path in which things should be stored.
+	// Default: the Guard data directory.
+	Root string `json:"root,omitempty"`
+}
+
+// UniModule returns the Uni module information.
+func (FileStorage) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.storage.file_system",
+		New: func() uni.Module { return new(FileStorage) },
+	}
+}
+
+// CertMagicStorage converts s to a certmagic.Storage instance.
+func (s FileStorage) CertMagicStorage() (certmagic.Storage, error) {
+	root := s.Root
+	if root == "" {
+		root = uni.AppDataDir()
+	}
+	return &certmagic.FileStorage{Path: root}, nil
+}
+
+// Interface guard
+var _ uni.StorageConverter = (*FileStorage)(nil)
@@ -0,0 +1,376 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage contains the storage modules in the uni.storage
+// namespace, which can be configured as the storage of a config
+// (the top-level "storage" field). Storage holds certificates and
+// other state that must survive restarts.
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+)
+
+// kvBackend is a key-value database with buckets of sorted keys
+// that the key-value storages are built on.
+type kvBackend interface {
+	// view runs fn in a read-only transaction.
+	view(fn func(kvTx) error) error
+
+	// update runs fn in a read-write transaction; its
+	// writes are committed only if fn returns nil.
+	update(fn func(kvTx) error) error
+}
+
+// kvTx is a transaction of a kvBackend. Values returned by
+// it may be retained after the transaction is over.
+type kvTx interface {
+	get(bucket, key string) ([]byte, bool)
+	put(bucket, key string, value []byte) error
+	del(bucket, key string) error
+
+	// scan calls fn for every key in bucket starting with
+	// prefix, in key order, until fn returns false.
+	scan(bucket, prefix string, fn func(key string, value []byte) bool)
+}
+
+// Names of the buckets used by kvStorage.
+const (
+	keysBucket  = "storage"
+	locksBucket = "locks"
+)
+
+// kvStorage implements certmagic.Storage on top of a kvBackend.
+// Keys are slash-separated paths; a key that is the prefix of
+// other keys up to a slash acts as a directory. Each value is
+// stored with its modification time.
+//
+// Locks are records in their own bucket that the holder keeps
+// fresh while it holds them; a lock whose record was not renewed
+// for staleLockDuration is considered abandoned (e.g. because its
+// holder crashed) and may be taken over, like certmagic's
+// FileStorage does it with lock files.
+type kvStorage struct {
+	db kvBackend
+
+	mu       sync.Mutex
+	held     map[string]chan struct{} // closed to stop keeping a held lock fresh
+	unlocked chan struct{}            // closed (and replaced) when any lock is released
+}
+
+func newKVStorage(db kvBackend) *kvStorage {
+	return &kvStorage{
+		db:       db,
+		held:     make(map[string]chan struct{}),
+		unlocked: make(chan struct{}),
+	}
+}
+
+// Store puts value at key.
+func (s *kvStorage) Store(_ context.Context, key string, value []byte) error {
+	key = normalizeKey(key)
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	buf := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().UnixNano()))
+	copy(buf[8:], value)
+	return s.db.update(func(tx kvTx) error {
+		return tx.put(keysBucket, key, buf)
+	})
+}
+
+// Load retrieves the value at key.
+func (s *kvStorage) Load(_ context.Context, key string) ([]byte, error) {
+	key = normalizeKey(key)
+	var value []byte
+	err := s.db.view(func(tx kvTx) error {
+		buf, ok := tx.get(keysBucket, key)
+		if !ok {
+			return fs.ErrNotExist
+		}
+		_, value = decodeValue(buf)
+		return nil
+	})
+	return value, err
+}
+
+// Delete deletes key and, if it is a directory, all keys in it.
+func (s *kvStorage) Delete(_ context.Context, key string) error {
+	key = normalizeKey(key)
+	return s.db.update(func(tx kvTx) error {
+		var keys []string
+		if key != "" {
+			if _, ok := tx.get(keysBucket, key); ok {
+				keys = append(keys, key)
+			}
+		}
+		tx.scan(keysBucket, dirPrefix(key), func(k string, _ []byte) bool {
+			keys = append(keys, k)
+			return true
+		})
+		for _, k := range keys {
+			if err := tx.del(keysBucket, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Exists returns true if key exists as a value or a directory.
+func (s *kvStorage) Exists(_ context.Context, key string) bool {
+	key = normalizeKey(key)
+	var exists bool
+	_ = s.db.view(func(tx kvTx) error {
+		_, exists = tx.get(keysBucket, key)
+		if !exists {
+			tx.scan(keysBucket, dirPrefix(key), func(string, []byte) bool {
+				exists = true
+				return false
+			})
+		}
+		return nil
+	})
+	return exists
+}
+
+// List returns the keys in the directory dir. If recursive is
+// true, the keys in all subdirectories are listed as well,
+// including the subdirectories themselves; otherwise only the
+// immediate children of dir are.
+func (s *kvStorage) List(_ context.Context, dir string, recursive bool) ([]string, error) {
+	prefix := dirPrefix(normalizeKey(dir))
+	var keys []string
+	seen := make(map[string]struct{})
+	add := func(k string) {
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+	}
+	err := s.db.view(func(tx kvTx) error {
+		tx.scan(keysBucket, prefix, func(k string, _ []byte) bool {
+			rel := strings.TrimPrefix(k, prefix)
+			if !recursive {
+				first, _, _ := strings.Cut(rel, "/")
+				add(prefix + first)
+				return true
+			}
+			for i, c := range rel {
+				if c == '/' {
+					add(prefix + rel[:i])
+				}
+			}
+			add(k)
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fs.ErrNotExist
+	}
+	return keys, nil
+}
+
+// Stat returns information about key.
+func (s *kvStorage) Stat(_ context.Context, key string) (certmagic.KeyInfo, error) {
+	key = normalizeKey(key)
+	info := certmagic.KeyInfo{Key: key}
+	err := s.db.view(func(tx kvTx) error {
+		if buf, ok := tx.get(keysBucket, key); ok {
+			modified, value := decodeValue(buf)
+			info.Modified = modified
+			info.Size = int64(len(value))
+			info.IsTerminal = true
+			return nil
+		}
+		var isDir bool
+		tx.scan(keysBucket, dirPrefix(key), func(string, []byte) bool {
+			isDir = true
+			return false
+		})
+		if !isDir {
+			return fs.ErrNotExist
+		}
+		return nil
+	})
+	return info, err
+}
+
+// Lock obtains the lock called name, blocking until it is
+// released by its holder or becomes stale, or until ctx is done.
+func (s *kvStorage) Lock(ctx context.Context, name string) error {
+	for {
+		// grab the notification channel before trying, so that
+		// a release right after a failed attempt is not missed
+		s.mu.Lock()
+		unlocked := s.unlocked
+		s.mu.Unlock()
+
+		acquired, err := s.tryLock(name)
+		if err != nil {
+			return fmt.Errorf("obtaining lock %s: %v", name, err)
+		}
+		if acquired {
+			done := make(chan struct{})
+			s.mu.Lock()
+			s.held[name] = done
+			s.mu.Unlock()
+			go s.keepLockFresh(name, done)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-unlocked:
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Unlock releases the lock called name.
+func (s *kvStorage) Unlock(_ context.Context, name string) error {
+	s.mu.Lock()
+	if done, ok := s.held[name]; ok {
+		close(done)
+		delete(s.held, name)
+	}
+	s.mu.Unlock()
+
+	err := s.db.update(func(tx kvTx) error {
+		return tx.del(locksBucket, name)
+	})
+	if err != nil {
+		return fmt.Errorf("releasing lock %s: %v", name, err)
+	}
+
+	s.mu.Lock()
+	close(s.unlocked)
+	s.unlocked = make(chan struct{})
+	s.mu.Unlock()
+	return nil
+}
+
+// tryLock takes the lock called name if it is free or stale.
+func (s *kvStorage) tryLock(name string) (bool, error) {
+	var acquired bool
+	err := s.db.update(func(tx kvTx) error {
+		if buf, ok := tx.get(locksBucket, name); ok {
+			var meta lockMeta
+			if err := json.Unmarshal(buf, &meta); err == nil && time.Since(meta.Updated) < staleLockDuration {
+				return nil
+			}
+			// abandoned or corrupt lock; take it over
+		}
+		now := time.Now()
+		buf, err := json.Marshal(lockMeta{Created: now, Updated: now})
+		if err != nil {
+			return err
+		}
+		acquired = true
+		return tx.put(locksBucket, name, buf)
+	})
+	return acquired && err == nil, err
+}
+
+// keepLockFresh renews the record of the held lock called name
+// until done is closed, so that it does not become stale.
+func (s *kvStorage) keepLockFresh(name string, done <-chan struct{}) {
+	ticker := time.NewTicker(lockFreshnessInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_ = s.db.update(func(tx kvTx) error {
+				buf, ok := tx.get(locksBucket, name)
+				if !ok {
+					return nil
+				}
+				var meta lockMeta
+				if err := json.Unmarshal(buf, &meta); err != nil {
+					return err
+				}
+				meta.Updated = time.Now()
+				buf, err := json.Marshal(meta)
+				if err != nil {
+					return err
+				}
+				return tx.put(locksBucket, name, buf)
+			})
+		}
+	}
+}
+
+// lockMeta is the record of a held lock.
+type lockMeta struct {
+	Created time.Time `json:"created,omitempty"`
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+// normalizeKey cleans key into a slash-separated path without
+// leading or trailing slashes; the root is the empty string.
+func normalizeKey(key string) string {
+	key = strings.Trim(path.Clean("/"+key), "/")
+	return key
+}
+
+// dirPrefix returns the prefix of the keys in the directory dir.
+func dirPrefix(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return dir + "/"
+}
+
+// decodeValue splits a stored value into its modification time
+// and the value itself.
+func decodeValue(buf []byte) (time.Time, []byte) {
+	if len(buf) < 8 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf))), buf[8:]
+}
+
+const (
+	// lockFreshnessInterval is how often a held lock is renewed.
+	lockFreshnessInterval = 5 * time.Second
+
+	// staleLockDuration is how long a lock may go without being
+	// renewed before it is considered abandoned.
+	staleLockDuration = 2 * lockFreshnessInterval
+
+	// lockPollInterval is how often to check a lock that is held
+	// by someone else, in case it goes stale.
+	lockPollInterval = 1 * time.Second
+)
+
+// Interface guard
+var _ certmagic.Storage = (*kvStorage)(nil)
@@ -0,0 +1,117 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"uni"
+
+	"github.com/caddyserver/certmagic"
+)
+
+func init() {
+	uni.RegisterModule(MemoryStorage{})
+}
+
+// MemoryStorage is a storage that keeps everything in memory, so
+// its contents are lost when the config is unloaded. It is meant
+// for tests and for instances that must not write to disk.
+type MemoryStorage struct {
+	*kvStorage `json:"-"`
+}
+
+// UniModule returns the Uni module information.
+func (MemoryStorage) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "uni.storage.memory",
+		New: func() uni.Module { return NewMemoryStorage() },
+	}
+}
+
+// NewMemoryStorage returns a new, empty in-memory storage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{kvStorage: newKVStorage(&memoryDB{buckets: make(map[string]map[string][]byte)})}
+}
+
+// CertMagicStorage returns the storage itself.
+func (s *MemoryStorage) CertMagicStorage() (certmagic.Storage, error) {
+	return s, nil
+}
+
+// memoryDB is a kvBackend in memory. Its transactions are
+// serialized by a lock; writes of a failed update are not
+// rolled back, so update functions must not fail after
+// writing.
+type memoryDB struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+func (db *memoryDB) view(fn func(kvTx) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return fn(memoryTx{db})
+}
+
+func (db *memoryDB) update(fn func(kvTx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return fn(memoryTx{db})
+}
+
+type memoryTx struct{ db *memoryDB }
+
+func (tx memoryTx) get(bucket, key string) ([]byte, bool) {
+	v, ok := tx.db.buckets[bucket][key]
+	return v, ok
+}
+
+func (tx memoryTx) put(bucket, key string, value []byte) error {
+	if tx.db.buckets[bucket] == nil {
+		tx.db.buckets[bucket] = make(map[string][]byte)
+	}
+	tx.db.buckets[bucket][key] = slices.Clone(value)
+	return nil
+}
+
+func (tx memoryTx) del(bucket, key string) error {
+	delete(tx.db.buckets[bucket], key)
+	return nil
+}
+
+func (tx memoryTx) scan(bucket, prefix string, fn func(string, []byte) bool) {
+	var keys []string
+	for k := range tx.db.buckets[bucket] {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !fn(k, tx.db.buckets[bucket][k]) {
+			return
+		}
+	}
+}
+
+// Interface guards
+var (
+	_ certmagic.Storage    = (*MemoryStorage)(nil)
+	_ uni.StorageConverter = (*MemoryStorage)(nil)
+)
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"uni"
+
+	"github.com/caddyserver/certmagic"
+	"go.etcd.io/bbolt"
+)
+
+func provisionBolt(t *testing.T, path string) *BoltStorage {
+	t.Helper()
+	s := &BoltStorage{Path: path}
+	ctx, cancel := uni.NewContext(uni.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := s.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Cleanup() })
+	return s
+}
+
+func TestStorages(t *testing.T) {
+	for name, stor := range map[string]certmagic.Storage{
+		"memory":      NewMemoryStorage(),
+		"bolt":        provisionBolt(t, filepath.Join(t.TempDir(), "test.db")),
+		"file_system": &certmagic.FileStorage{Path: t.TempDir()},
+	} {
+		t.Run(name, func(t *testing.T) { testStorage(t, stor) })
+	}
+}
+
+func testStorage(t *testing.T, s certmagic.Storage) {
+	ctx := context.Background()
+
+	if _, err := s.Load(ctx, "certificates/a/a.crt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for missing key, got %v", err)
+	}
+	for _, key := range []string{"certificates/a/a.crt", "certificates/a/a.key", "certificates/b/b.crt", "ocsp/x"} {
+		if err := s.Store(ctx, key, []byte("value of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := s.Load(ctx, "certificates/a/a.key")
+	if err != nil || string(data) != "value of certificates/a/a.key" {
+		t.Fatalf("unexpected value %q (%v)", data, err)
+	}
+	if !s.Exists(ctx, "certificates/a") || !s.Exists(ctx, "ocsp/x") || s.Exists(ctx, "certificates/c") {
+		t.Error("wrong Exists results")
+	}
+
+	info, err := s.Stat(ctx, "certificates/a/a.crt")
+	if err != nil || !info.IsTerminal || info.Size != int64(len("value of certificates/a/a.crt")) {
+		t.Errorf("unexpected key info %+v (%v)", info, err)
+	}
+	if info, err := s.Stat(ctx, "certificates/a"); err != nil || info.IsTerminal {
+		t.Errorf("expected directory info, got %+v (%v)", info, err)
+	}
+
+	keys, err := s.List(ctx, "certificates", false)
+	if err != nil || fmt.Sprint(keys) != "[certificates/a certificates/b]" {
+		t.Errorf("unexpected non-recursive listing %v (%v)", keys, err)
+	}
+	keys, err = s.List(ctx, "certificates", true)
+	if err != nil || len(keys) != 5 {
+		t.Errorf("expected 5 keys in recursive listing, got %v (%v)", keys, err)
+	}
+
+	if err := s.Delete(ctx, "certificates/a"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Exists(ctx, "certificates/a/a.crt") || !s.Exists(ctx, "certificates/b/b.crt") {
+		t.Error("expected directory to be deleted with its keys only")
+	}
+
+	// locks are exclusive until released
+	if err := s.Lock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := s.Lock(waitCtx, "issue_cert_example.com"); err == nil {
+		t.Fatal("expected held lock to block")
+	}
+	acquired := make(chan error, 1)
+	go func() { acquired <- s.Lock(ctx, "issue_cert_example.com") }()
+	if err := s.Unlock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock was not handed over after release")
+	}
+	if err := s.Unlock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleLockIsTakenOver(t *testing.T) {
+	s := NewMemoryStorage()
+	buf, _ := json.Marshal(lockMeta{Created: time.Now().Add(-time.Hour), Updated: time.Now().Add(-time.Hour)})
+	_ = s.db.update(func(tx kvTx) error { return tx.put(locksBucket, "abandoned", buf) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Lock(ctx, "abandoned"); err != nil {
+		t.Fatalf("expected stale lock to be taken over: %v", err)
+	}
+	_ = s.Unlock(ctx, "abandoned")
+}
+
+func TestBoltSharedAndTransactional(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	first := provisionBolt(t, path)
+
+	// a reload opens the same file while the old config still has it
+	second := provisionBolt(t, path)
+	if first.db != second.db {
+		t.Fatal("expected configs to share the open database")
+	}
+
+	err := second.Update("fakeip", func(b *bbolt.Bucket) error {
+		return b.Put([]byte("198.18.0.1"), []byte("example.com"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = second.Update("fakeip", func(b *bbolt.Bucket) error {
+		if err := b.Put([]byte("198.18.0.2"), []byte("example.org")); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("expected update to fail")
+	}
+	err = first.View("fakeip", func(b *bbolt.Bucket) error {
+		if v := b.Get([]byte("198.18.0.1")); string(v) != "example.com" {
+			t.Errorf("expected committed mapping, got %q", v)
+		}
+		if v := b.Get([]byte("198.18.0.2")); v != nil {
+			t.Errorf("expected aborted write to be rolled back, got %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Update(keysBucket, func(*bbolt.Bucket) error { return nil }); err == nil {
+		t.Error("expected reserved bucket to be rejected")
+	}
+}
+
+func TestStorageConfig(t *testing.T) {
+	uni.ConfigAutosavePath = filepath.Join(t.TempDir(), "autosave.json")
+	cfg := fmt.Sprintf(`{"admin": {"disabled": true}, "storage": {"module": "bolt", "path": %q}}`,
+		filepath.Join(t.TempDir(), "guard.db"))
+	if err := uni.Load([]byte(cfg), true); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = uni.Load([]byte(`{"admin": {"disabled": true}}`), true) }()
+	if _, ok := uni.ActiveContext().Storage().(*BoltStorage); !ok {
+		t.Errorf("expected bolt storage, got %T", uni.ActiveContext().Storage())
+	}
+}
@@ -21,13 +21,16 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // The documentation about this IPC protocol is available here:
 // https://www.freedesktop.org/software/systemd/man/sd_notify.html
 
 func sdNotify(payload string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
 	if socketPath == "" {
 		return nil
 	}
@@ -63,6 +66,13 @@ func Stopping() error {
 	return sdNotify("STOPPING=1")
 }
 
+// MainPID tells systemd that the main process of the
+// service is now the process with the given pid, e.g.
+// after handing over to an upgraded binary.
+func MainPID(pid int) error {
+	return sdNotify(fmt.Sprintf("MAINPID=%d", pid))
+}
+
 // Status sends systemd an updated status message.
 func Status(msg string) error {
 	return sdNotify("STATUS=" + msg)
@@ -79,4 +89,42 @@ func Error(err error, errno int) error {
 	return sdNotify(msg)
 }
 
-var socketPath, _ = os.LookupEnv("NOTIFY_SOCKET")
+// Watchdog sends systemd a watchdog keep-alive. It must be
+// sent more often than the interval returned by
+// WatchdogInterval, or systemd considers the service hung.
+func Watchdog() error {
+	return sdNotify("WATCHDOG=1")
+}
+
+// WatchdogInterval returns the watchdog timeout that systemd
+// enforces on this process (WatchdogSec= in the unit file),
+// or 0 if the watchdog is not enabled for this process.
+func WatchdogInterval() (time.Duration, error) {
+	usecEnv := os.Getenv("WATCHDOG_USEC")
+	if usecEnv == "" {
+		return 0, nil
+	}
+	if pidEnv := os.Getenv("WATCHDOG_PID"); pidEnv != "" {
+		pid, err := strconv.Atoi(pidEnv)
+		if err != nil {
+			return 0, fmt.Errorf("invalid WATCHDOG_PID: %v", err)
+		}
+		if pid != os.Getpid() {
+			// the watchdog is meant for another process
+			return 0, nil
+		}
+	}
+	usec, err := strconv.ParseInt(usecEnv, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC: %q", usecEnv)
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// ExtendTimeout asks systemd to extend the timeout of the
+// current start, reload or stop operation to d from now.
+// It has to be sent again before d elapses if more time
+// is needed.
+func ExtendTimeout(d time.Duration) error {
+	return sdNotify(fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d", d.Microseconds()))
+}
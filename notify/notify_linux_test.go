@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotifySocket opens a unixgram socket standing in for
+// systemd's notification socket and points NOTIFY_SOCKET at it.
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotification(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifications(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	for i, tc := range []struct {
+		send   func() error
+		expect string
+	}{
+		{send: Ready, expect: "READY=1"},
+		{send: Watchdog, expect: "WATCHDOG=1"},
+		{send: func() error { return Status("2 apps running") }, expect: "STATUS=2 apps running"},
+		{send: func() error { return ExtendTimeout(15 * time.Second) }, expect: "EXTEND_TIMEOUT_USEC=15000000"},
+		{send: func() error { return MainPID(42) }, expect: "MAINPID=42"},
+	} {
+		if err := tc.send(); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if actual := readNotification(t, conn); actual != tc.expect {
+			t.Errorf("Test %d: expected %q, got %q", i, tc.expect, actual)
+		}
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	for i, tc := range []struct {
+		usec, pid string
+		expect    time.Duration
+		shouldErr bool
+	}{
+		{usec: "", expect: 0},
+		{usec: "30000000", expect: 30 * time.Second},
+		{usec: "30000000", pid: pid, expect: 30 * time.Second},
+		{usec: "30000000", pid: "1", expect: 0},
+		{usec: "soon", shouldErr: true},
+	} {
+		t.Setenv("WATCHDOG_USEC", tc.usec)
+		t.Setenv("WATCHDOG_PID", tc.pid)
+		actual, err := WatchdogInterval()
+		if tc.shouldErr != (err != nil) {
+			t.Errorf("Test %d: expected error=%v, got %v", i, tc.shouldErr, err)
+		}
+		if actual != tc.expect {
+			t.Errorf("Test %d: expected %s, got %s", i, tc.expect, actual)
+		}
+	}
+}
@@ -16,8 +16,14 @@
 
 package notify
 
-func Ready() error               { return nil }
-func Reloading() error           { return nil }
-func Stopping() error            { return nil }
-func Status(_ string) error      { return nil }
-func Error(_ error, _ int) error { return nil }
+import "time"
+
+func Ready() error                             { return nil }
+func Reloading() error                         { return nil }
+func Stopping() error                          { return nil }
+func MainPID(_ int) error                      { return nil }
+func Status(_ string) error                    { return nil }
+func Error(_ error, _ int) error               { return nil }
+func Watchdog() error                          { return nil }
+func WatchdogInterval() (time.Duration, error) { return 0, nil }
+func ExtendTimeout(_ time.Duration) error      { return nil }
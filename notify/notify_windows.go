@@ -17,6 +17,7 @@ package notify
 import (
 	"log"
 	"strings"
+	"time"
 
 	"golang.org/x/sys/windows/svc"
 )
@@ -62,6 +63,20 @@ func Stopping() error {
 	return nil
 }
 
+// MainPID is a no-op on Windows, where the SCM
+// tracks the service process itself.
+func MainPID(_ int) error { return nil }
+
+// Watchdog is a no-op on Windows, which has no
+// service watchdog.
+func Watchdog() error { return nil }
+
+// WatchdogInterval always returns 0 on Windows.
+func WatchdogInterval() (time.Duration, error) { return 0, nil }
+
+// ExtendTimeout is a no-op on Windows.
+func ExtendTimeout(_ time.Duration) error { return nil }
+
 // Status sends an arbitrary service state to the SCM based on a string
 // identifier of [svc.State].
 // The unknown states will be logged.
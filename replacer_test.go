@@ -0,0 +1,146 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplacer(t *testing.T) {
+	rep := NewEmptyReplacer()
+	rep.Set("conn.src_ip", "192.0.2.1")
+	rep.Set("empty", "")
+
+	for i, tc := range []struct {
+		input, empty, expect string
+	}{
+		{input: "{", expect: "{"},
+		{input: "foo{", expect: "foo{"},
+		{input: "{conn.src_ip}", expect: "192.0.2.1"},
+		{input: "src={conn.src_ip}:{unknown}", expect: "src=192.0.2.1:"},
+		{input: "{empty}", empty: "-", expect: "-"},
+		{input: `\{conn.src_ip\}`, expect: "{conn.src_ip}"},
+		{input: `{conn.src_ip`, expect: "{conn.src_ip"},
+	} {
+		if actual := rep.ReplaceAll(tc.input, tc.empty); actual != tc.expect {
+			t.Errorf("Test %d: '%s': expected '%s' but got '%s'", i, tc.input, tc.expect, actual)
+		}
+	}
+
+	if actual := rep.ReplaceKnown("{conn.src_ip} {unknown}", ""); actual != "192.0.2.1 {unknown}" {
+		t.Errorf("expected unknown placeholder to be kept, got '%s'", actual)
+	}
+	if _, err := rep.ReplaceOrErr("{unknown}", false, true); err == nil {
+		t.Error("expected error for unknown placeholder")
+	}
+	if _, err := rep.ReplaceOrErr("{empty}", true, false); err == nil {
+		t.Error("expected error for empty placeholder")
+	}
+}
+
+func TestReplacerDefaults(t *testing.T) {
+	t.Setenv("GUARD_TEST_TOKEN", "s3cret")
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("from file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+
+	rep := NewReplacer()
+	for input, expect := range map[string]string{
+		"{env.GUARD_TEST_TOKEN}": "s3cret",
+		"{file." + secret + "}":  "from file",
+		"{system.hostname}":      hostname,
+	} {
+		if actual := rep.ReplaceAll(input, ""); actual != expect {
+			t.Errorf("'%s': expected '%s' but got '%s'", input, expect, actual)
+		}
+	}
+	if _, ok := rep.WithoutFile().Get("file." + secret); ok {
+		t.Error("expected file placeholder to be unknown without file support")
+	}
+}
+
+func TestExpandConfigPlaceholders(t *testing.T) {
+	t.Setenv("GUARD_TEST_TOKEN", `"quoted"`)
+	out, err := expandConfigPlaceholders([]byte(`{"token": "{env.GUARD_TEST_TOKEN}", "list": ["{env.GUARD_TEST_TOKEN}", 1], "format": "{conn.src_ip} {time.now}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"token": "\"quoted\"", "list": ["\"quoted\"", 1], "format": "{conn.src_ip} {time.now}"}`
+	if string(out) != expect {
+		t.Errorf("expected %s, got %s", expect, out)
+	}
+
+	// numbers are kept as they are, however large, and escaped
+	// braces stay escaped for the placeholders expanded at runtime
+	t.Setenv("GUARD_TEST_HOST", "example.com")
+	for i, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{
+			input:  `{"name": "{env.GUARD_TEST_HOST}", "id": 9007199254740993, "max": 1000000000000000000000, "ratio": 0.1}`,
+			expect: `{"name": "example.com", "id": 9007199254740993, "max": 1000000000000000000000, "ratio": 0.1}`,
+		},
+		{
+			input:  `{"template": "\\{env.GUARD_TEST_HOST\\} {env.GUARD_TEST_HOST}", "{env.GUARD_TEST_HOST}": ["\\{time.now\\}"]}`,
+			expect: `{"template": "\\{env.GUARD_TEST_HOST\\} example.com", "example.com": ["\\{time.now\\}"]}`,
+		},
+		{
+			input:  `{"ok": "{}"}`,
+			expect: `{"ok": "{}"}`,
+		},
+	} {
+		out, err := expandConfigPlaceholders([]byte(tc.input))
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if string(out) != tc.expect {
+			t.Errorf("Test %d: expected %s, got %s", i, tc.expect, out)
+		}
+	}
+	if _, err := expandConfigPlaceholders([]byte(`{"name": "{env.GUARD_TEST_HOST}"`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestLoadExpandsPlaceholders(t *testing.T) {
+	t.Setenv("GUARD_TEST_APP_NAME", "from env")
+	cfg := `{"admin": {"disabled": true}, "apps": {"test_app": {"name": "{env.GUARD_TEST_APP_NAME}"}}}`
+	if err := Load([]byte(cfg), true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Stop() })
+	app, err := ActiveContext().App("test_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := app.(*testApp).Name; name != "from env" {
+		t.Errorf("expected placeholder to be expanded, got %s", name)
+	}
+
+	var buf strings.Builder
+	if err := readConfig("/config/apps/test_app/name", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "{env.GUARD_TEST_APP_NAME}") {
+		t.Errorf("expected raw config to keep the placeholder, got %s", buf.String())
+	}
+}
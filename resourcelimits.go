@@ -0,0 +1,168 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/KimMachineGun/automemlimit/memlimit"
+	"go.uber.org/automaxprocs/maxprocs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/exp/zapslog"
+)
+
+// defaultMemoryLimitRatio is the share of the available memory
+// that is used as the Go runtime's memory limit by default; the
+// rest is headroom for memory the runtime does not know about.
+const defaultMemoryLimitRatio = 0.9
+
+// ResourceLimits configures how much of the machine's (or
+// container's) resources the process may use. The limits are
+// applied when the process starts and again whenever a config
+// that changes them is loaded.
+type ResourceLimits struct {
+	// The soft limit on the number of open files (RLIMIT_NOFILE)
+	// to set. Every connection takes at least one file descriptor,
+	// so the default is to raise the soft limit to the hard limit.
+	// The limit is never raised beyond the hard limit. Only
+	// supported on Linux.
+	MaxOpenFiles uint64 `json:"max_open_files,omitempty"`
+
+	// If true, GOMAXPROCS is not matched to the CPU quota of the
+	// cgroup the process runs in. A GOMAXPROCS environment
+	// variable always takes precedence.
+	DisableCPUQuota bool `json:"disable_cpu_quota,omitempty"`
+
+	// The share of the memory limit of the cgroup (or, outside
+	// of one, of the system memory) to use as the soft memory
+	// limit of the Go runtime, in the range (0, 1]; 0 stands for
+	// the default of 0.9.
+	// A GOMEMLIMIT environment variable always takes precedence.
+	MemoryLimitRatio float64 `json:"memory_limit_ratio,omitempty"`
+
+	// If true, the Go runtime's memory limit is not set.
+	DisableMemoryLimit bool `json:"disable_memory_limit,omitempty"`
+}
+
+func (rl *ResourceLimits) validate() error {
+	if rl.MemoryLimitRatio < 0 || rl.MemoryLimitRatio > 1 {
+		return fmt.Errorf("memory_limit_ratio must be in (0, 1], or 0 for the default; got %v", rl.MemoryLimitRatio)
+	}
+	return nil
+}
+
+// appliedResourceLimits is the state left behind by the
+// last call to SetResourceLimits.
+var appliedResourceLimits struct {
+	sync.Mutex
+	limits       *ResourceLimits
+	undoMaxProcs func()
+}
+
+// SetResourceLimits applies limits to the process and logs what
+// was applied; a nil limits applies the defaults. It returns a
+// function that restores GOMAXPROCS to its original value, which
+// should be called before the process exits.
+func SetResourceLimits(logger *zap.Logger, limits *ResourceLimits) func() {
+	appliedResourceLimits.Lock()
+	defer appliedResourceLimits.Unlock()
+
+	appliedResourceLimits.limits = limits
+	if limits == nil {
+		limits = new(ResourceLimits)
+	}
+	var fields []zap.Field
+
+	// connections are files, so make sure there are enough of them
+	openFiles, err := raiseFileLimit(limits.MaxOpenFiles)
+	if err != nil {
+		logger.Warn("failed to raise open file limit", zap.Error(err))
+	} else if openFiles > 0 {
+		fields = append(fields, zap.Uint64("max_open_files", openFiles))
+	}
+
+	// configure the maximum number of CPUs to use to match the Linux container quota (if any)
+	// See https://pkg.go.dev/runtime#GOMAXPROCS
+	if appliedResourceLimits.undoMaxProcs != nil {
+		appliedResourceLimits.undoMaxProcs()
+		appliedResourceLimits.undoMaxProcs = nil
+	}
+	if !limits.DisableCPUQuota {
+		undo, err := maxprocs.Set(maxprocs.Logger(logger.Sugar().Debugf))
+		if err != nil {
+			logger.Warn("failed to set GOMAXPROCS", zap.Error(err))
+		}
+		appliedResourceLimits.undoMaxProcs = undo
+	}
+	fields = append(fields, zap.Int("gomaxprocs", runtime.GOMAXPROCS(0)))
+
+	// configure the maximum memory to use to match the Linux container quota (if any) or system memory
+	// See https://pkg.go.dev/runtime/debug#SetMemoryLimit
+	if _, ok := os.LookupEnv("GOMEMLIMIT"); !ok {
+		if limits.DisableMemoryLimit {
+			debug.SetMemoryLimit(math.MaxInt64)
+		} else {
+			ratio := limits.MemoryLimitRatio
+			if ratio == 0 {
+				ratio = defaultMemoryLimitRatio
+			}
+			_, _ = memlimit.SetGoMemLimitWithOpts(
+				memlimit.WithRatio(ratio),
+				memlimit.WithLogger(
+					slog.New(zapslog.NewHandler(logger.Core())),
+				),
+				memlimit.WithProvider(
+					memlimit.ApplyFallback(
+						memlimit.FromCgroup,
+						memlimit.FromSystem,
+					),
+				),
+			)
+		}
+	}
+	if memLimit := debug.SetMemoryLimit(-1); memLimit != math.MaxInt64 {
+		fields = append(fields, zap.Int64("gomemlimit", memLimit))
+	}
+
+	logger.Info("applied resource limits", fields...)
+
+	return func() {
+		appliedResourceLimits.Lock()
+		defer appliedResourceLimits.Unlock()
+		if appliedResourceLimits.undoMaxProcs != nil {
+			appliedResourceLimits.undoMaxProcs()
+			appliedResourceLimits.undoMaxProcs = nil
+		}
+	}
+}
+
+// updateResourceLimits applies limits if they differ from
+// the ones that were applied last.
+func updateResourceLimits(limits *ResourceLimits) {
+	appliedResourceLimits.Lock()
+	unchanged := reflect.DeepEqual(appliedResourceLimits.limits, limits)
+	appliedResourceLimits.Unlock()
+	if unchanged {
+		return
+	}
+	SetResourceLimits(Log(), limits)
+}
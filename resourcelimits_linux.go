@@ -0,0 +1,25 @@
+package uni
+
+import "syscall"
+
+// raiseFileLimit raises the soft limit on open files to want,
+// or to the hard limit if want is 0 or above it, and returns
+// the resulting soft limit.
+func raiseFileLimit(want uint64) (uint64, error) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, err
+	}
+	target := rlim.Max
+	if want > 0 && want < target {
+		target = want
+	}
+	if rlim.Cur == target {
+		return target, nil
+	}
+	rlim.Cur = target
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, err
+	}
+	return target, nil
+}
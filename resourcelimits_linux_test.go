@@ -0,0 +1,40 @@
+package uni
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestRaiseFileLimit(t *testing.T) {
+	var orig syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &orig); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &orig); err != nil {
+			t.Errorf("restoring the open file limit: %v", err)
+		}
+	})
+
+	limit, err := raiseFileLimit(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != orig.Max {
+		t.Errorf("expected soft limit to be raised to the hard limit %d, got %d", orig.Max, limit)
+	}
+	// lowering the soft limit is always allowed, and so is
+	// raising it back up to the hard limit afterwards
+	if limit > 1024 {
+		lowered, err := raiseFileLimit(1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lowered != 1024 {
+			t.Errorf("expected soft limit 1024, got %d", lowered)
+		}
+		if raised, err := raiseFileLimit(0); err != nil || raised != limit {
+			t.Errorf("expected soft limit to be raised back to %d, got %d (%v)", limit, raised, err)
+		}
+	}
+}
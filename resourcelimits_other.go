@@ -0,0 +1,9 @@
+//go:build !linux
+
+package uni
+
+// raiseFileLimit is a no-op on this platform; it returns
+// 0 to indicate that the limit was left alone.
+func raiseFileLimit(uint64) (uint64, error) {
+	return 0, nil
+}
@@ -0,0 +1,39 @@
+package uni
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResourceLimitsValidation(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	for i, tc := range []struct {
+		ratio     string
+		shouldErr bool
+	}{
+		{ratio: "1.5", shouldErr: true},
+		{ratio: "-0.5", shouldErr: true},
+		{ratio: "1"},
+		{ratio: "0.5"},
+		{ratio: "0"}, // the default
+	} {
+		var limits ResourceLimits
+		if err := json.Unmarshal([]byte(`{"memory_limit_ratio": `+tc.ratio+`}`), &limits); err != nil {
+			t.Fatal(err)
+		}
+		err := limits.validate()
+		if tc.shouldErr && (err == nil || !strings.Contains(err.Error(), "memory_limit_ratio")) {
+			t.Errorf("Test %d: expected ratio %s to be rejected, got: %v", i, tc.ratio, err)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected ratio %s to be accepted, got: %v", i, tc.ratio, err)
+		}
+	}
+
+	err := Load([]byte(`{"admin": {"disabled": true}, "resource_limits": {"memory_limit_ratio": 1.5}}`), true)
+	if err == nil || !strings.Contains(err.Error(), "memory_limit_ratio") {
+		t.Fatalf("expected invalid ratio to be rejected, got: %v", err)
+	}
+}
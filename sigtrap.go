@@ -8,9 +8,13 @@ import (
 	"go.uber.org/zap"
 )
 
+// TrapSignals create signal/interrupt handlers as best it can for the
+// current OS. This is a rather invasive function to call in a Go program
+// that captures signals already, so in that case it would be better to
+// implement these handlers yourself.
 func TrapSignals() {
 	trapSignalsCrossPlatform()
-
+	trapSignalsPosix()
 }
 
 // Double Check
@@ -23,11 +27,11 @@ func trapSignalsCrossPlatform() {
 		signal.Notify(shutdown, os.Interrupt)
 
 		<-shutdown
-		// TODO Log().Info("shutting down", zap.String("signal", "SIGINT"))
+		Log().Info("shutting down", zap.String("signal", "SIGINT"))
 		go exitProcessFromSignal("SIGINT")
 
 		<-shutdown
-		// TODO Log().Warn("force quit", zap.String("signal", "SIGINT"))
+		Log().Warn("force quit", zap.String("signal", "SIGINT"))
 		os.Exit(ExitCodeForceQuit)
 
 	}()
@@ -35,9 +39,7 @@ func trapSignalsCrossPlatform() {
 
 // exitProcessFromSignal exits the process from a system signal.
 func exitProcessFromSignal(sigName string) {
-	_ = sigName
-	// TODO logger := Log().With(zap.String("signal", sigName))
-	logger := &zap.Logger{}
+	logger := Log().With(zap.String("signal", sigName))
 	exitProcess(context.TODO(), logger)
 }
 
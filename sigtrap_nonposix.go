@@ -0,0 +1,5 @@
+//go:build windows || plan9 || nacl || js
+
+package uni
+
+func trapSignalsPosix() {}
@@ -1,3 +1,56 @@
 //go:build !windows && !plan9 && !nacl && !js
 
 package uni
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// trapSignalsPosix captures POSIX-only signals.
+func trapSignalsPosix() {
+	go func() {
+		sigchan := make(chan os.Signal, 1)
+		signal.Notify(sigchan, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+
+		for sig := range sigchan {
+			switch sig {
+			case syscall.SIGQUIT:
+				logger := Log().With(zap.String("signal", "SIGQUIT"))
+				logger.Info("quitting process immediately")
+				go exitProcessWith(context.TODO(), logger, exitOptions{forceQuit: true})
+
+			case syscall.SIGTERM:
+				Log().Info("shutting down apps, then terminating", zap.String("signal", "SIGTERM"))
+				go exitProcessFromSignal("SIGTERM")
+
+			case syscall.SIGHUP:
+				logger := Log().With(zap.String("signal", "SIGHUP"))
+				logger.Info("reloading config from file")
+				if err := reloadFromLastConfig(); err != nil {
+					logger.Error("unable to reload config", zap.Error(err))
+				}
+
+			case syscall.SIGUSR1:
+				logger := Log().With(zap.String("signal", "SIGUSR1"))
+				logger.Info("reopening log files")
+				if err := ReopenLogs(); err != nil {
+					logger.Error("unable to reopen log files", zap.Error(err))
+				}
+
+			case syscall.SIGUSR2:
+				logger := Log().With(zap.String("signal", "SIGUSR2"))
+				logger.Info("upgrading process")
+				go func() {
+					if err := upgradeProcess(logger); err != nil {
+						logger.Error("upgrade failed; keeping this process running", zap.Error(err))
+					}
+				}()
+			}
+		}
+	}()
+}
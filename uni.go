@@ -1,14 +1,33 @@
 package uni
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	C "uni/bridge/constant"
+	"uni/internal/filesystems"
 	"uni/notify"
 
 	"github.com/caddyserver/certmagic"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
@@ -35,12 +54,16 @@ type Config struct {
 	Admin   *AdminConfig `json:"admin,omitempty"`
 	Logging *Logging     `json:"logging,omitempty"`
 
+	// ResourceLimits tunes the process's use of file
+	// descriptors, CPUs and memory.
+	ResourceLimits *ResourceLimits `json:"resource_limits,omitempty"`
+
 	// StorageRaw is a storage module that defines how/where Caddy
 	// stores assets (such as TLS certificates). The default storage
-	// module is `caddy.storage.file_system` (the local file system),
+	// module is `uni.storage.file_system` (the local file system),
 	// and the default path
 	// [depends on the OS and environment](/docs/conventions#data-directory).
-	StorageRaw json.RawMessage `json:"storage,omitempty" caddy:"namespace=caddy.storage inline_key=module"`
+	StorageRaw json.RawMessage `json:"storage,omitempty" caddy:"namespace=uni.storage inline_key=module"`
 
 	// AppsRaw are the apps that Caddy will load and run. The
 	// app module name is the key, and the app's config is the
@@ -49,6 +72,15 @@ type Config struct {
 
 	apps map[string]App
 
+	// appsMu protects apps and failedApps, which
+	// App may add to while the config is running.
+	appsMu sync.RWMutex
+
+	// appOrder is the order in which apps are started:
+	// every app comes after the apps it depends on. Apps
+	// are stopped in the reverse order.
+	appOrder []string
+
 	// failedApps is a map of apps that failed to provision with their underlying error.
 	failedApps   map[string]error
 	storage      certmagic.Storage
@@ -56,14 +88,75 @@ type Config struct {
 
 	cancelFunc context.CancelFunc
 
-	// fileSystems is a dict of fileSystems that will later be loaded from and added to.
+	// fileSystems is the registry of named file systems,
+	// which the file systems app adds to.
 	fileSystems FileSystems
 }
 
-// App is a thing that Guard Runs
+// App is a thing that Guard runs. Apps are top-level
+// modules (their IDs have no namespace) configured in
+// the "apps" field of the config.
+//
+// Start must not block; it should launch any long-running
+// work in goroutines and return once the app is running.
+// If Start returns an error, the whole config is rolled
+// back. Stop is called when the config is replaced or the
+// process exits, and should release everything Start
+// acquired.
 type App interface {
-	Start()
-	Stop()
+	Start() error
+	Stop() error
+}
+
+// AppDependent is an optional interface for apps that
+// must be started after, and stopped before, other apps.
+// Dependencies returns the IDs of those apps; it is called
+// once the app is provisioned, so it may depend on the
+// app's config. A dependency that is not configured is
+// loaded with its zero config, like Context.App does.
+// Cyclic dependencies fail the config at load time.
+type AppDependent interface {
+	Dependencies() []string
+}
+
+// HealthChecker is an optional interface for apps that
+// can tell whether they are working properly. Healthy
+// returns an error describing the problem if not. While
+// any app is unhealthy, the service manager's watchdog
+// is not kept alive; see notify.Watchdog.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// AppErrors reports the apps of a config that failed
+// to be provisioned or started, keyed by app ID.
+type AppErrors map[string]error
+
+func (e AppErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var sb strings.Builder
+	for i, id := range ids {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		fmt.Fprintf(&sb, "%s app module: %v", id, e[id])
+	}
+	return sb.String()
+}
+
+// Unwrap returns the errors of each failed app, so that
+// errors.Is and errors.As can inspect them.
+func (e AppErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
 }
 
 // Load loads the given config JSON and runs it only
@@ -74,6 +167,12 @@ func Load(cfgJSON []byte, forceReload bool) error {
 		Log().Error("unable to notify service manager of reloading state", zap.Error(err))
 	}
 
+	// a large config may take a while to load, so keep
+	// the service manager from timing out in the meantime
+	done := make(chan struct{})
+	defer close(done)
+	go extendTimeoutWhile(done)
+
 	// after reload, notify system of success or, if
 	// failure, update with status (error message)
 	var err error
@@ -94,19 +193,925 @@ func Load(cfgJSON []byte, forceReload bool) error {
 	return err
 }
 
-// TODO
+// SetLastConfig records the file the running config was loaded
+// from, along with a function that loads the config from that
+// file again; it is called when the config is to be reloaded
+// from its source, e.g. on SIGHUP. An empty file clears it.
+func SetLastConfig(file string, loadFunc func(file string) error) {
+	lastConfigMu.Lock()
+	defer lastConfigMu.Unlock()
+	lastConfigFile = file
+	lastConfigLoad = loadFunc
+}
+
+// reloadFromLastConfig reloads the config from the file it
+// was last loaded from, as recorded by SetLastConfig.
+func reloadFromLastConfig() error {
+	lastConfigMu.RLock()
+	file, loadFunc := lastConfigFile, lastConfigLoad
+	lastConfigMu.RUnlock()
+	if file == "" || loadFunc == nil {
+		return fmt.Errorf("no config file to reload from")
+	}
+	return loadFunc(file)
+}
+
 func changeConfig(method, path string, input []byte, ifMatchHeader string, forceReload bool) error {
+	switch method {
+	case http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodConnect,
+		http.MethodTrace:
+		return fmt.Errorf("method not allowed")
+	}
+
+	rawCfgMu.Lock()
+	defer rawCfgMu.Unlock()
+
+	path, err := unsyncedResolveIDPath(path)
+	if err != nil {
+		return err
+	}
+
+	if ifMatchHeader != "" {
+		// expect the first and last character to be quotes
+		if len(ifMatchHeader) < 2 || ifMatchHeader[0] != '"' || ifMatchHeader[len(ifMatchHeader)-1] != '"' {
+			return APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("malformed If-Match header; expect quoted string"),
+			}
+		}
+
+		// read out the parts
+		parts := strings.Fields(ifMatchHeader[1 : len(ifMatchHeader)-1])
+		if len(parts) != 2 {
+			return APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("malformed If-Match header; expect format \"<path> <hash>\""),
+			}
+		}
+
+		// get the current hash of the config
+		// at the given path
+		etagPath, err := unsyncedResolveIDPath(parts[0])
+		if err != nil {
+			return err
+		}
+		hash := etagHasher()
+		err = unsyncedConfigAccess(http.MethodGet, etagPath, nil, hash)
+		if err != nil {
+			return err
+		}
+
+		expected := parts[1]
+		actual := hex.EncodeToString(hash.Sum(nil))
+
+		if expected != actual {
+			return APIError{
+				HTTPStatus: http.StatusPreconditionFailed,
+				Err:        fmt.Errorf("If-Match header did not match current config hash"),
+			}
+		}
+	}
+
+	err = unsyncedConfigAccess(method, path, input, nil)
+	if err != nil {
+		return err
+	}
+
+	// the mutation is complete, so encode the entire config as JSON
+	newCfg, err := json.Marshal(rawCfg[rawConfigKey])
+	if err != nil {
+		return APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("encoding new config: %v", err),
+		}
+	}
+
+	// if nothing changed, no need to do a whole reload unless the client forces it
+	if !forceReload && bytes.Equal(rawCfgJSON, newCfg) {
+		Log().Info("config is unchanged")
+		return nil
+	}
+
+	// find any IDs in this config and index them
+	idx := make(map[string]string)
+	err = indexConfigObjects(rawCfg[rawConfigKey], "/"+rawConfigKey, idx)
+	if err != nil {
+		return APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        fmt.Errorf("indexing config: %v", err),
+		}
+	}
+
+	// load this new config; if it fails, we need to revert to
+	// our old representation of Guard's actual config
+	err = unsyncedDecodeAndRun(newCfg, true)
+	recordConfigReload(err)
+	if err != nil {
+		if len(rawCfgJSON) > 0 {
+			// restore old config state to keep it consistent
+			// with what Guard is still running; we need to
+			// unmarshal it again because it's likely that
+			// pointers deep in our rawCfg map were modified
+			var oldCfg any
+			err2 := json.Unmarshal(rawCfgJSON, &oldCfg)
+			if err2 != nil {
+				err = fmt.Errorf("%v; additionally, restoring old config: %v", err, err2)
+			}
+			rawCfg[rawConfigKey] = oldCfg
+		} else {
+			rawCfg[rawConfigKey] = nil
+		}
+
+		return fmt.Errorf("loading new config: %w", err)
+	}
+
+	// success, so update our stored copy of the encoded
+	// config to keep it consistent with what Guard is now
+	// running (storing an encoded copy is not strictly
+	// necessary, but avoids an extra json.Marshal for
+	// each config change)
+	rawCfgJSON = newCfg
+	rawCfgIndex = idx
+
 	return nil
 }
 
-// TODO
+// readConfig traverses the current config to path
+// and writes its JSON encoding to out.
+func readConfig(path string, out io.Writer) error {
+	rawCfgMu.RLock()
+	defer rawCfgMu.RUnlock()
+	path, err := unsyncedResolveIDPath(path)
+	if err != nil {
+		return err
+	}
+	return unsyncedConfigAccess(http.MethodGet, path, nil, out)
+}
+
+// unsyncedResolveIDPath expands a path of the form /id/<name>/...
+// into the config path of the object whose "@id" field is <name>,
+// followed by the rest of the path. Any other path is returned
+// unchanged. A read or write lock on rawCfgMu is required.
+func unsyncedResolveIDPath(path string) (string, error) {
+	trimmed, ok := strings.CutPrefix(path, "/"+idPathPrefix+"/")
+	if !ok {
+		return path, nil
+	}
+	id, rest, _ := strings.Cut(trimmed, "/")
+	if id == "" {
+		return "", APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("missing ID in path: %s", path),
+		}
+	}
+
+	expanded, ok := rawCfgIndex[id]
+	if !ok {
+		return "", APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("unknown object ID '%s'", id),
+		}
+	}
+
+	if rest != "" {
+		expanded += "/" + rest
+	}
+	return expanded, nil
+}
+
+// indexConfigObjects recursively searches ptr for object fields named
+// "@id" and maps that ID value to the full configPath in the index.
+// This function is NOT safe for concurrent access; obtain a write lock
+// on rawCfgMu.
+func indexConfigObjects(ptr any, configPath string, index map[string]string) error {
+	switch val := ptr.(type) {
+	case map[string]any:
+		for k, v := range val {
+			if k == idKey {
+				var idStr string
+				switch idVal := v.(type) {
+				case string:
+					idStr = idVal
+				case float64: // all JSON numbers decode as float64
+					idStr = fmt.Sprintf("%v", idVal)
+				default:
+					return fmt.Errorf("%s: %s field must be a string or number", configPath, idKey)
+				}
+				if existingPath, ok := index[idStr]; ok {
+					return fmt.Errorf("duplicate ID '%s' found at %s and %s", idStr, existingPath, configPath)
+				}
+				index[idStr] = configPath
+				continue
+			}
+			// traverse this object property recursively
+			err := indexConfigObjects(val[k], path.Join(configPath, k), index)
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		// traverse each element of the array recursively
+		for i := range val {
+			err := indexConfigObjects(val[i], path.Join(configPath, strconv.Itoa(i)), index)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unsyncedDecodeAndRun removes any meta fields (like @id tags)
+// from cfgJSON, decodes the result into a *Config, and runs
+// it as the new config, replacing any other current config.
+// It does NOT update the raw config state, as this is a
+// lower-level function; most callers will want to use Load
+// instead. A write lock on rawCfgMu is required!
+func unsyncedDecodeAndRun(cfgJSON []byte, allowPersist bool) error {
+	// remove any @id fields from the JSON, which would cause
+	// loading to break since the field wouldn't be recognized
+	strippedCfgJSON := RemoveMetaFields(cfgJSON)
+
+	// expand the placeholders whose values are known now, like
+	// {env.*}; the raw config and its autosave keep them as-is
+	strippedCfgJSON, err := expandConfigPlaceholders(strippedCfgJSON)
+	if err != nil {
+		return err
+	}
+
+	var newCfg *Config
+	err = StrictUnmarshalJSON(strippedCfgJSON, &newCfg)
+	if err != nil {
+		return err
+	}
+
+	// run the new config and start all its apps
+	ctx, err := run(newCfg, true)
+	if err != nil {
+		return err
+	}
+
+	// swap old context (including its config) with the new one
+	currentCtxMu.Lock()
+	oldCtx := currentCtx
+	currentCtx = ctx
+	currentCtxMu.Unlock()
+
+	// Stop, Cleanup each old app; errors were already
+	// logged and must not fail the new config
+	_ = unsyncedStop(oldCtx)
+
+	// tune the process to the new config's resource limits
+	var limits *ResourceLimits
+	if newCfg != nil {
+		limits = newCfg.ResourceLimits
+	}
+	updateResourceLimits(limits)
+
+	ctx.emitEvent(EventConfigLoaded, nil)
+
+	// autosave a non-nil config, if not disabled; the write
+	// happens while rawCfgMu is still held, so the file on
+	// disk always reflects the most recently applied config
+	if allowPersist &&
+		newCfg != nil &&
+		(newCfg.Admin == nil ||
+			newCfg.Admin.Config == nil ||
+			newCfg.Admin.Config.Persist == nil ||
+			*newCfg.Admin.Config.Persist) {
+		logger := Log().With(zap.String("path", ConfigAutosavePath))
+		if err := writeFileAtomic(ConfigAutosavePath, cfgJSON, 0o600); err != nil {
+			logger.Error("unable to autosave config", zap.Error(err))
+		} else {
+			logger.Debug("autosaved config (load with --resume flag)")
+		}
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to the file at path by way of a
+// temporary file in the same directory which is then renamed
+// over path, so that readers never observe a partial write.
+// Missing parent directories are created.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	err = os.Rename(tmpName, path)
+	return err
+}
+
+// run runs newCfg and starts all its apps if
+// start is true. If any errors happen, cleanup
+// is performed if any modules were provisioned;
+// apps that were started already will be stopped,
+// so this function should not leak resources if
+// an error is returned. However, if no error is
+// returned and start == false, you should cancel
+// the config if you are not going to start it,
+// so that each provisioned module will be
+// cleaned up.
+//
+// The currently-running config is not touched by
+// this function: it is up to the caller to stop it
+// only once the new config has started successfully.
+//
+// This is a low-level function; most callers
+// will want to use Load instead.
+func run(newCfg *Config, start bool) (Context, error) {
+	ctx, err := provisionContext(newCfg, start)
+	if err != nil {
+		return ctx, err
+	}
+
+	if !start {
+		return ctx, nil
+	}
+
+	// Provision any admin routers which may need to access
+	// some of the other apps at runtime
+	err = ctx.cfg.Admin.provisionAdminRouters(ctx)
+	if err != nil {
+		ctx.cfg.cancelFunc()
+		return ctx, err
+	}
+
+	// Start
+	err = func() error {
+		started := make([]string, 0, len(ctx.cfg.appOrder))
+		for _, name := range ctx.cfg.appOrder {
+			a := ctx.cfg.apps[name]
+			err := a.Start()
+			if err == nil {
+				ctx.emitEvent(EventAppStarted, map[string]any{"app": name})
+			}
+			if err != nil {
+				// an app failed to start, so we need to stop
+				// all other apps that were already started,
+				// dependents before their dependencies
+				for _, otherAppName := range slices.Backward(started) {
+					err2 := ctx.cfg.apps[otherAppName].Stop()
+					if err2 != nil {
+						err = fmt.Errorf("%v; additionally, aborting app %s: %v",
+							err, otherAppName, err2)
+					}
+				}
+				ctx.cfg.failedApps[name] = fmt.Errorf("start: %w", err)
+				return AppErrors(ctx.cfg.failedApps)
+			}
+			started = append(started, name)
+		}
+		return nil
+	}()
+	if err != nil {
+		// cancel the context so that all modules
+		// get cleaned up; the old config remains
+		// in effect since it was never stopped
+		ctx.cfg.cancelFunc()
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+// provisionContext creates a new context from the given configuration and provisions
+// storage and apps.
+// If `newCfg` is nil a new empty configuration will be created.
+// If `replaceAdminServer` is true any currently active admin server will be replaced
+// with a new admin server based on the provided configuration.
+func provisionContext(newCfg *Config, replaceAdminServer bool) (Context, error) {
+	// because we will need to roll back any state
+	// modifications if this function errors, we
+	// keep a single error value and scope all
+	// sub-operations to their own functions to
+	// ensure this error value does not get
+	// overridden or missed when it should have
+	// been set by a short assignment
+	var err error
+
+	if newCfg == nil {
+		newCfg = new(Config)
+	}
+
+	// create a context within which to load
+	// modules - essentially our new config's
+	// execution environment; be sure that
+	// cleanup occurs when we return if there
+	// was an error; if no error, it will get
+	// cleaned up on next config cycle
+	ctx, cancel := NewContext(Context{Context: context.Background(), cfg: newCfg})
+	defer func() {
+		if err != nil {
+			// if there were any errors during startup,
+			// we should cancel the new context we created
+			// since the associated config won't be used;
+			// this will cause all modules that were newly
+			// provisioned to clean themselves up
+			cancel()
+
+			// also undo any other state changes we made
+			if currentCtx.cfg != nil {
+				certmagic.Default.Storage = currentCtx.cfg.storage
+			}
+		}
+	}()
+	newCfg.cancelFunc = cancel // clean up later
+
+	// set up logging before anything bad happens
+	if newCfg.Logging == nil {
+		newCfg.Logging = new(Logging)
+	}
+	err = newCfg.Logging.openLogs(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	if newCfg.ResourceLimits != nil {
+		err = newCfg.ResourceLimits.validate()
+		if err != nil {
+			return ctx, fmt.Errorf("resource limits: %v", err)
+		}
+	}
+
+	// start the admin endpoint (and stop any prior one)
+	if replaceAdminServer {
+		err = replaceLocalAdminServer(newCfg)
+		if err != nil {
+			return ctx, fmt.Errorf("starting admin endpoint: %v", err)
+		}
+	}
+
+	// prepare the new config for use
+	newCfg.apps = make(map[string]App)
+	newCfg.failedApps = make(map[string]error)
+	newCfg.fileSystems = &filesystems.FileSystemMap{}
+
+	// set up global storage and make it CertMagic's default storage, too
+	err = func() error {
+		if newCfg.StorageRaw != nil {
+			val, err := ctx.LoadModule(newCfg, "StorageRaw")
+			if err != nil {
+				return fmt.Errorf("loading storage module: %v", err)
+			}
+			stor, err := val.(StorageConverter).CertMagicStorage()
+			if err != nil {
+				return fmt.Errorf("creating storage value: %v", err)
+			}
+			newCfg.storage = stor
+		}
+
+		if newCfg.storage == nil {
+			newCfg.storage = DefaultStorage
+		}
+		certmagic.Default.Storage = newCfg.storage
+
+		return nil
+	}()
+	if err != nil {
+		return ctx, err
+	}
+
+	// Load and Provision each app and their submodules;
+	// keep going after a failure so that every broken
+	// app is reported at once. The file systems app goes
+	// first, so that the other apps can resolve the files
+	// they refer to while they are being provisioned
+	appNames := make([]string, 0, len(newCfg.AppsRaw))
+	if _, ok := newCfg.AppsRaw[FileSystemsAppName]; ok {
+		appNames = append(appNames, FileSystemsAppName)
+	}
+	for appName := range newCfg.AppsRaw {
+		if appName != FileSystemsAppName {
+			appNames = append(appNames, appName)
+		}
+	}
+	for _, appName := range appNames {
+		if _, appErr := ctx.App(appName); appErr != nil {
+			if _, ok := newCfg.failedApps[appName]; !ok {
+				newCfg.failedApps[appName] = appErr
+			}
+		}
+	}
+	if len(newCfg.failedApps) > 0 {
+		err = AppErrors(newCfg.failedApps)
+		return ctx, err
+	}
+
+	// now that all apps are known, work out the order
+	// in which they have to be started
+	newCfg.appOrder, err = sortApps(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+// sortApps returns the names of the apps in ctx in the
+// order they must be started, dependencies first. Any
+// dependency that is not loaded yet is loaded through
+// ctx.App. Apps without an ordering constraint between
+// them are sorted by name so that the order is stable.
+func sortApps(ctx Context) ([]string, error) {
+	cfg := ctx.cfg
+
+	// collect the dependencies of every app; loading a
+	// dependency may load further apps, so keep going
+	// until every loaded app has been looked at
+	deps := make(map[string][]string, len(cfg.apps))
+	for {
+		var pending []string
+		for name := range cfg.apps {
+			if _, ok := deps[name]; !ok {
+				pending = append(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		sort.Strings(pending)
+		for _, name := range pending {
+			deps[name] = nil
+			dependent, ok := cfg.apps[name].(AppDependent)
+			if !ok {
+				continue
+			}
+			for _, dep := range dependent.Dependencies() {
+				if _, err := ctx.App(dep); err != nil {
+					cfg.failedApps[name] = fmt.Errorf("dependency %s: %v", dep, err)
+					continue
+				}
+				if !slices.Contains(deps[name], dep) {
+					deps[name] = append(deps[name], dep)
+				}
+			}
+			sort.Strings(deps[name])
+		}
+	}
+	if len(cfg.failedApps) > 0 {
+		return nil, AppErrors(cfg.failedApps)
+	}
+
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// depth-first search; an app that is reached again
+	// while its own dependencies are being visited is
+	// part of a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(names))
+	order := make([]string, 0, len(names))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(slices.Clone(path[slices.Index(path, name):]), name)
+			return fmt.Errorf("app dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// unsyncedStop stops ctx from running, but has
+// no locking around ctx. It is a no-op if ctx has a
+// nil cfg. If any app returns an error when stopping,
+// it is logged and the function continues stopping
+// the next app; all such errors are returned joined.
+// This function assumes all apps in ctx were
+// successfully started first.
+//
+// A lock on rawCfgMu is required, even though this
+// function does not access rawCfg, that lock
+// synchronizes the stop/start of apps.
+func unsyncedStop(ctx Context) error {
+	if ctx.cfg == nil {
+		return nil
+	}
+
+	// stop each app, in reverse start order, followed by
+	// any apps that were only loaded after the config started
+	stopOrder := slices.Clone(ctx.cfg.appOrder)
+	slices.Reverse(stopOrder)
+	var late []string
+	for name := range ctx.cfg.apps {
+		if !slices.Contains(ctx.cfg.appOrder, name) {
+			late = append(late, name)
+		}
+	}
+	sort.Strings(late)
+	stopOrder = append(stopOrder, late...)
+
+	var errs []error
+	for _, name := range stopOrder {
+		a := ctx.cfg.apps[name]
+		err := a.Stop()
+		data := map[string]any{"app": name}
+		if err != nil {
+			Log().Error("stopping app", zap.String("app", name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s app module: stop: %v", name, err))
+			data["error"] = err.Error()
+		}
+		ctx.emitEvent(EventAppStopped, data)
+	}
+
+	// clean up all modules
+	ctx.cfg.cancelFunc()
+
+	return errors.Join(errs...)
+}
+
+// RemoveMetaFields removes meta fields like "@id" from a JSON message
+// by using a simple regular expression. (An alternate way to do this
+// would be to delete them from the raw, map[string]any
+// representation as they are indexed, then iterate the index we made
+// and add them back after encoding as JSON, but this is simpler.)
+func RemoveMetaFields(rawJSON []byte) []byte {
+	return idRegexp.ReplaceAllFunc(rawJSON, func(in []byte) []byte {
+		// matches with a comma on both sides (when "@id" property is
+		// not the first or last in the object) need to keep exactly
+		// one comma for correct JSON syntax
+		comma := []byte{','}
+		if bytes.HasPrefix(in, comma) && bytes.HasSuffix(in, comma) {
+			return comma
+		}
+		return []byte{}
+	})
+}
+
+// ActiveContext returns the currently-active context.
+// This function is experimental and might be changed
+// or removed in the future.
+func ActiveContext() Context {
+	currentCtxMu.RLock()
+	defer currentCtxMu.RUnlock()
+	return currentCtx
+}
+
+// Stop stops running the current configuration.
+// It is the antithesis of Run(). This function
+// will log any errors that occur during the
+// stopping of individual apps and continue to
+// stop the others, returning all of them joined.
+// Stop should only be called if not replacing
+// with a new config.
+func Stop() error {
+	// sync with both locks
+	rawCfgMu.Lock()
+	defer rawCfgMu.Unlock()
+	currentCtxMu.Lock()
+	defer currentCtxMu.Unlock()
+
+	err := unsyncedStop(currentCtx)
+
+	currentCtx = Context{}
+	rawCfgJSON = nil
+	rawCfgIndex = nil
+	rawCfg[rawConfigKey] = nil
+
+	return err
+}
+
 // exitProcess exits the process as gracefully as possible,
 // but it always exits, even if there are errors doing so.
 // It stops all apps, cleans up external locks, removes any
 // PID file, and shuts down admin endpoint(s) in a goroutine.
 // Errors are logged along the way, and an appropriate exit
 // code is emitted.
-func exitProcess(ctx context.Context, logger *zap.Logger) {}
+func exitProcess(ctx context.Context, logger *zap.Logger) {
+	exitProcessWith(ctx, logger, exitOptions{})
+}
+
+// exitOptions change how exitProcessWith exits.
+type exitOptions struct {
+	// forceQuit gives the apps only forceQuitStopTimeout
+	// to stop, and exits with ExitCodeForceQuit.
+	forceQuit bool
+
+	// handedOver is set if another process has become the main
+	// process of the service, so the service manager must not
+	// be told that the service is stopping.
+	handedOver bool
+}
+
+// exitProcessWith is like exitProcess, with opts.
+func exitProcessWith(ctx context.Context, logger *zap.Logger, opts exitOptions) {
+	// let the rest of the program know we're quitting; only do it once
+	if !exiting.CompareAndSwap(false, true) {
+		if opts.forceQuit {
+			// already exiting, but taking too long
+			quitNow(ctx, logger)
+		}
+		return
+	}
+
+	// give the OS or service/process manager our 2 weeks' notice: we quit
+	if !opts.handedOver {
+		if err := notify.Stopping(); err != nil {
+			Log().Error("unable to notify service manager of stopping state", zap.Error(err))
+		}
+	}
+
+	if logger == nil {
+		logger = Log()
+	}
+	logger.Warn("exiting; byeee!! 👋")
+
+	exitCode := ExitCodeSuccess
+	warnAfter, giveUpAfter := stopTimeout, fatalStopTimeout
+	if opts.forceQuit {
+		exitCode = ExitCodeForceQuit
+		warnAfter, giveUpAfter = forceQuitStopTimeout, forceQuitStopTimeout
+	}
+	lastContext := ActiveContext()
+
+	// stop all apps
+	if err := stopWithinBudget(logger, warnAfter, giveUpAfter); err != nil {
+		logger.Error("failed to stop apps", zap.Error(err))
+		exitCode = ExitCodeFailedQuit
+	}
+
+	// clean up certmagic locks
+	certmagic.CleanUpOwnLocks(ctx, logger)
+
+	// remove pidfile
+	if err := removePIDFile(); err != nil {
+		logger.Error("cleaning up PID file:",
+			zap.String("pidfile", pidfile),
+			zap.Error(err))
+		exitCode = ExitCodeFailedQuit
+	}
+
+	// execute any process-exit callbacks
+	if lastContext.exitFuncs != nil {
+		for _, exitFunc := range *lastContext.exitFuncs {
+			exitFunc(ctx)
+		}
+	}
+
+	// shut down admin endpoint(s) in goroutines so that
+	// if this function was called from an admin handler,
+	// it has a chance to return gracefully
+	// use goroutine so that we can finish responding to API request
+	go func() {
+		defer func() {
+			logger = logger.With(zap.Int("exit_code", exitCode))
+			if exitCode != ExitCodeFailedQuit {
+				logger.Info("shutdown complete")
+			} else {
+				logger.Error("unclean shutdown")
+			}
+			// check if we are in test environment, and dont call exit if we are
+			if flag.Lookup("test.v") == nil && !strings.Contains(os.Args[0], ".test") {
+				os.Exit(exitCode)
+			}
+		}()
+
+		serverMu.Lock()
+		adminServer := localAdminServer
+		localAdminServer = nil
+		serverMu.Unlock()
+		if adminServer != nil {
+			err := stopAdminServer(adminServer)
+			if err != nil {
+				exitCode = ExitCodeFailedQuit
+				logger.Error("failed to stop local admin server gracefully", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// quitNow exits the process at once, cleaning up only
+// what would outlive it: external locks and the PID file.
+func quitNow(ctx context.Context, logger *zap.Logger) {
+	if logger == nil {
+		logger = Log()
+	}
+	certmagic.CleanUpOwnLocks(ctx, logger)
+	if err := removePIDFile(); err != nil {
+		logger.Error("cleaning up PID file:",
+			zap.String("pidfile", pidfile),
+			zap.Error(err))
+	}
+	if flag.Lookup("test.v") == nil && !strings.Contains(os.Args[0], ".test") {
+		os.Exit(ExitCodeForceQuit)
+	}
+}
+
+// removePIDFile removes the PID file written by PIDFile, if any.
+func removePIDFile() error {
+	if pidfile == "" {
+		return nil
+	}
+	return os.Remove(pidfile)
+}
+
+// How long the apps get to stop when the process exits: a warning
+// is logged after stopTimeout, and they are abandoned after
+// fatalStopTimeout, or after forceQuitStopTimeout when quitting
+// by force. They are variables so tests can shorten them.
+var (
+	stopTimeout          = C.StopTimeout
+	fatalStopTimeout     = C.FatalStopTimeout
+	forceQuitStopTimeout = time.Second
+)
+
+// stopWithinBudget stops the running config, warning once
+// the apps take longer than warnAfter and giving up on
+// them after giveUpAfter, so that a hung app cannot
+// keep the process from exiting.
+func stopWithinBudget(logger *zap.Logger, warnAfter, giveUpAfter time.Duration) error {
+	done := make(chan error, 1)
+	go func() { done <- Stop() }()
+
+	remaining := giveUpAfter
+	if warnAfter < giveUpAfter {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(warnAfter):
+			logger.Warn("apps are taking long to stop",
+				zap.Duration("waited", warnAfter))
+		}
+		remaining -= warnAfter
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(remaining):
+		return fmt.Errorf("apps did not stop within %s; abandoning them", giveUpAfter)
+	}
+}
+
+// PIDFile writes a pidfile to the file at filename. It
+// will get deleted before the process gracefully exits.
+func PIDFile(filename string) error {
+	pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+	err := os.WriteFile(filename, pid, 0o600)
+	if err != nil {
+		return err
+	}
+	pidfile = filename
+	return nil
+}
+
+// Exiting returns true if the process is exiting.
+func Exiting() bool { return exiting.Load() }
 
 // Duration can be an integer or a string. An integer is
 // interpreted as nanoseconds. If a string, it is a Go
@@ -114,8 +1119,162 @@ func exitProcess(ctx context.Context, logger *zap.Logger) {}
 // valid units are `ns`, `us`/`µs`, `ms`, `s`, `m`, `h`, and `d`.
 type Duration time.Duration
 
-// TODO
-type Event struct{}
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if len(b) == 0 {
+		return io.EOF
+	}
+	var dur time.Duration
+	var err error
+	if b[0] == byte('"') && b[len(b)-1] == byte('"') {
+		dur, err = ParseDuration(strings.Trim(string(b), `"`))
+	} else {
+		err = json.Unmarshal(b, &dur)
+	}
+	*d = Duration(dur)
+	return err
+}
+
+// Event represents something that has happened or is happening.
+// An Event value is not synchronized, so it should be copied if
+// being used in goroutines.
+//
+// EXPERIMENTAL: Events are subject to change.
+type Event struct {
+	// If non-nil, the event has been aborted, meaning
+	// propagation has stopped to other handlers and
+	// the code should stop what it was doing. Emitters
+	// may choose to use this as a signal to adjust their
+	// code path appropriately.
+	Aborted error
+
+	// The data associated with the event. Usually the
+	// original emitter will be the only one to set or
+	// change these values, but the field is exported
+	// so handlers can have full access if needed.
+	// However, this map is not synchronized, so
+	// handlers must not use this map directly in new
+	// goroutines; instead, copy the map to use it in a
+	// goroutine. Data may be nil.
+	Data map[string]any
+
+	id     uuid.UUID
+	ts     time.Time
+	name   string
+	origin Module
+}
+
+// NewEvent creates a new event, but does not emit the event. To emit an
+// event, call Emit() on the current instance of the events app instead.
+//
+// EXPERIMENTAL: Subject to change.
+func NewEvent(ctx Context, name string, data map[string]any) (Event, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return Event{}, fmt.Errorf("generating new event ID: %v", err)
+	}
+	name = strings.ToLower(name)
+	if name == "" {
+		return Event{}, fmt.Errorf("event name cannot be empty")
+	}
+	return Event{
+		Data:   data,
+		id:     id,
+		ts:     time.Now(),
+		name:   name,
+		origin: ctx.Module(),
+	}, nil
+}
+
+// ID returns the unique identifier of the event.
+func (e Event) ID() uuid.UUID { return e.id }
+
+// Timestamp returns the time the event was created.
+func (e Event) Timestamp() time.Time { return e.ts }
+
+// Name returns the (lowercased) name of the event.
+func (e Event) Name() string { return e.name }
+
+// Origin returns the module that emitted the event,
+// or nil if it was emitted by the Guard core.
+func (e Event) Origin() Module { return e.origin }
+
+// ErrEventAborted cancels an event. Handlers of a
+// cancellable event may return it (optionally wrapped)
+// to stop the event from propagating and signal the
+// emitter to abandon what it was doing.
+var ErrEventAborted = fmt.Errorf("event aborted")
+
+// Names of the events emitted by the Guard core. Data
+// keys are documented alongside each name.
+const (
+	// EventConfigLoaded is emitted once a new config is
+	// running and the previous one has been stopped.
+	EventConfigLoaded = "config_loaded"
+
+	// EventAppStarted is emitted after an app started;
+	// data: "app" (the app's module ID).
+	EventAppStarted = "app_started"
+
+	// EventAppStopped is emitted after an app stopped;
+	// data: "app" (the app's module ID), "error" (if any).
+	EventAppStopped = "app_stopped"
+)
+
+var (
+	// pidfile is the path of the PID file written
+	// by PIDFile, if any; it is removed on exit.
+	pidfile string
+
+	// exiting is set once the process starts to exit.
+	exiting atomic.Bool
+)
+
+var (
+	// currentCtx is the root context for the currently-running
+	// configuration, which can be accessed through this value.
+	// If the Config contained in this value is not nil, then
+	// a config is currently active/running.
+	currentCtx   Context
+	currentCtxMu sync.RWMutex
+)
+
+var (
+	// rawCfg is the current, generic-decoded configuration;
+	// we initialize it as a map with one field ("config")
+	// to maintain parity with the API endpoint and to avoid
+	// the special case of having to access/mutate the variable
+	// directly without traversing into it.
+	rawCfg = map[string]any{
+		rawConfigKey: nil,
+	}
+
+	// rawCfgJSON is the JSON-encoded form of rawCfg. Keeping
+	// this around avoids an extra Marshal call during changes.
+	rawCfgJSON []byte
+
+	// rawCfgIndex is the map of user-assigned ID to expanded
+	// path, for converting /id/ paths to /config/ paths.
+	rawCfgIndex map[string]string
+
+	// rawCfgMu protects all the rawCfg fields and also
+	// essentially synchronizes config changes/reloads.
+	rawCfgMu sync.RWMutex
+)
+
+var (
+	// lastConfigFile and lastConfigLoad record where the
+	// running config came from; see SetLastConfig.
+	lastConfigFile string
+	lastConfigLoad func(file string) error
+	lastConfigMu   sync.RWMutex
+)
+
+// idRegexp is used to match ID fields and their associated values
+// in the config. It also matches adjacent commas so that syntax
+// can be preserved no matter where in the object the field appears.
+// It supports string and most numeric values.
+var idRegexp = regexp.MustCompile(`(?m),?\s*"` + idKey + `"\s*:\s*(-?[0-9]+(\.[0-9]+)?|(?U)".*")\s*,?`)
 
 var CustomVersion string = "v0.0.0"
 
@@ -0,0 +1,402 @@
+package uni
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func init() {
+	RegisterModule(testApp{})
+	RegisterModule(testBrokenApp{})
+	RegisterModule(testStuckApp{})
+	RegisterModule(testDepApp{id: "test_dep_a"})
+	RegisterModule(testDepApp{id: "test_dep_b"})
+	RegisterModule(testDepApp{id: "test_dep_c"})
+}
+
+func TestMain(m *testing.M) {
+	// never autosave test configs to the user's config dir
+	dir, err := os.MkdirTemp("", "guard-test")
+	if err != nil {
+		panic(err)
+	}
+	ConfigAutosavePath = filepath.Join(dir, "autosave.json")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testAppEvents records the lifecycle calls of test apps.
+var testAppEvents []string
+
+// testApp is an app that records when it starts and stops;
+// it fails to start if FailStart is set, and reports itself
+// unhealthy if Unhealthy is set.
+type testApp struct {
+	Name      string `json:"name,omitempty"`
+	FailStart bool   `json:"fail_start,omitempty"`
+	Unhealthy string `json:"unhealthy,omitempty"`
+}
+
+func (testApp) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "test_app",
+		New: func() Module { return new(testApp) },
+	}
+}
+
+func (a *testApp) Start() error {
+	if a.FailStart {
+		return errors.New("refusing to start")
+	}
+	testAppEvents = append(testAppEvents, "start "+a.Name)
+	return nil
+}
+
+func (a *testApp) Stop() error {
+	testAppEvents = append(testAppEvents, "stop "+a.Name)
+	return nil
+}
+
+func (a *testApp) Healthy() error {
+	if a.Unhealthy != "" {
+		return errors.New(a.Unhealthy)
+	}
+	return nil
+}
+
+// testBrokenApp always fails provisioning.
+type testBrokenApp struct{}
+
+func (testBrokenApp) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "test_broken_app",
+		New: func() Module { return new(testBrokenApp) },
+	}
+}
+
+func (*testBrokenApp) Provision(Context) error { return errors.New("cannot provision") }
+func (*testBrokenApp) Start() error            { return nil }
+func (*testBrokenApp) Stop() error             { return nil }
+
+// testStuckApp is an app whose Stop blocks until
+// testStuckAppRelease is closed.
+type testStuckApp struct{}
+
+var testStuckAppRelease = make(chan struct{})
+
+func (testStuckApp) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "test_stuck_app",
+		New: func() Module { return new(testStuckApp) },
+	}
+}
+
+func (*testStuckApp) Start() error { return nil }
+func (*testStuckApp) Stop() error {
+	<-testStuckAppRelease
+	return nil
+}
+
+// loadStuckApp runs a config with a testStuckApp, and
+// makes sure it is stopped once the test ends.
+func loadStuckApp(t *testing.T) {
+	t.Helper()
+	testStuckAppRelease = make(chan struct{})
+	err := Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_stuck_app": {}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := testStuckAppRelease
+	t.Cleanup(func() {
+		close(release)
+		_ = Stop() // waits for an abandoned Stop to finish
+		exiting.Store(false)
+	})
+}
+
+// testDepApp is an app that depends on the apps listed
+// in its config; it records its lifecycle in testAppEvents.
+type testDepApp struct {
+	id   string
+	Deps []string `json:"deps,omitempty"`
+}
+
+func (a testDepApp) UniModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  ModuleID(a.id),
+		New: func() Module { return &testDepApp{id: a.id} },
+	}
+}
+
+func (a *testDepApp) Dependencies() []string { return a.Deps }
+
+func (a *testDepApp) Start() error {
+	testAppEvents = append(testAppEvents, "start "+a.id)
+	return nil
+}
+
+func (a *testDepApp) Stop() error {
+	testAppEvents = append(testAppEvents, "stop "+a.id)
+	return nil
+}
+
+func TestAppDependencyOrder(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+	testAppEvents = nil
+
+	// test_dep_b is not configured, so it must be loaded
+	// because test_dep_a depends on it
+	err := Load([]byte(`{"admin": {"disabled": true}, "apps": {
+		"test_dep_a": {"deps": ["test_dep_b"]},
+		"test_dep_c": {"deps": ["test_dep_a"]}
+	}}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"start test_dep_b", "start test_dep_a", "start test_dep_c",
+		"stop test_dep_c", "stop test_dep_a", "stop test_dep_b",
+	}
+	if !slices.Equal(testAppEvents, expect) {
+		t.Errorf("expected events %v, got %v", expect, testAppEvents)
+	}
+}
+
+func TestAppDependencyCycle(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+	testAppEvents = nil
+
+	err := Load([]byte(`{"admin": {"disabled": true}, "apps": {
+		"test_dep_a": {"deps": ["test_dep_b"]},
+		"test_dep_b": {"deps": ["test_dep_c"]},
+		"test_dep_c": {"deps": ["test_dep_a"]}
+	}}`), false)
+	if err == nil {
+		t.Fatal("expected cyclic config to fail")
+	}
+	if !strings.Contains(err.Error(), "test_dep_a -> test_dep_b -> test_dep_c -> test_dep_a") {
+		t.Errorf("expected cycle to be reported, got: %v", err)
+	}
+	if len(testAppEvents) != 0 {
+		t.Errorf("expected no app to be started, got %v", testAppEvents)
+	}
+}
+
+func TestLoadRollsBackFailedApps(t *testing.T) {
+	testAppEvents = nil
+
+	err := Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "v1"}}}`), false)
+	if err != nil {
+		t.Fatalf("loading first config: %v", err)
+	}
+
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "v2", "fail_start": true}}}`), false)
+	var appErrs AppErrors
+	if !errors.As(err, &appErrs) {
+		t.Fatalf("expected AppErrors, got: %v", err)
+	}
+	if _, ok := appErrs["test_app"]; !ok {
+		t.Errorf("expected test_app to be reported as failed, got: %v", appErrs)
+	}
+
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "v3"}, "test_broken_app": {}}}`), false)
+	if !errors.As(err, &appErrs) {
+		t.Fatalf("expected AppErrors, got: %v", err)
+	}
+	if _, ok := appErrs["test_broken_app"]; !ok || len(appErrs) != 1 {
+		t.Errorf("expected only test_broken_app to be reported as failed, got: %v", appErrs)
+	}
+
+	// the first config must have stayed live the whole time
+	app, err := ActiveContext().App("test_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := app.(*testApp).Name; name != "v1" {
+		t.Errorf("expected v1 to still be running, got %s", name)
+	}
+
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "v4"}}}`), false)
+	if err != nil {
+		t.Fatalf("loading last config: %v", err)
+	}
+
+	expect := []string{"start v1", "start v4", "stop v1"}
+	if len(testAppEvents) != len(expect) {
+		t.Fatalf("expected events %v, got %v", expect, testAppEvents)
+	}
+	for i := range expect {
+		if testAppEvents[i] != expect[i] {
+			t.Errorf("event %d: expected %q, got %q", i, expect[i], testAppEvents[i])
+		}
+	}
+}
+
+func TestConfigAutosave(t *testing.T) {
+	ConfigAutosavePath = filepath.Join(t.TempDir(), "sub", "autosave.json")
+
+	cfg := `{"admin": {"disabled": true}, "apps": {"test_app": {"@id": "a", "name": "saved"}}}`
+	if err := Load([]byte(cfg), true); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(ConfigAutosavePath)
+	if err != nil {
+		t.Fatalf("expected config to be autosaved: %v", err)
+	}
+	if err := Load(saved, true); err != nil {
+		t.Fatalf("autosaved config does not load: %v", err)
+	}
+	app, err := ActiveContext().App("test_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := app.(*testApp).Name; name != "saved" {
+		t.Errorf("expected app from autosaved config, got %s", name)
+	}
+
+	// a failed change must not be persisted
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_broken_app": {}}}`), false)
+	if err == nil {
+		t.Fatal("expected broken config to fail")
+	}
+	after, err := os.ReadFile(ConfigAutosavePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(saved) {
+		t.Errorf("autosave changed after failed load: %s", after)
+	}
+
+	// persistence can be turned off
+	if err := os.Remove(ConfigAutosavePath); err != nil {
+		t.Fatal(err)
+	}
+	err = Load([]byte(`{"admin": {"disabled": true, "config": {"persist": false}}}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ConfigAutosavePath); !os.IsNotExist(err) {
+		t.Errorf("expected no autosave with persist disabled, got: %v", err)
+	}
+}
+
+func TestExitProcessForceQuit(t *testing.T) {
+	timeout := forceQuitStopTimeout
+	forceQuitStopTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { forceQuitStopTimeout = timeout })
+	loadStuckApp(t)
+
+	pidfilePath := filepath.Join(t.TempDir(), "guard.pid")
+	if err := PIDFile(pidfilePath); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pidfile = "" })
+
+	start := time.Now()
+	exitProcessWith(context.Background(), zap.NewNop(), exitOptions{forceQuit: true})
+	if elapsed := time.Since(start); elapsed < forceQuitStopTimeout || elapsed > time.Second {
+		t.Errorf("expected the stuck app to be abandoned after %s, waited %s", forceQuitStopTimeout, elapsed)
+	}
+	if _, err := os.Stat(pidfilePath); !os.IsNotExist(err) {
+		t.Errorf("expected the PID file to be removed, got %v", err)
+	}
+
+	// quitting by force while already exiting
+	// still cleans up what would outlive the process
+	if err := PIDFile(pidfilePath); err != nil {
+		t.Fatal(err)
+	}
+	exitProcessWith(context.Background(), zap.NewNop(), exitOptions{forceQuit: true})
+	if _, err := os.Stat(pidfilePath); !os.IsNotExist(err) {
+		t.Errorf("expected the PID file to be removed while exiting, got %v", err)
+	}
+}
+
+func TestStopWithinBudget(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	logger := zap.New(core)
+
+	// apps that stop at once are waited for
+	t.Cleanup(func() { _ = Stop() })
+	err := Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "quick"}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stopWithinBudget(logger, 20*time.Millisecond, 50*time.Millisecond); err != nil {
+		t.Errorf("expected apps to stop, got %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("expected no warning, got %v", logs.TakeAll())
+	}
+
+	// apps that do not stop are warned about, then abandoned
+	loadStuckApp(t)
+	start := time.Now()
+	err = stopWithinBudget(logger, 20*time.Millisecond, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected the apps to be abandoned after 50ms, waited %s", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "did not stop within 50ms") {
+		t.Errorf("expected the apps to be abandoned, got %v", err)
+	}
+	if logs.FilterMessage("apps are taking long to stop").Len() != 1 {
+		t.Errorf("expected a warning after 20ms, got %v", logs.All())
+	}
+}
+
+func TestExitProcessBudget(t *testing.T) {
+	warnAfter, giveUpAfter := stopTimeout, fatalStopTimeout
+	stopTimeout, fatalStopTimeout = 20*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() { stopTimeout, fatalStopTimeout = warnAfter, giveUpAfter })
+	loadStuckApp(t)
+
+	pidfilePath := filepath.Join(t.TempDir(), "guard.pid")
+	if err := PIDFile(pidfilePath); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pidfile = "" })
+	exited := make(chan struct{})
+	ActiveContext().OnExit(func(context.Context) { close(exited) })
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	start := time.Now()
+	exitProcess(context.Background(), zap.New(core))
+	if elapsed := time.Since(start); elapsed < fatalStopTimeout || elapsed > time.Second {
+		t.Errorf("expected the stuck app to be abandoned after %s, waited %s", fatalStopTimeout, elapsed)
+	}
+
+	// what outlives the process is cleaned up regardless
+	if _, err := os.Stat(pidfilePath); !os.IsNotExist(err) {
+		t.Errorf("expected the PID file to be removed, got %v", err)
+	}
+	select {
+	case <-exited:
+	default:
+		t.Error("expected the exit callbacks to run")
+	}
+
+	// the exit is reported from a goroutine
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("unclean shutdown").Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	entries := logs.FilterMessage("unclean shutdown").All()
+	if len(entries) != 1 || entries[0].ContextMap()["exit_code"] != int64(ExitCodeFailedQuit) {
+		t.Errorf("expected an unclean shutdown with exit code %d, got %v", ExitCodeFailedQuit, entries)
+	}
+}
@@ -71,22 +71,74 @@ func init() {
 
 	RegisterCommand(Command{
 		Name:  "start",
-		Usage: "[--config <path>] [--profile <path> ] [--watch] [--pidfile <file>]",
+		Usage: "[--config <path>] [--profile <path> ] [--envfile <path>] [--pidfile <file>] [--resume]",
 		Short: "Starts the Guard process in the background and then returns",
 		Long: `
 Starts the Guard process, optionally bootstrapped with an initial profile and config file.
 This command unblocks after the server starts running or fails to run.
 
+If --resume is specified, the last autosaved config is used instead of
+--config, if one exists; see the run command for details.
+
 On Windows, the spawned child process will remain attached to the terminal, so
 closing the window will forcefully stop Guard.
 `,
 		CobraFunc: func(c *cobra.Command) {
 			c.Flags().StringP("config", "c", "", "Configuration file")
 			c.Flags().StringP("profile", "p", "", "Profile")
+			c.Flags().StringSliceP("envfile", "", []string{}, "Environment file(s) to load")
 			c.Flags().StringP("pidfile", "", "", "Path of file to which to write process ID")
+			c.Flags().BoolP("resume", "", false, "Use saved config, if any (and prefer over --config file)")
 			c.RunE = CommandFuncToCobraRunE(cmdStart)
 		},
 	})
+
+	RegisterCommand(Command{
+		Name:  "run",
+		Usage: "[--config <path>] [--profile <path> ] [--envfile <path>] [--pidfile <file>] [--resume]",
+		Short: `Starts the Guard process and blocks indefinitely`,
+		Long: `
+Starts the Guard process, optionally bootstrapped with an initial config file,
+and blocks indefinitely until the server is stopped; i.e. runs Guard in
+"daemon" mode (foreground).
+
+If a config file is specified, it will be applied immediately after the process
+is running. If no config file is specified, Guard starts with only the admin
+endpoint, and a config can be pushed to it later.
+
+If --envfile is specified, an environment file with environment variables
+in the KEY=VALUE format will be loaded into the Guard process. It may be
+given more than once.
+
+If --pidfile is specified, the process ID is written to that file, which
+is removed again when Guard exits gracefully.
+
+Every config that is applied successfully, including changes made through
+the admin API, is saved to disk unless disabled with admin.config.persist.
+If --resume is specified, Guard starts from that saved config instead of
+--config; if no saved config exists or it is unreadable, --config is used.
+
+On POSIX systems, Guard handles these signals:
+
+  SIGINT, SIGTERM  stop gracefully (a second SIGINT forces the exit)
+  SIGQUIT          exit immediately
+  SIGHUP           reload the config from the --config file, unless the
+                   config was replaced or changed through the admin API
+  SIGUSR1          reopen log files, e.g. after they were rotated
+  SIGUSR2          upgrade without downtime: start the executable again,
+                   hand it the listening sockets and the running config,
+                   and exit once it is ready
+`,
+		CobraFunc: func(c *cobra.Command) {
+			c.Flags().StringP("config", "c", "", "Configuration file")
+			c.Flags().StringP("profile", "p", "", "Profile")
+			c.Flags().StringSliceP("envfile", "", []string{}, "Environment file(s) to load")
+			c.Flags().StringP("pidfile", "", "", "Path of file to which to write process ID")
+			c.Flags().BoolP("resume", "", false, "Use saved config, if any (and prefer over --config file)")
+			c.Flags().StringP("pingback", "", "", "Echo confirmation bytes to this address on success")
+			c.RunE = CommandFuncToCobraRunE(cmdRun)
+		},
+	})
 }
 
 // RegisterCommand registers the command cmd.
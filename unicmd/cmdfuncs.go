@@ -1,10 +1,23 @@
 package unicmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/exec"
 	"runtime/debug"
 
 	"uni"
+
+	"go.uber.org/zap"
 )
 
 type moduleInfo struct {
@@ -17,11 +30,121 @@ func cmdStart(fl Flags) (int, error) {
 	configFlag := fl.String("config")
 	pidfileFlag := fl.String("pidfile")
 	profileFlag := fl.String("profile")
-	fmt.Println("cmdStart testing func")
+	resumeFlag := fl.Bool("resume")
+	envfileFlag, err := fl.GetStringSlice("envfile")
+	if err != nil {
+		return uni.ExitCodeFailedStartup,
+			fmt.Errorf("reading envfile flag: %v", err)
+	}
 
-	fmt.Println(configFlag)
-	fmt.Println(pidfileFlag)
-	fmt.Println(profileFlag)
+	// open a listener to which the child process will connect when
+	// it is ready to confirm that it has successfully started
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return uni.ExitCodeFailedStartup,
+			fmt.Errorf("opening listener for success confirmation: %v", err)
+	}
+	defer ln.Close()
+
+	// craft the command with a pingback address and with a
+	// pipe for its stdin, so we can tell it our confirmation
+	// code that we expect so that some random port scan at
+	// the most unfortunate time won't fool us into thinking
+	// the child succeeded (i.e. the alternative is to just
+	// wait for any connection on our listener, but better to
+	// ensure it's the process we're expecting - we can be
+	// sure by giving it some random bytes and having it echo
+	// them back to us)
+	cmd := exec.Command(os.Args[0], "run", "--pingback", ln.Addr().String()) //nolint:gosec
+	// we should be able to run guard in relative paths
+	if errors.Is(cmd.Err, exec.ErrDot) {
+		cmd.Err = nil
+	}
+	if configFlag != "" {
+		cmd.Args = append(cmd.Args, "--config", configFlag)
+	}
+	if profileFlag != "" {
+		cmd.Args = append(cmd.Args, "--profile", profileFlag)
+	}
+	if resumeFlag {
+		cmd.Args = append(cmd.Args, "--resume")
+	}
+	for _, envFile := range envfileFlag {
+		cmd.Args = append(cmd.Args, "--envfile", envFile)
+	}
+	if pidfileFlag != "" {
+		cmd.Args = append(cmd.Args, "--pidfile", pidfileFlag)
+	}
+	stdinPipe, err := cmd.StdinPipe()
+	if err != nil {
+		return uni.ExitCodeFailedStartup,
+			fmt.Errorf("creating stdin pipe: %v", err)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// generate the random bytes we'll send to the child process
+	expect := make([]byte, 32)
+	_, err = rand.Read(expect)
+	if err != nil {
+		return uni.ExitCodeFailedStartup,
+			fmt.Errorf("generating random confirmation bytes: %v", err)
+	}
+
+	// begin writing the confirmation bytes to the child's
+	// stdin; use a goroutine since the child hasn't been
+	// started yet, and writing synchronously would result
+	// in a deadlock
+	go func() {
+		_, _ = stdinPipe.Write(expect)
+		stdinPipe.Close()
+	}()
+
+	// start the process
+	err = cmd.Start()
+	if err != nil {
+		return uni.ExitCodeFailedStartup,
+			fmt.Errorf("starting guard process: %v", err)
+	}
+
+	// there are two ways we know we're done: either
+	// the process will connect to our listener, or
+	// it will exit with an error
+	success, exit := make(chan struct{}), make(chan error)
+
+	// in one goroutine, we await the success of the child process
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Println(err)
+				}
+				break
+			}
+			err = handlePingbackConn(conn, expect)
+			if err == nil {
+				close(success)
+				break
+			}
+			log.Println(err)
+		}
+	}()
+
+	// in another goroutine, we await the failure of the child process
+	go func() {
+		err := cmd.Wait() // don't send on this line! Wait blocks, but send starts before it unblocks
+		exit <- err       // sending on separate line ensures select won't trigger until after Wait unblocks
+	}()
+
+	// when one of the goroutines unblocks, we're done and can exit
+	select {
+	case <-success:
+		fmt.Printf("Successfully started Guard (pid=%d) - Guard is running in the background\n", cmd.Process.Pid)
+	case err := <-exit:
+		return uni.ExitCodeFailedStartup,
+			fmt.Errorf("guard process exited with error: %v", err)
+	}
 
 	return uni.ExitCodeSuccess, nil
 }
@@ -44,7 +167,7 @@ func cmdRun(fl Flags) (int, error) {
 	// on any error before the config is loaded.
 	logger, defaultLogger, logBuffer := uni.BufferedLog()
 
-	undoMaxProcs := setResourceLimits(logger)
+	undoMaxProcs := uni.SetResourceLimits(logger, nil)
 	defer undoMaxProcs()
 	// release the local reference to the undo function so it can be GC'd;
 	// the deferred call above has already captured the actual function value.
@@ -52,8 +175,9 @@ func cmdRun(fl Flags) (int, error) {
 
 	profileFlag := fl.String("profile")
 	configFlag := fl.String("config")
-	resumeFlag := fl.Bool("resume")
 	pidfileFlag := fl.String("pidfile")
+	resumeFlag := fl.Bool("resume")
+	pingbackFlag := fl.String("pingback")
 
 	// load all additional envs as soon as possible
 	err := handleEnvFileFlag(fl)
@@ -68,35 +192,57 @@ func cmdRun(fl Flags) (int, error) {
 	// 	printEnvironment()
 	// }
 
-	// TODO
-	// // load the config, depending on flags
+	// when taking over from another Guard process (a zero-downtime
+	// upgrade), run exactly the config it was running, which it
+	// passes on stdin; the config file is still remembered below,
+	// so that it can be reloaded later
 	var config []byte
-	// if resumeFlag {
-	// 	config, err = os.ReadFile(caddy.ConfigAutosavePath)
-	// 	if errors.Is(err, fs.ErrNotExist) {
-	// 		// not a bad error; just can't resume if autosave file doesn't exist
-	// 		logger.Info("no autosave file exists", zap.String("autosave_file", caddy.ConfigAutosavePath))
-	// 		resumeFlag = false
-	// 	} else if err != nil {
-	// 		logBuffer.FlushTo(defaultLogger)
-	// 		return caddy.ExitCodeFailedStartup, err
-	// 	} else {
-	// 		if configFlag == "" {
-	// 			logger.Info("resuming from last configuration",
-	// 				zap.String("autosave_file", caddy.ConfigAutosavePath))
-	// 		} else {
-	// 			// if they also specified a config file, user should be aware that we're not
-	// 			// using it (doing so could lead to data/config loss by overwriting!)
-	// 			logger.Warn("--config and --resume flags were used together; ignoring --config and resuming from last configuration",
-	// 				zap.String("autosave_file", caddy.ConfigAutosavePath))
-	// 		}
-	// 	}
-	// }
+	var configFile string
+	upgrading := uni.Upgrading()
+	if upgrading {
+		config, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			logBuffer.FlushTo(defaultLogger)
+			return uni.ExitCodeFailedStartup,
+				fmt.Errorf("reading config from previous process: %v", err)
+		}
+		if configFlag != "-" {
+			configFile = configFlag
+		}
+		resumeFlag = false
+		logger.Info("taking over from previous process")
+	}
 
+	// resume from the autosaved config, if requested; a missing
+	// or corrupt autosave file is not fatal, we just fall back to
+	// the config file (if any)
+	if resumeFlag {
+		config, err = os.ReadFile(uni.ConfigAutosavePath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// not a bad error; just can't resume if autosave file doesn't exist
+			logger.Info("no autosave file exists", zap.String("autosave_file", uni.ConfigAutosavePath))
+			resumeFlag = false
+		case err != nil:
+			logger.Warn("unable to read autosave file; falling back to --config",
+				zap.String("autosave_file", uni.ConfigAutosavePath),
+				zap.Error(err))
+			resumeFlag = false
+		case !json.Valid(config):
+			logger.Warn("autosave file is not valid JSON; falling back to --config",
+				zap.String("autosave_file", uni.ConfigAutosavePath))
+			resumeFlag = false
+		case configFlag == "":
+			logger.Info("resuming from last configuration",
+				zap.String("autosave_file", uni.ConfigAutosavePath))
+		default:
+			// if they also specified a config file, user should be aware that we're not using it
+			logger.Warn("--config and --resume flags were used together; ignoring --config and resuming from last configuration",
+				zap.String("autosave_file", uni.ConfigAutosavePath))
+		}
+	}
 	// we don't use 'else' here since this value might have been changed in 'if' block; i.e. not mutually exclusive
-	var configFile string
-	// var adapterUsed string
-	if !resumeFlag {
+	if !resumeFlag && !upgrading {
 		config, configFile, err = LoadConfig(configFlag)
 		if err != nil {
 			logBuffer.FlushTo(defaultLogger)
@@ -104,36 +250,91 @@ func cmdRun(fl Flags) (int, error) {
 		}
 	}
 
-	// TODO
-	// create pidfile now, in case loading config takes a while (issue #5477)
+	// create pidfile now, in case loading config takes a while
 	if pidfileFlag != "" {
-		// err := caddy.PIDFile(pidfileFlag)
-		// if err != nil {
-		// 	logger.Error("unable to write PID file",
-		// 		zap.String("pidfile", pidfileFlag),
-		// 		zap.Error(err))
-		// }
+		err := uni.PIDFile(pidfileFlag)
+		if err != nil {
+			logger.Error("unable to write PID file",
+				zap.String("pidfile", pidfileFlag),
+				zap.Error(err))
+		}
 	}
 
-	// TODO
-	// If we have a source config file (we're running via 'caddy run --config ...'),
-	// record it so SIGUSR1 can reload from the same file. Also provide a callback
-	// that knows how to load/adapt that source when requested by the main process.
-	if configFile != "" {
-		// caddy.SetLastConfig(configFile, adapterUsed, func(file, adapter string) error {
-		// 	cfg, _, _, err := LoadConfig(file, adapter)
-		// 	if err != nil {
-		// 		return err
-		// 	}
-		// 	return caddy.Load(cfg, true)
-		// })
+	// if we have a source config file (we're running via 'guard run --config ...'),
+	// record it so SIGHUP can reload from the same file; reading the config from
+	// stdin can't be repeated
+	if configFile != "" && configFile != "-" {
+		uni.SetLastConfig(configFile, func(file string) error {
+			cfg, _, err := LoadConfig(file)
+			if err != nil {
+				return err
+			}
+			return uni.Load(cfg, true)
+		})
 	}
 
 	// run the initial config
+	err = uni.Load(config, true)
+	if err != nil {
+		logBuffer.FlushTo(defaultLogger)
+		return uni.ExitCodeFailedStartup, fmt.Errorf("loading initial config: %v", err)
+	}
+	// release the reference to the config so it can be GC'd
+	config = nil //nolint:ineffassign,wastedassign
+
+	// the config is running, so hand the buffered logs over
+	// to the configured (or original) logger and log normally;
+	// also clear our refs to the buffer so it can get GC'd
+	uni.FlushBufferedLog(logger, defaultLogger, logBuffer)
+	logger = uni.Log()
+	defaultLogger = nil //nolint:ineffassign,wastedassign
+	logBuffer = nil     //nolint:ineffassign,wastedassign
+	logger.Info("serving initial configuration")
+
+	// let the process we took over from (if any) exit
+	if err := uni.UpgradeReady(); err != nil {
+		logger.Error("unable to notify previous process of readiness", zap.Error(err))
+	}
+
+	// keep the service manager (if any) informed about our health
+	uni.StartWatchdog(context.Background())
+
+	// if we are to report to another process the successful start
+	// of the server, do so now by echoing back contents of stdin
+	if pingbackFlag != "" {
+		confirmationBytes, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return uni.ExitCodeFailedStartup,
+				fmt.Errorf("reading confirmation bytes from stdin: %v", err)
+		}
+		conn, err := net.Dial("tcp", pingbackFlag)
+		if err != nil {
+			return uni.ExitCodeFailedStartup,
+				fmt.Errorf("dialing confirmation address: %v", err)
+		}
+		defer conn.Close()
+		_, err = conn.Write(confirmationBytes)
+		if err != nil {
+			return uni.ExitCodeFailedStartup,
+				fmt.Errorf("writing confirmation bytes to %s: %v", pingbackFlag, err)
+		}
+	}
 
-	_ = pidfileFlag
-	_ = config
 	_ = profileFlag
 
 	select {}
 }
+
+// handlePingbackConn reads from conn and ensures it matches
+// the bytes in expect, or returns an error if it doesn't.
+func handlePingbackConn(conn net.Conn, expect []byte) error {
+	defer conn.Close()
+	confirmationBytes, err := io.ReadAll(io.LimitReader(conn, 32))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(confirmationBytes, expect) {
+		return fmt.Errorf("wrong confirmation: %x", confirmationBytes)
+	}
+	return nil
+}
@@ -2,60 +2,50 @@ package unicmd
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"uni"
 
-	"github.com/KimMachineGun/automemlimit/memlimit"
 	"github.com/caddyserver/certmagic"
-	"go.uber.org/automaxprocs/maxprocs"
 	"go.uber.org/zap"
-	"go.uber.org/zap/exp/zapslog"
 )
 
-func setResourceLimits(logger *zap.Logger) func() {
-	// Configure the maximum number of CPUs to use to match the Linux container quota (if any)
-	// See https://pkg.go.dev/runtime#GOMAXPROCS
-	undo, err := maxprocs.Set(maxprocs.Logger(logger.Sugar().Infof))
-	if err != nil {
-		logger.Warn("failed to set GOMAXPROCS", zap.Error(err))
-	}
-
-	// Configure the maximum memory to use to match the Linux container quota (if any) or system memory
-	// See https://pkg.go.dev/runtime/debug#SetMemoryLimit
-	_, _ = memlimit.SetGoMemLimitWithOpts(
-		memlimit.WithLogger(
-			slog.New(zapslog.NewHandler(logger.Core())),
-		),
-		memlimit.WithProvider(
-			memlimit.ApplyFallback(
-				memlimit.FromCgroup,
-				memlimit.FromSystem,
-			),
-		),
-	)
-
-	return undo
-}
-
-// TODO
-// LoadConfig loads the config from configFile it using adapterName.
-// If no configFile is specified, it tries loading a default config file.
-// The lack of a config file is not treated as an error, but false will be
-// returned if there is no config available. It prints any warnings to stderr,
-// and returns the resulting JSON config bytes along with the name of the
-// loaded config file (if any).
+// LoadConfig loads the config from configFile.
+// The lack of a config file is not treated as an error, but nil
+// config bytes will be returned if there is no config available.
+// The file must contain Guard's native JSON config.
 // The return values are:
 //   - config bytes (nil if no config)
 //   - config file used ("" if none)
 //   - error, if any
 func LoadConfig(configFile string) ([]byte, string, error) {
-	return []byte{}, "", nil
+	if configFile == "" {
+		return nil, "", nil
+	}
+
+	var config []byte
+	var err error
+	if configFile == "-" {
+		config, err = io.ReadAll(os.Stdin)
+	} else {
+		config, err = os.ReadFile(configFile)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("reading config from file: %v", err)
+	}
+
+	uni.Log().Info("using config from file", zap.String("file", configFile))
+
+	if !json.Valid(config) {
+		return nil, "", fmt.Errorf("config file %s is not valid JSON", configFile)
+	}
+
+	return config, configFile, nil
 }
 
 // handleEnvFileFlag loads the environment variables from the given --envfile
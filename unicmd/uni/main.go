@@ -1,6 +1,15 @@
 package main
 
-import "uni/unicmd"
+import (
+	"uni/unicmd"
+
+	// plug in Guard modules here
+	_ "uni/modules/api"
+	_ "uni/modules/events"
+	_ "uni/modules/kfs"
+	_ "uni/modules/logging"
+	_ "uni/modules/storage"
+)
 
 // "guard/bridge/common/matadata"
 
@@ -1 +1,302 @@
-package kazetest
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package unitest is a harness for testing Guard modules. It loads
+// single modules from JSON into a fresh context and runs their whole
+// lifecycle, captures what they log, checks that they clean up after
+// themselves, and runs complete configs on ephemeral ports for
+// end-to-end tests.
+//
+// The harness changes process-wide state (the default logger and the
+// running config), so tests using it must not run in parallel.
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"uni"
+	"uni/internal"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Module is a module that was loaded by LoadModule.
+type Module struct {
+	// The loaded (provisioned and validated) module.
+	Module uni.Module
+
+	// The context the module was loaded in; it is
+	// canceled when the module is cleaned up.
+	Context uni.Context
+
+	// The logs written since the module started loading.
+	Logs *Logs
+
+	t          testing.TB
+	cancel     context.CancelFunc
+	goroutines int
+	cleanedUp  bool
+}
+
+// LoadModule loads the module with the given ID from cfgJSON in a
+// new context, which provisions and validates it, and fails the test
+// if that does not succeed. Unless the test calls Cleanup itself,
+// the module is cleaned up and checked with AssertCleanup when the
+// test ends.
+func LoadModule(t testing.TB, id, cfgJSON string) *Module {
+	t.Helper()
+	mod, err := TryLoadModule(t, id, cfgJSON)
+	if err != nil {
+		t.Fatalf("loading module %s: %v", id, err)
+	}
+	return mod
+}
+
+// TryLoadModule is like LoadModule, but returns the error instead
+// of failing the test, for testing that bad configs are rejected.
+// If loading fails, the returned Module has no Module, but its
+// Logs and cleanup can still be inspected.
+func TryLoadModule(t testing.TB, id, cfgJSON string) (*Module, error) {
+	t.Helper()
+	if cfgJSON == "" {
+		cfgJSON = "{}"
+	}
+	if !json.Valid([]byte(cfgJSON)) {
+		t.Fatalf("module config for %s is not valid JSON: %s", id, cfgJSON)
+	}
+
+	m := &Module{
+		Logs:       CaptureLogs(t),
+		t:          t,
+		goroutines: runtime.NumGoroutine(),
+	}
+	m.Context, m.cancel = uni.NewContext(uni.Context{Context: context.Background()})
+	t.Cleanup(func() {
+		if !m.cleanedUp {
+			m.AssertCleanup()
+		}
+	})
+
+	val, err := m.Context.LoadModuleByID(id, json.RawMessage(cfgJSON))
+	if err != nil {
+		return m, err
+	}
+	m.Module = val.(uni.Module)
+	return m, nil
+}
+
+// Cleanup cancels the module's context, which makes every module
+// loaded in it clean up. It is safe to call more than once.
+func (m *Module) Cleanup() {
+	if m.cleanedUp {
+		return
+	}
+	m.cleanedUp = true
+	m.cancel()
+}
+
+// AssertCleanup cleans up the module and fails the test if that
+// reported an error, or if goroutines started since the module was
+// loaded are still running shortly after; those are usually servers
+// or listeners that were not shut down.
+func (m *Module) AssertCleanup() {
+	m.t.Helper()
+	m.Cleanup()
+
+	for _, e := range m.Logs.Entries() {
+		if e.Level >= zapcore.ErrorLevel && strings.Contains(e.Message, "cleanup") {
+			m.t.Errorf("cleanup failed: %s %v", e.Message, e.Fields)
+		}
+	}
+
+	deadline := time.Now().Add(goroutineGracePeriod)
+	for runtime.NumGoroutine() > m.goroutines {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			m.t.Errorf("%d goroutine(s) still running after cleanup:\n%s",
+				runtime.NumGoroutine()-m.goroutines, buf)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Logs holds the log entries captured by CaptureLogs.
+type Logs struct {
+	core *internal.LogBufferCore
+}
+
+// LogEntry is a captured log entry.
+type LogEntry struct {
+	Level   zapcore.Level
+	Logger  string
+	Message string
+	Fields  map[string]any
+}
+
+// CaptureLogs makes the default logger (uni.Log) write to a buffer
+// until the test ends, and returns the buffer. Entries below INFO
+// level are not captured.
+func CaptureLogs(t testing.TB) *Logs {
+	buffered, orig, core := uni.BufferedLog()
+	t.Cleanup(func() {
+		// reinstate the original logger without replaying
+		// the captured entries to it
+		uni.FlushBufferedLog(buffered, orig, internal.NewLogBufferCore(zap.InfoLevel))
+	})
+	return &Logs{core: core}
+}
+
+// Entries returns the captured entries in the order they were written.
+func (l *Logs) Entries() []LogEntry {
+	entries, fields := l.core.Entries()
+	out := make([]LogEntry, len(entries))
+	for i, e := range entries {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range fields[i] {
+			f.AddTo(enc)
+		}
+		out[i] = LogEntry{
+			Level:   e.Level,
+			Logger:  e.LoggerName,
+			Message: e.Message,
+			Fields:  enc.Fields,
+		}
+	}
+	return out
+}
+
+// Find returns the first captured entry whose message contains
+// msg, and whether there is one.
+func (l *Logs) Find(msg string) (LogEntry, bool) {
+	for _, e := range l.Entries() {
+		if strings.Contains(e.Message, msg) {
+			return e, true
+		}
+	}
+	return LogEntry{}, false
+}
+
+// Config is a complete config run by RunConfig.
+type Config struct {
+	t     testing.TB
+	ports map[string]int
+	admin string
+}
+
+// RunConfig loads and runs the config cfgJSON as the process's
+// config, and stops it when the test ends. Each placeholder of the
+// form {port.NAME} in cfgJSON is replaced with a free TCP port on
+// the loopback interface, the same one for the same name; see Port.
+// If the config has no admin section, the admin endpoint listens
+// on a free port as well, so end-to-end tests can use AdminURL.
+// Config changes are never autosaved to the user's config dir.
+func RunConfig(t testing.TB, cfgJSON string) *Config {
+	t.Helper()
+	c := &Config{t: t, ports: make(map[string]int)}
+
+	cfgJSON = portPlaceholder.ReplaceAllStringFunc(cfgJSON, func(s string) string {
+		return strconv.Itoa(c.Port(portPlaceholder.FindStringSubmatch(s)[1]))
+	})
+
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(cfgJSON), &cfg); err != nil {
+		t.Fatalf("config is not a valid JSON object: %v", err)
+	}
+	if _, ok := cfg["admin"]; !ok {
+		c.admin = net.JoinHostPort("127.0.0.1", strconv.Itoa(c.Port("admin")))
+		cfg["admin"] = json.RawMessage(fmt.Sprintf(`{"listen": %q}`, c.admin))
+	}
+	cfgBytes, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	autosave := uni.ConfigAutosavePath
+	uni.ConfigAutosavePath = filepath.Join(t.TempDir(), "autosave.json")
+
+	t.Cleanup(func() {
+		// replace the admin endpoint with none and stop the apps
+		if err := uni.Load([]byte(`{"admin": {"disabled": true}}`), true); err != nil {
+			t.Errorf("unloading config: %v", err)
+		}
+		if err := uni.Stop(); err != nil {
+			t.Errorf("stopping config: %v", err)
+		}
+		uni.ConfigAutosavePath = autosave
+	})
+
+	if err := uni.Load(cfgBytes, true); err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	return c
+}
+
+// Port returns the port allocated for the {port.NAME} placeholder
+// called name, allocating a free one if there is none yet.
+func (c *Config) Port(name string) int {
+	if port, ok := c.ports[name]; ok {
+		return port
+	}
+	port, err := freePort()
+	if err != nil {
+		c.t.Fatalf("allocating port %s: %v", name, err)
+	}
+	c.ports[name] = port
+	return port
+}
+
+// AdminURL returns the base URL of the admin endpoint, if the
+// harness configured it.
+func (c *Config) AdminURL() string {
+	if c.admin == "" {
+		c.t.Fatal("admin endpoint was configured by the test, not the harness")
+	}
+	return "http://" + c.admin
+}
+
+// Context returns the context of the running config.
+func (c *Config) Context() uni.Context {
+	return uni.ActiveContext()
+}
+
+// freePort returns a TCP port on the loopback interface that is
+// free at the time of the call.
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// portPlaceholder matches the {port.NAME} placeholders of RunConfig.
+var portPlaceholder = regexp.MustCompile(`\{port\.([\w-]+)\}`)
+
+// goroutineGracePeriod is how long AssertCleanup waits for
+// goroutines to finish after cleanup.
+const goroutineGracePeriod = 2 * time.Second
@@ -0,0 +1,148 @@
+package unitest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"uni"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	uni.RegisterModule(echoServer{})
+}
+
+// echoServer is a module that serves on a listener from
+// provisioning until cleanup, unless Leak is set.
+type echoServer struct {
+	Listen string `json:"listen,omitempty"`
+	Leak   bool   `json:"leak,omitempty"`
+
+	ln net.Listener
+	wg *sync.WaitGroup
+}
+
+func (echoServer) UniModule() uni.ModuleInfo {
+	return uni.ModuleInfo{
+		ID:  "unitest.echo",
+		New: func() uni.Module { return new(echoServer) },
+	}
+}
+
+func (e *echoServer) Provision(ctx uni.Context) error {
+	if e.Listen == "" {
+		return errors.New("listen address is required")
+	}
+	ln, err := net.Listen("tcp", e.Listen)
+	if err != nil {
+		return err
+	}
+	e.ln = ln
+	e.wg = new(sync.WaitGroup)
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+	uni.Log().Named("unitest.echo").Info("listening", zap.Stringer("address", ln.Addr()))
+	return nil
+}
+
+func (e *echoServer) Cleanup() error {
+	if e.ln == nil {
+		return nil
+	}
+	if e.Leak {
+		return errors.New("refusing to stop")
+	}
+	err := e.ln.Close()
+	e.wg.Wait()
+	return err
+}
+
+func TestLoadModule(t *testing.T) {
+	mod := LoadModule(t, "unitest.echo", `{"listen": "127.0.0.1:0"}`)
+
+	entry, ok := mod.Logs.Find("listening")
+	if !ok {
+		t.Fatalf("expected log entry to be captured, got %v", mod.Logs.Entries())
+	}
+	if entry.Logger != "unitest.echo" || entry.Fields["address"] == nil {
+		t.Errorf("unexpected log entry %+v", entry)
+	}
+
+	mod.AssertCleanup()
+}
+
+func TestTryLoadModule(t *testing.T) {
+	_, err := TryLoadModule(t, "unitest.echo", `{}`)
+	if err == nil || !strings.Contains(err.Error(), "listen address is required") {
+		t.Errorf("expected provisioning error, got %v", err)
+	}
+}
+
+// recordingTB records failures instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertCleanupDetectsLeak(t *testing.T) {
+	rec := &recordingTB{TB: t}
+	mod := LoadModule(rec, "unitest.echo", `{"listen": "127.0.0.1:0", "leak": true}`)
+	mod.AssertCleanup()
+	if len(rec.failures) != 2 {
+		t.Fatalf("expected failed cleanup and leaked goroutine to be reported, got %q", rec.failures)
+	}
+
+	// stop the leaked server for real
+	srv := mod.Module.(*echoServer)
+	srv.ln.Close()
+	srv.wg.Wait()
+}
+
+func TestRunConfig(t *testing.T) {
+	cfg := RunConfig(t, `{"apps": {}}`)
+
+	resp, err := http.Get(cfg.AdminURL() + "/config/admin/listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	expect := fmt.Sprintf("%q", strings.TrimPrefix(cfg.AdminURL(), "http://"))
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != expect {
+		t.Errorf("unexpected admin response %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestRunConfigPorts(t *testing.T) {
+	cfg := RunConfig(t, `{"admin": {"listen": "127.0.0.1:{port.api}"}}`)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(cfg.Port("api"))))
+	if err != nil {
+		t.Fatalf("expected admin endpoint on allocated port: %v", err)
+	}
+	conn.Close()
+	if cfg.Port("api") == cfg.Port("other") {
+		t.Error("expected distinct ports for distinct names")
+	}
+}
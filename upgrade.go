@@ -0,0 +1,355 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"uni/notify"
+
+	"go.uber.org/zap"
+)
+
+// A zero-downtime upgrade starts a new process from the executable
+// on disk (which may have been replaced by a newer version) and hands
+// it the listening sockets and the running config. Both processes
+// accept connections on the sockets until the new one has loaded the
+// config; then the old one exits gracefully.
+
+// upgradeEnv is the environment variable in which the old
+// process describes to the new one what it was handed.
+const upgradeEnv = "GUARD_UPGRADE"
+
+// upgradeState is what upgradeEnv holds, JSON-encoded.
+type upgradeState struct {
+	// The descriptor to report readiness on.
+	ReadyFd int `json:"ready_fd"`
+
+	// The descriptors of the listening sockets,
+	// keyed by their key in the listener pool.
+	Listeners map[string]int `json:"listeners,omitempty"`
+
+	// The descriptor numbers of the sockets passed by systemd
+	// socket activation, keyed by their name, so that fd
+	// addresses by name resolve to the keys of Listeners
+	// although the systemd variables are not passed on.
+	FdNames map[string]int `json:"fd_names,omitempty"`
+}
+
+// inherited holds what this process was handed by the
+// process it is taking over from, if any.
+var inherited struct {
+	sync.Mutex
+	once    sync.Once
+	ready   *os.File
+	files   map[string]*os.File
+	fdNames map[string]int
+}
+
+// loadUpgradeState reads upgradeEnv, once.
+func loadUpgradeState() {
+	inherited.once.Do(func() {
+		env := os.Getenv(upgradeEnv)
+		if env == "" {
+			return
+		}
+		// the state is meant for this process only
+		os.Unsetenv(upgradeEnv)
+
+		var state upgradeState
+		if err := json.Unmarshal([]byte(env), &state); err != nil {
+			Log().Error("invalid upgrade state; not taking over any sockets",
+				zap.String("env", upgradeEnv),
+				zap.Error(err))
+			return
+		}
+		inherited.ready = os.NewFile(uintptr(state.ReadyFd), "upgrade-ready")
+		inherited.fdNames = state.FdNames
+		inherited.files = make(map[string]*os.File, len(state.Listeners))
+		for key, fd := range state.Listeners {
+			inherited.files[key] = os.NewFile(uintptr(fd), key)
+		}
+	})
+}
+
+// Upgrading returns true if this process was started by another
+// Guard process to take over from it, and has not yet reported
+// that it is ready with UpgradeReady.
+func Upgrading() bool {
+	loadUpgradeState()
+	inherited.Lock()
+	defer inherited.Unlock()
+	return inherited.ready != nil
+}
+
+// UpgradeReady tells the process this one is taking over from that
+// the config is running, so it can exit. Handed-over sockets that
+// the config does not use are closed. It is a no-op if this process
+// is not Upgrading.
+func UpgradeReady() error {
+	loadUpgradeState()
+	inherited.Lock()
+	defer inherited.Unlock()
+	if inherited.ready == nil {
+		return nil
+	}
+	for key, f := range inherited.files {
+		f.Close()
+		delete(inherited.files, key)
+	}
+	_, err := inherited.ready.Write([]byte{1})
+	inherited.ready.Close()
+	inherited.ready = nil
+	return err
+}
+
+// takeInheritedFile returns the socket with the listener
+// key that was handed to this process, or nil if there is
+// none. A socket can only be taken once.
+func takeInheritedFile(key string) *os.File {
+	loadUpgradeState()
+	inherited.Lock()
+	defer inherited.Unlock()
+	f := inherited.files[key]
+	delete(inherited.files, key)
+	return f
+}
+
+// inheritedFdByName returns the descriptor number of the socket
+// passed by systemd socket activation with the given name to the
+// process this one took over from, if any.
+func inheritedFdByName(name string) (int, bool) {
+	loadUpgradeState()
+	inherited.Lock()
+	defer inherited.Unlock()
+	fd, ok := inherited.fdNames[name]
+	return fd, ok
+}
+
+// listenFdNames returns the descriptor numbers of the sockets
+// passed by systemd socket activation, to this process or to the
+// one it took over from, keyed by their name.
+func listenFdNames() (map[string]int, error) {
+	names, err := SystemdListenFds()
+	if err != nil {
+		return nil, err
+	}
+	loadUpgradeState()
+	inherited.Lock()
+	fdNames := maps.Clone(inherited.fdNames)
+	inherited.Unlock()
+	for i, name := range names {
+		if fdNames == nil {
+			fdNames = make(map[string]int)
+		}
+		if _, ok := fdNames[name]; !ok {
+			fdNames[name] = listenFdsStart + i
+		}
+	}
+	return fdNames, nil
+}
+
+// inheritedListener returns a listener for the socket with
+// the listener key that was handed to this process, if any.
+func inheritedListener(key string) (net.Listener, error) {
+	f := takeInheritedFile(key)
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// inheritedPacketConn is like inheritedListener, but for
+// datagram sockets.
+func inheritedPacketConn(key string) (net.PacketConn, error) {
+	f := takeInheritedFile(key)
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
+
+// upgrading is set while an upgrade is in progress.
+var upgrading atomic.Bool
+
+// upgradeProcess performs a zero-downtime upgrade: it starts a new
+// process with the same arguments, hands it the listening sockets
+// and the running config, and exits once the new process reports
+// that it is ready. If the new process fails to start, this process
+// keeps running and an error is returned.
+func upgradeProcess(logger *zap.Logger) error {
+	if !upgrading.CompareAndSwap(false, true) {
+		return fmt.Errorf("an upgrade is already in progress")
+	}
+	defer upgrading.Store(false)
+
+	// collect the open sockets; the files are duplicates,
+	// so they must be closed again once handed over
+	var keys []string
+	sockets := make(map[string]*os.File)
+	defer func() {
+		for _, f := range sockets {
+			f.Close()
+		}
+	}()
+	var err error
+	listenerPool.Range(func(key, value any) bool {
+		var sock any
+		switch v := value.(type) {
+		case *sharedListener:
+			sock = v.Listener
+		case *sharedPacketConn:
+			sock = v.PacketConn
+		}
+		filer, ok := sock.(interface{ File() (*os.File, error) })
+		if !ok {
+			logger.Warn("socket cannot be handed over", zap.Any("listener", key))
+			return true
+		}
+		var f *os.File
+		f, err = filer.File()
+		if err != nil {
+			err = fmt.Errorf("duplicating socket %v: %v", key, err)
+			return false
+		}
+		sockets[key.(string)] = f
+		keys = append(keys, key.(string))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	fdNames, err := listenFdNames()
+	if err != nil {
+		return err
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("creating readiness pipe: %v", err)
+	}
+	defer readyR.Close()
+
+	// descriptors 0-2 are the standard streams, so the n-th
+	// extra file becomes descriptor 3+n in the new process
+	state := upgradeState{ReadyFd: 3, Listeners: make(map[string]int, len(keys)), FdNames: fdNames}
+	extraFiles := []*os.File{readyW}
+	for _, key := range keys {
+		state.Listeners[key] = 3 + len(extraFiles)
+		extraFiles = append(extraFiles, sockets[key])
+	}
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		readyW.Close()
+		return err
+	}
+
+	rawCfgMu.RLock()
+	cfgJSON := bytes.Clone(rawCfgJSON)
+	rawCfgMu.RUnlock()
+
+	cmd := exec.Command(os.Args[0], upgradeArgs(os.Args[1:])...) //nolint:gosec
+	if errors.Is(cmd.Err, exec.ErrDot) {
+		cmd.Err = nil
+	}
+	cmd.Env = upgradeEnviron(os.Environ(), string(stateJSON))
+	cmd.Stdin = bytes.NewReader(cfgJSON)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = extraFiles
+
+	err = cmd.Start()
+	readyW.Close() // only the new process may hold the write end now
+	if err != nil {
+		return fmt.Errorf("starting new process: %v", err)
+	}
+	logger.Info("started new process; handing over",
+		zap.Int("pid", cmd.Process.Pid),
+		zap.Strings("listeners", keys))
+
+	// the new process writes a byte once it is ready; if it
+	// exits before that, the pipe is closed without one
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	buf := make([]byte, 1)
+	if n, _ := io.ReadFull(readyR, buf); n != 1 {
+		return fmt.Errorf("new process exited before it was ready: %v", <-exited)
+	}
+
+	// the new process has written the pidfile and is now the
+	// one the service manager has to watch
+	pidfile = ""
+	if err := notify.MainPID(cmd.Process.Pid); err != nil {
+		logger.Error("unable to notify service manager of new main process", zap.Error(err))
+	}
+	logger.Info("new process is ready; exiting", zap.Int("pid", cmd.Process.Pid))
+	exitProcessWith(context.Background(), logger, exitOptions{handedOver: true})
+	return nil
+}
+
+// upgradeEnviron returns the environment for the process taking
+// over from this one, given the environment of this one and the
+// state handed over. The variables systemd sets for this process
+// only are dropped: the new process becomes the main process of
+// the service, so a watchdog meant for this PID would be ignored
+// by it, and the sockets systemd passed are handed over, if at
+// all, as listeners of the state.
+func upgradeEnviron(environ []string, state string) []string {
+	out := make([]string, 0, len(environ)+1)
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		switch key {
+		case upgradeEnv, "WATCHDOG_PID", "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+		default:
+			out = append(out, kv)
+		}
+	}
+	return append(out, upgradeEnv+"="+state)
+}
+
+// upgradeArgs returns the command line arguments for the process
+// taking over from this one, given the arguments of this one. The
+// confirmation address of the start command is dropped, since the
+// process that started this one is not waiting anymore.
+func upgradeArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--pingback":
+			i++ // skip the value too
+		case strings.HasPrefix(args[i], "--pingback="):
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return out
+}
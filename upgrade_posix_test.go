@@ -0,0 +1,162 @@
+//go:build !windows && !plan9 && !nacl && !js
+
+package uni
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestUpgradeTakeover(t *testing.T) {
+	// pretend a previous process handed us a listening
+	// socket and a pipe to report readiness on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lnFile, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readyR.Close()
+
+	defer readyW.Close()
+	defer lnFile.Close()
+
+	// the handed-over descriptors are owned by the code under
+	// test, so give it duplicates of the ones the files own
+	readyFd, err := syscall.Dup(int(readyW.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnFd, err := syscall.Dup(int(lnFile.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ln.Addr().String()
+	state, err := json.Marshal(upgradeState{
+		ReadyFd:   readyFd,
+		Listeners: map[string]int{listenerKey("tcp", addr): lnFd},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(upgradeEnv, string(state))
+	inherited.once = sync.Once{}
+
+	if !Upgrading() {
+		t.Fatal("expected process to be upgrading")
+	}
+
+	// the address is in use by ln, so this only
+	// succeeds if the handed-over socket is used
+	na, err := ParseNetworkAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := na.Listen(context.Background(), 0, net.ListenConfig{})
+	if err != nil {
+		t.Fatalf("expected handed-over socket to be used: %v", err)
+	}
+	defer got.(net.Listener).Close()
+
+	if err := UpgradeReady(); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	if n, _ := readyR.Read(buf); n != 1 {
+		t.Error("expected readiness to be reported")
+	}
+	if Upgrading() {
+		t.Error("expected upgrade to be complete")
+	}
+	if _, ok := os.LookupEnv(upgradeEnv); ok {
+		t.Errorf("expected %s to be cleared", upgradeEnv)
+	}
+}
+
+func TestUpgradeTakeoverNamedFd(t *testing.T) {
+	// the previous process was passed the socket named
+	// "web" by systemd as descriptor 3, and listened on
+	// it as fd/web, i.e. under the key of fd/3
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "web:dns")
+	fdNames, err := listenFdNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]int{"web": 3, "dns": 4}; !reflect.DeepEqual(fdNames, expect) {
+		t.Fatalf("expected names %v to be handed over, got %v", expect, fdNames)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lnFile, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lnFile.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readyR.Close()
+	defer readyW.Close()
+	readyFd, err := syscall.Dup(int(readyW.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnFd, err := syscall.Dup(int(lnFile.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new process is not passed the systemd variables
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	t.Setenv("LISTEN_FDNAMES", "")
+	state, err := json.Marshal(upgradeState{
+		ReadyFd:   readyFd,
+		Listeners: map[string]int{listenerKey("fd", "3"): lnFd},
+		FdNames:   fdNames,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(upgradeEnv, string(state))
+	inherited.once = sync.Once{}
+	t.Cleanup(func() { inherited.fdNames = nil })
+
+	na, err := ParseNetworkAddress("fd/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := na.Listen(context.Background(), 0, net.ListenConfig{})
+	if err != nil {
+		t.Fatalf("expected the named socket to be taken over: %v", err)
+	}
+	defer got.(net.Listener).Close()
+	if got.(net.Listener).Addr().String() != ln.Addr().String() {
+		t.Errorf("expected the handed-over socket %s, got %s", ln.Addr(), got.(net.Listener).Addr())
+	}
+	if err := UpgradeReady(); err != nil {
+		t.Fatal(err)
+	}
+}
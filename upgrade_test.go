@@ -0,0 +1,72 @@
+package uni
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpgradeArgs(t *testing.T) {
+	for i, tc := range []struct {
+		args   []string
+		expect []string
+	}{
+		{
+			args:   []string{"run", "--config", "guard.json"},
+			expect: []string{"run", "--config", "guard.json"},
+		},
+		{
+			args:   []string{"run", "--pingback", "127.0.0.1:1234", "--config", "guard.json"},
+			expect: []string{"run", "--config", "guard.json"},
+		},
+		{
+			args:   []string{"run", "--pingback=127.0.0.1:1234", "--resume"},
+			expect: []string{"run", "--resume"},
+		},
+	} {
+		if actual := upgradeArgs(tc.args); !reflect.DeepEqual(actual, tc.expect) {
+			t.Errorf("Test %d: expected %v, got %v", i, tc.expect, actual)
+		}
+	}
+}
+
+func TestUpgradeEnviron(t *testing.T) {
+	environ := []string{
+		"HOME=/root",
+		"WATCHDOG_USEC=30000000",
+		"WATCHDOG_PID=1234",
+		"LISTEN_PID=1234",
+		"LISTEN_FDS=2",
+		"LISTEN_FDNAMES=http:https",
+		upgradeEnv + `={"ready_fd":3}`,
+		"NOTIFY_SOCKET=/run/systemd/notify",
+	}
+	expect := []string{
+		"HOME=/root",
+		"WATCHDOG_USEC=30000000",
+		"NOTIFY_SOCKET=/run/systemd/notify",
+		upgradeEnv + `={"ready_fd":4}`,
+	}
+	if actual := upgradeEnviron(environ, `{"ready_fd":4}`); !reflect.DeepEqual(actual, expect) {
+		t.Errorf("expected %v, got %v", expect, actual)
+	}
+}
+
+func TestReloadFromLastConfig(t *testing.T) {
+	t.Cleanup(func() { SetLastConfig("", nil) })
+
+	if err := reloadFromLastConfig(); err == nil {
+		t.Error("expected error without a config file")
+	}
+
+	var loaded string
+	SetLastConfig("guard.json", func(file string) error {
+		loaded = file
+		return nil
+	})
+	if err := reloadFromLastConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded != "guard.json" {
+		t.Errorf("expected guard.json to be reloaded, got %q", loaded)
+	}
+}
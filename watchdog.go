@@ -0,0 +1,164 @@
+// Copyright 2025 K2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uni
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"uni/notify"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// statusInterval is how often the status line
+	// reported to the service manager is refreshed.
+	statusInterval = 10 * time.Second
+
+	// extendTimeoutInterval is how often a running reload
+	// asks the service manager for more time, and
+	// extendTimeoutBy is how much more time it asks for.
+	extendTimeoutInterval = 5 * time.Second
+	extendTimeoutBy       = 3 * extendTimeoutInterval
+)
+
+// Healthy returns an error if the process is not working
+// properly: if it is exiting, or if any app of the running
+// config that implements HealthChecker reports a problem.
+func Healthy() error {
+	if Exiting() {
+		return fmt.Errorf("process is exiting")
+	}
+	ctx := ActiveContext()
+	if ctx.cfg == nil {
+		return nil
+	}
+	// take the apps under the lock, but check them without
+	// it, since an app may load another one while checking
+	ctx.cfg.appsMu.RLock()
+	checkers := make(map[string]HealthChecker)
+	for _, name := range ctx.cfg.appOrder {
+		if hc, ok := ctx.cfg.apps[name].(HealthChecker); ok {
+			checkers[name] = hc
+		}
+	}
+	ctx.cfg.appsMu.RUnlock()
+	for _, name := range ctx.cfg.appOrder {
+		if hc, ok := checkers[name]; ok {
+			if err := hc.Healthy(); err != nil {
+				return fmt.Errorf("%s app module: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// StartWatchdog keeps the service manager informed about the
+// process until ctx is done: it sends a watchdog keep-alive
+// at half the watchdog interval for as long as the process
+// is Healthy, and it keeps the status line up to date. Both
+// are no-ops if not running under a service manager that
+// supports them.
+func StartWatchdog(ctx context.Context) {
+	logger := Log().Named("watchdog")
+	interval, err := notify.WatchdogInterval()
+	if err != nil {
+		logger.Error("watchdog disabled", zap.Error(err))
+	}
+	go runWatchdog(ctx, logger, interval/2)
+}
+
+// runWatchdog does the work of StartWatchdog; keepAlive is
+// how often to send a watchdog keep-alive, or 0 for never.
+func runWatchdog(ctx context.Context, logger *zap.Logger, keepAlive time.Duration) {
+	tick := statusInterval
+	if keepAlive > 0 && keepAlive < tick {
+		tick = keepAlive
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var lastStatus string
+	var lastStatusAt time.Time
+	var unhealthy error
+	for {
+		if keepAlive > 0 {
+			err := Healthy()
+			switch {
+			case err != nil && unhealthy == nil:
+				logger.Error("process is unhealthy; no longer keeping watchdog alive", zap.Error(err))
+			case err == nil && unhealthy != nil:
+				logger.Info("process is healthy again")
+			}
+			unhealthy = err
+			if err == nil {
+				if err := notify.Watchdog(); err != nil {
+					logger.Error("unable to notify service manager of watchdog keep-alive", zap.Error(err))
+				}
+			}
+		}
+
+		if status := serviceStatus(); status != lastStatus || time.Since(lastStatusAt) >= statusInterval {
+			if err := notify.Status(status); err != nil {
+				logger.Error("unable to notify service manager of status", zap.Error(err))
+			}
+			lastStatus, lastStatusAt = status, time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serviceStatus summarizes the state of the process
+// in one line, for the service manager to display.
+func serviceStatus() string {
+	ctx := ActiveContext()
+	if ctx.cfg == nil {
+		return "no config loaded"
+	}
+	status := fmt.Sprintf("%d apps running", len(ctx.cfg.appOrder))
+	if len(ctx.cfg.appOrder) > 0 {
+		status += " (" + strings.Join(ctx.cfg.appOrder, ", ") + ")"
+	}
+	if ctx.metrics != nil {
+		status += fmt.Sprintf("; %d active connections", ctx.metrics.activeConnections())
+	}
+	return status
+}
+
+// extendTimeoutWhile keeps asking the service manager for
+// more time until done is closed, so that slow operations
+// (like loading a large config) do not run into its timeout.
+func extendTimeoutWhile(done <-chan struct{}) {
+	ticker := time.NewTicker(extendTimeoutInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := notify.ExtendTimeout(extendTimeoutBy); err != nil {
+				Log().Error("unable to ask service manager for more time", zap.Error(err))
+			}
+		}
+	}
+}
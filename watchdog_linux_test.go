@@ -0,0 +1,147 @@
+package uni
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWatchdog(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	// a unixgram socket stands in for systemd
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	// collect notifications until the deadline passes
+	receive := func(d time.Duration) []string {
+		var msgs []string
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(d))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return msgs
+			}
+			msgs = append(msgs, string(buf[:n]))
+		}
+	}
+	count := func(msgs []string, prefix string) int {
+		var n int
+		for _, msg := range msgs {
+			if strings.HasPrefix(msg, prefix) {
+				n++
+			}
+		}
+		return n
+	}
+
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "watched"}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runWatchdog(ctx, zap.NewNop(), 10*time.Millisecond)
+
+	msgs := receive(100 * time.Millisecond)
+	if count(msgs, "WATCHDOG=1") == 0 {
+		t.Errorf("expected watchdog keep-alives while healthy, got %q", msgs)
+	}
+	if expect := "STATUS=1 apps running (test_app); 0 active connections"; count(msgs, expect) != 1 {
+		t.Errorf("expected one %q, got %q", expect, msgs)
+	}
+
+	// an unhealthy app stops the keep-alives, and the
+	// changed config is reflected in the status at once
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "watched", "unhealthy": "stuck"}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(20 * time.Millisecond) // drain what was sent before the reload
+	msgs = receive(100 * time.Millisecond)
+	if count(msgs, "WATCHDOG=1") != 0 {
+		t.Errorf("expected no watchdog keep-alives while unhealthy, got %q", msgs)
+	}
+	if err := Healthy(); err == nil || !strings.Contains(err.Error(), "stuck") {
+		t.Errorf("expected health error from app, got %v", err)
+	}
+
+	// the keep-alives resume once the app has recovered
+	err = Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "recovered"}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs = receive(100 * time.Millisecond)
+	if count(msgs, "WATCHDOG=1") == 0 {
+		t.Errorf("expected watchdog keep-alives after recovery, got %q", msgs)
+	}
+}
+
+func TestHealthyWhileLoadingApps(t *testing.T) {
+	t.Cleanup(func() { _ = Stop() })
+
+	err := Load([]byte(`{"admin": {"disabled": true}, "apps": {"test_app": {"name": "watched"}}}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the watchdog checks the apps while another one is
+	// loaded lazily; run with -race to catch unlocked access
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			_ = Healthy()
+		}
+	}()
+	if _, err := ActiveContext().App("test_log_app"); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if err := Healthy(); err != nil {
+		t.Errorf("expected healthy apps, got %v", err)
+	}
+}
+
+func TestExitProcessNotifiesStopping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Cleanup(func() { exiting.Store(false) })
+
+	received := func() string {
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		n, _ := conn.Read(buf)
+		return string(buf[:n])
+	}
+
+	exitProcessWith(context.Background(), zap.NewNop(), exitOptions{})
+	if msg := received(); msg != "STOPPING=1" {
+		t.Errorf("expected the service manager to be told about stopping, got %q", msg)
+	}
+
+	// after an upgrade, the service is not stopping;
+	// only this process, which is not its main one anymore
+	exiting.Store(false)
+	exitProcessWith(context.Background(), zap.NewNop(), exitOptions{handedOver: true})
+	if msg := received(); msg != "" {
+		t.Errorf("expected no notification after handing over, got %q", msg)
+	}
+}